@@ -0,0 +1,248 @@
+// Package archive reads the files out of uploaded archives.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"mediaConverter/api/validation"
+)
+
+var (
+	ErrInvalid        = errors.New("invalid archive")
+	ErrTooManyEntries = errors.New("archive has too many entries")
+	ErrUnsafePath     = errors.New("archive entry escapes the archive root")
+	ErrNested         = errors.New("archive contains another archive")
+)
+
+// sniffLen is how much of an entry is inspected for archive signatures; the
+// tar magic sits at offset 257.
+const sniffLen = 512
+
+// nestedExtensions are entry names rejected as archives regardless of their
+// content.
+var nestedExtensions = []string{".zip", ".tar", ".gz", ".tgz", ".bz2", ".xz", ".7z", ".rar"}
+
+type Limits struct {
+	MaxEntries int
+	// MaxSize bounds the total uncompressed size of all entries.
+	MaxSize int64
+}
+
+// Entry is a regular file inside an archive.
+type Entry struct {
+	// Name is the path of the entry inside the archive, as stored.
+	Name string
+	// Size is the uncompressed size declared by the archive.
+	Size int64
+}
+
+// Walk detects whether r holds a ZIP or a gzipped tar archive and calls fn
+// for every regular file in it, like WalkZip and WalkTarGz.
+func Walk(r io.ReaderAt, size int64, limits Limits, fn func(Entry, io.Reader) error) error {
+	head := make([]byte, sniffLen)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	fileType, _ := validation.DetectBytes(head[:n])
+	switch fileType {
+	case validation.FileTypeZIP:
+		return WalkZip(r, size, limits, fn)
+	case validation.FileTypeGzip:
+		return WalkTarGz(io.NewSectionReader(r, 0, size), limits, fn)
+	default:
+		return fmt.Errorf("%w: not a ZIP or tar.gz archive", ErrInvalid)
+	}
+}
+
+// WalkZip calls fn with the decompressed content of every regular file of
+// the ZIP archive in r, in archive order. Entry count, paths and declared
+// sizes are checked before anything is extracted.
+func WalkZip(r io.ReaderAt, size int64, limits Limits, fn func(Entry, io.Reader) error) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	var files []*zip.File
+	var declared int64
+	for _, f := range zr.File {
+		if err := checkName(f.Name); err != nil {
+			return err
+		}
+		if f.Mode().IsRegular() {
+			files = append(files, f)
+			declared += int64(f.UncompressedSize64)
+		}
+	}
+	if len(files) > limits.MaxEntries {
+		return fmt.Errorf("%w: %d, at most %d allowed", ErrTooManyEntries, len(files), limits.MaxEntries)
+	}
+	if declared < 0 || validation.CheckExpansion(size, declared, limits.MaxSize) != nil {
+		return fmt.Errorf("%w: declares %d bytes", validation.ErrArchiveBomb, declared)
+	}
+
+	guard := &expansionGuard{limits: limits, compressed: func() int64 { return size }}
+	for _, f := range files {
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalid, f.Name, err)
+		}
+
+		err = guard.visit(Entry{Name: f.Name, Size: int64(f.UncompressedSize64)}, rc, fn)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WalkTarGz calls fn with the content of every regular file of the gzipped
+// tar archive in r, in archive order. The archive is read as a stream, so
+// limits are enforced as entries are reached.
+func WalkTarGz(r io.Reader, limits Limits, fn func(Entry, io.Reader) error) error {
+	compressed := &countingReader{r: r}
+	gz, err := gzip.NewReader(compressed)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	defer gz.Close()
+
+	guard := &expansionGuard{limits: limits, compressed: func() int64 { return compressed.n }}
+	tr := tar.NewReader(gz)
+	entries := 0
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+
+		if err := checkName(hdr.Name); err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			// Whatever data other entry types carry still passes the guard.
+			if _, err := io.Copy(io.Discard, &guardedReader{r: tr, guard: guard}); err != nil {
+				return guard.readError(Entry{Name: hdr.Name}, err)
+			}
+			continue
+		}
+
+		entries++
+		if entries > limits.MaxEntries {
+			return fmt.Errorf("%w: at most %d allowed", ErrTooManyEntries, limits.MaxEntries)
+		}
+
+		if err := guard.visit(Entry{Name: hdr.Name, Size: hdr.Size}, tr, fn); err != nil {
+			return err
+		}
+	}
+}
+
+// checkName rejects entry paths that would leave the extraction root if
+// the archive were unpacked to disk (zip-slip).
+func checkName(name string) error {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if name == "" || path.IsAbs(name) || (len(name) > 1 && name[1] == ':') {
+		return fmt.Errorf("%w: %q", ErrUnsafePath, name)
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return fmt.Errorf("%w: %q", ErrUnsafePath, name)
+		}
+	}
+	return nil
+}
+
+// isArchive reports whether an entry is itself an archive, by name or by
+// content.
+func isArchive(name string, head []byte) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range nestedExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+
+	if fileType, err := validation.DetectBytes(head); err == nil && validation.IsArchiveType(fileType) {
+		return true
+	}
+	return len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar"))
+}
+
+// expansionGuard counts the bytes extracted from an archive and fails reads
+// once they exceed the limits.
+type expansionGuard struct {
+	limits     Limits
+	compressed func() int64
+	expanded   int64
+}
+
+// visit rejects nested archives, then hands the entry to fn. Whatever fn
+// leaves unread is drained through the guard, so skipping an entry cannot
+// hide a decompression bomb.
+func (g *expansionGuard) visit(entry Entry, content io.Reader, fn func(Entry, io.Reader) error) error {
+	body := bufio.NewReaderSize(&guardedReader{r: content, guard: g}, sniffLen)
+	head, err := body.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return g.readError(entry, err)
+	}
+	if isArchive(entry.Name, head) {
+		return fmt.Errorf("%w: %s", ErrNested, entry.Name)
+	}
+
+	if err := fn(entry, body); err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return g.readError(entry, err)
+	}
+	return nil
+}
+
+func (g *expansionGuard) readError(entry Entry, err error) error {
+	if errors.Is(err, validation.ErrArchiveBomb) {
+		return err
+	}
+	return fmt.Errorf("%w: %s: %v", ErrInvalid, entry.Name, err)
+}
+
+type guardedReader struct {
+	r     io.Reader
+	guard *expansionGuard
+}
+
+func (g *guardedReader) Read(p []byte) (int, error) {
+	n, err := g.r.Read(p)
+	g.guard.expanded += int64(n)
+	if checkErr := validation.CheckExpansion(g.guard.compressed(), g.guard.expanded, g.guard.limits.MaxSize); checkErr != nil {
+		return n, checkErr
+	}
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,190 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+
+	"mediaConverter/api/validation"
+)
+
+var testLimits = Limits{MaxEntries: 2, MaxSize: 1 << 30}
+
+func buildZip(t *testing.T, files map[string]string, dirs ...string) *bytes.Reader {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, dir := range dirs {
+		if _, err := zw.Create(dir + "/"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestWalkZip(t *testing.T) {
+	r := buildZip(t, map[string]string{"a.jpg": "first", "photos/b.png": "second"}, "photos")
+
+	got := make(map[string]string)
+	err := WalkZip(r, r.Size(), testLimits, func(e Entry, content io.Reader) error {
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return err
+		}
+		if e.Size != int64(len(data)) {
+			t.Errorf("%s: declared size %d, read %d", e.Name, e.Size, len(data))
+		}
+		got[e.Name] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["a.jpg"] != "first" || got["photos/b.png"] != "second" {
+		t.Errorf("unexpected entries %v", got)
+	}
+}
+
+func TestWalkZipLimits(t *testing.T) {
+	r := buildZip(t, map[string]string{"a.jpg": "1", "b.jpg": "2", "c.jpg": "3"})
+
+	called := false
+	err := WalkZip(r, r.Size(), testLimits, func(Entry, io.Reader) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, ErrTooManyEntries) {
+		t.Errorf("expected ErrTooManyEntries, got %v", err)
+	}
+	if called {
+		t.Error("expected nothing to be extracted")
+	}
+
+	garbage := bytes.NewReader([]byte("not a zip"))
+	if err := WalkZip(garbage, garbage.Size(), testLimits, nil); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid, got %v", err)
+	}
+}
+
+func buildTarGz(t *testing.T, files map[string]string) *bytes.Reader {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestWalkTarGz(t *testing.T) {
+	r := buildTarGz(t, map[string]string{"a.jpg": "first", "photos/b.png": "second"})
+
+	got := make(map[string]string)
+	err := Walk(r, r.Size(), testLimits, func(e Entry, content io.Reader) error {
+		data, err := io.ReadAll(content)
+		got[e.Name] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["a.jpg"] != "first" || got["photos/b.png"] != "second" {
+		t.Errorf("unexpected entries %v", got)
+	}
+
+	r = buildTarGz(t, map[string]string{"a.jpg": "1", "b.jpg": "2", "c.jpg": "3"})
+	err = Walk(r, r.Size(), testLimits, func(Entry, io.Reader) error { return nil })
+	if !errors.Is(err, ErrTooManyEntries) {
+		t.Errorf("expected ErrTooManyEntries, got %v", err)
+	}
+}
+
+func TestWalkRejects(t *testing.T) {
+	noop := func(Entry, io.Reader) error { return nil }
+	tests := []struct {
+		name    string
+		archive *bytes.Reader
+		want    error
+	}{
+		{"zip slip", buildZip(t, map[string]string{"../../etc/cron.d/x.jpg": "x"}), ErrUnsafePath},
+		{"zip absolute path", buildZip(t, map[string]string{"/etc/x.jpg": "x"}), ErrUnsafePath},
+		{"tar slip", buildTarGz(t, map[string]string{`photos\..\..\x.jpg`: "x"}), ErrUnsafePath},
+		{"nested by name", buildZip(t, map[string]string{"inner.zip": "x"}), ErrNested},
+		{"nested by content", buildTarGz(t, map[string]string{"inner.jpg": "PK\x03\x04rest"}), ErrNested},
+		{"nested tar", buildZip(t, map[string]string{"inner.jpg": string(buildTarBytes(t))}), ErrNested},
+		{"not an archive", bytes.NewReader([]byte("plain text")), ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Walk(tt.archive, tt.archive.Size(), testLimits, noop)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func buildTarBytes(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "a.jpg", Mode: 0o644, Size: 1, Typeflag: tar.TypeReg})
+	tw.Write([]byte("x"))
+	tw.Close()
+	return buf.Bytes()
+}
+
+func TestWalkExpansionGuard(t *testing.T) {
+	zeros := string(make([]byte, 4<<20))
+
+	// ZIP declares its sizes, so the bomb is refused before extraction.
+	r := buildZip(t, map[string]string{"zeros.jpg": zeros})
+	called := false
+	err := Walk(r, r.Size(), testLimits, func(Entry, io.Reader) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, validation.ErrArchiveBomb) || called {
+		t.Errorf("expected ErrArchiveBomb before extraction, got %v (called=%t)", err, called)
+	}
+
+	// A tar.gz is caught while streaming, even when the entry is not read.
+	r = buildTarGz(t, map[string]string{"zeros.jpg": zeros})
+	err = Walk(r, r.Size(), testLimits, func(Entry, io.Reader) error { return nil })
+	if !errors.Is(err, validation.ErrArchiveBomb) {
+		t.Errorf("expected ErrArchiveBomb, got %v", err)
+	}
+
+	r = buildZip(t, map[string]string{"a.jpg": "first", "b.jpg": "second"})
+	err = Walk(r, r.Size(), Limits{MaxEntries: 2, MaxSize: 8}, func(Entry, io.Reader) error { return nil })
+	if !errors.Is(err, validation.ErrArchiveBomb) {
+		t.Errorf("expected total size limit, got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package blobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"mediaConverter/worker/storage"
+)
+
+const (
+	keyPrefix = "blobs"
+	// stagingPrefix holds uploads whose hash is not known yet. It cannot
+	// clash with the two-hex-digit fan-out directories.
+	stagingPrefix = keyPrefix + "/staging"
+)
+
+// Refs keeps the number of tasks referencing each stored blob.
+type Refs interface {
+	AcquireBlob(ctx context.Context, hash, path string, size int64) error
+	// ReleaseBlob drops one reference. On the last one it calls remove and
+	// forgets the blob only if remove succeeds; AcquireBlob calls for the
+	// same hash wait until it returns.
+	ReleaseBlob(ctx context.Context, hash string, remove func() error) error
+}
+
+// Blob is an uploaded file stored under the SHA-256 of its contents.
+type Blob struct {
+	Hash string
+	Key  string
+	Size int64
+}
+
+// Store saves uploads under content-addressed keys,
+// blobs/<hash[:2]>/<hash><ext>, so concurrent uploads never overwrite each
+// other and identical files are stored once.
+type Store struct {
+	files storage.Backend
+	refs  Refs
+}
+
+func NewStore(files storage.Backend, refs Refs) *Store {
+	return &Store{files: files, refs: refs}
+}
+
+// Save writes r to the store and takes a reference on the resulting blob.
+// ext, including the dot, is kept so consumers can tell the format by name.
+func (s *Store) Save(ctx context.Context, r io.Reader, ext string) (*Blob, error) {
+	// The key depends on the whole content, so the upload is streamed to a
+	// staging key while hashing and moved under its hash afterwards.
+	staging := path.Join(stagingPrefix, uuid.New().String())
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	if err := s.files.Put(ctx, staging, io.TeeReader(r, io.MultiWriter(hash, counter)), -1); err != nil {
+		s.files.Delete(context.WithoutCancel(ctx), staging)
+		return nil, fmt.Errorf("write blob: %w", err)
+	}
+
+	blob := &Blob{Hash: hex.EncodeToString(hash.Sum(nil)), Size: counter.n}
+	blob.Key = Key(blob.Hash, ext)
+
+	// The reference is taken before looking at the stored file: once it is
+	// held, no Release can delete the file, and one that was deleting it has
+	// finished.
+	if err := s.refs.AcquireBlob(ctx, blob.Hash, blob.Key, blob.Size); err != nil {
+		s.files.Delete(context.WithoutCancel(ctx), staging)
+		return nil, fmt.Errorf("reference blob: %w", err)
+	}
+
+	// Identical content is already stored; the staged copy is dropped.
+	_, err := s.files.Stat(ctx, blob.Key)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		err = s.files.Move(ctx, staging, blob.Key)
+	case err == nil:
+		s.files.Delete(context.WithoutCancel(ctx), staging)
+	}
+	if err != nil {
+		s.files.Delete(context.WithoutCancel(ctx), staging)
+		s.Release(context.WithoutCancel(ctx), blob)
+		return nil, fmt.Errorf("commit blob: %w", err)
+	}
+
+	return blob, nil
+}
+
+// Release drops a reference taken by Save and deletes the blob once nothing
+// references it.
+func (s *Store) Release(ctx context.Context, blob *Blob) error {
+	err := s.refs.ReleaseBlob(ctx, blob.Hash, func() error {
+		if err := s.files.Delete(ctx, blob.Key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("delete blob: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("release blob: %w", err)
+	}
+	return nil
+}
+
+// Key returns the storage key of the blob with the given hash.
+func Key(hash, ext string) string {
+	return path.Join(keyPrefix, hash[:2], hash+ext)
+}
+
+// FromKey returns the blob stored under key, or false if key was not
+// returned by Key.
+func FromKey(key string) (*Blob, bool) {
+	name := path.Base(key)
+	hash := strings.TrimSuffix(name, path.Ext(name))
+	if len(hash) != sha256.Size*2 || key != Key(hash, path.Ext(name)) {
+		return nil, false
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return nil, false
+	}
+	return &Blob{Hash: hash, Key: key}, true
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
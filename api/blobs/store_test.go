@@ -0,0 +1,224 @@
+package blobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"mediaConverter/worker/storage"
+)
+
+type memoryRefs struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (m *memoryRefs) AcquireBlob(ctx context.Context, hash, path string, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[hash]++
+	return nil
+}
+
+func (m *memoryRefs) ReleaseBlob(ctx context.Context, hash string, remove func() error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counts[hash] > 1 {
+		m.counts[hash]--
+		return nil
+	}
+	if err := remove(); err != nil {
+		return err
+	}
+	delete(m.counts, hash)
+	return nil
+}
+
+func newTestStore(t *testing.T) (*Store, *memoryRefs, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	files, err := storage.NewLocal(root, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refs := &memoryRefs{counts: make(map[string]int)}
+	return NewStore(files, refs), refs, root
+}
+
+func TestSaveDeduplicates(t *testing.T) {
+	store, refs, root := newTestStore(t)
+	ctx := context.Background()
+
+	first, err := store.Save(ctx, strings.NewReader("same bytes"), ".jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := store.Save(ctx, strings.NewReader("same bytes"), ".jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := store.Save(ctx, strings.NewReader("other bytes"), ".jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Key != second.Key {
+		t.Errorf("expected identical content to share a key, got %s and %s", first.Key, second.Key)
+	}
+	if first.Key == other.Key {
+		t.Error("expected different content to get a different path")
+	}
+	if first.Key != "blobs/"+first.Hash[:2]+"/"+first.Hash+".jpg" {
+		t.Errorf("expected key to be named after the hash, got %s", first.Key)
+	}
+	if refs.counts[first.Hash] != 2 {
+		t.Errorf("expected 2 references, got %d", refs.counts[first.Hash])
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, first.Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "same bytes" {
+		t.Errorf("unexpected content %q", data)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestSaveLeavesNoStagedCopies(t *testing.T) {
+	store, _, root := newTestStore(t)
+	ctx := context.Background()
+
+	store.Save(ctx, strings.NewReader("data"), ".png")
+	store.Save(ctx, strings.NewReader("data"), ".png")
+	if _, err := store.Save(ctx, io.MultiReader(strings.NewReader("partial"), failingReader{}), ".png"); err == nil {
+		t.Fatal("expected the read error")
+	}
+
+	staged, err := os.ReadDir(filepath.Join(root, stagingPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staged) != 0 {
+		t.Errorf("expected no staged uploads, found %d", len(staged))
+	}
+}
+
+func TestReleaseDeletesUnreferencedBlob(t *testing.T) {
+	store, _, root := newTestStore(t)
+	ctx := context.Background()
+
+	first, _ := store.Save(ctx, strings.NewReader("data"), ".png")
+	second, _ := store.Save(ctx, strings.NewReader("data"), ".png")
+
+	if err := store.Release(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, second.Key)); err != nil {
+		t.Fatalf("expected blob to survive while referenced: %v", err)
+	}
+
+	if err := store.Release(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, second.Key)); !os.IsNotExist(err) {
+		t.Errorf("expected blob to be deleted, got %v", err)
+	}
+}
+
+func TestConcurrentSaves(t *testing.T) {
+	store, refs, root := newTestStore(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	paths := make([]string, 20)
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			blob, err := store.Save(ctx, strings.NewReader("photo"), ".jpg")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			paths[i] = blob.Key
+		}(i)
+	}
+	wg.Wait()
+
+	for _, path := range paths[1:] {
+		if path != paths[0] {
+			t.Fatalf("expected all uploads to share a blob, got %s and %s", paths[0], path)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(root, paths[0]))
+	if err != nil || string(data) != "photo" {
+		t.Errorf("unexpected blob content %q: %v", data, err)
+	}
+	for _, count := range refs.counts {
+		if count != len(paths) {
+			t.Errorf("expected %d references, got %d", len(paths), count)
+		}
+	}
+}
+
+func TestSaveRacingLastRelease(t *testing.T) {
+	store, _, root := newTestStore(t)
+	ctx := context.Background()
+
+	for i := 0; i < 100; i++ {
+		held, err := store.Save(ctx, strings.NewReader("photo"), ".jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.Release(ctx, held)
+		}()
+		saved, err := store.Save(ctx, strings.NewReader("photo"), ".jpg")
+		wg.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := os.Stat(filepath.Join(root, saved.Key)); err != nil {
+			t.Fatalf("iteration %d: referenced blob is missing: %v", i, err)
+		}
+		store.Release(ctx, saved)
+	}
+}
+
+func TestFromKey(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+
+	blob, ok := FromKey(Key(hash, ".jpg"))
+	if !ok || blob.Hash != hash || blob.Key != Key(hash, ".jpg") {
+		t.Errorf("expected the blob of %s, got %+v", hash, blob)
+	}
+
+	for _, key := range []string{
+		"uploads/" + hash + ".jpg",
+		"blobs/cd/" + hash + ".jpg",
+		"blobs/ab/abc.jpg",
+		"blobs/staging/" + hash,
+	} {
+		if _, ok := FromKey(key); ok {
+			t.Errorf("expected %s not to be a blob key", key)
+		}
+	}
+}
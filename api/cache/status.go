@@ -13,6 +13,8 @@ import (
 const (
 	statusKeyPrefix = "task:status:"
 	statusTTL       = 10 * time.Minute
+	// cancelChannel is the channel workers listen on for cancelled tasks.
+	cancelChannel = "task:cancel"
 )
 
 type StatusCache struct {
@@ -50,6 +52,12 @@ func (sc *StatusCache) Set(ctx context.Context, taskID string, status models.Tas
 	return sc.cache.Set(ctx, key, data, statusTTL)
 }
 
+// PublishCancellation tells the workers that the task has been cancelled, so
+// the one running it stops.
+func (sc *StatusCache) PublishCancellation(ctx context.Context, taskID string) error {
+	return sc.cache.Publish(ctx, cancelChannel, taskID)
+}
+
 func (sc *StatusCache) Delete(ctx context.Context, taskID string) error {
 	key := fmt.Sprintf("%s%s", statusKeyPrefix, taskID)
 	return sc.cache.Del(ctx, key)
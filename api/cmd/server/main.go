@@ -3,24 +3,32 @@ package main
 import (
 	"context"
 	"embed"
-	"io"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
-	"strings"
 	"syscall"
 	"time"
 
+	"mediaConverter/api/blobs"
 	"mediaConverter/api/cache"
 	"mediaConverter/api/config"
 	"mediaConverter/api/database"
+	"mediaConverter/api/fetch"
 	"mediaConverter/api/handlers"
+	"mediaConverter/api/iiif"
 	"mediaConverter/api/kafka"
 	"mediaConverter/api/middleware"
+	"mediaConverter/api/outbox"
+	"mediaConverter/api/rendercache"
 	"mediaConverter/api/repository"
+	"mediaConverter/api/scheduler"
 	"mediaConverter/api/service"
+	"mediaConverter/api/transform"
+	"mediaConverter/api/tus"
+	workerkafka "mediaConverter/worker/kafka"
+	"mediaConverter/worker/storage"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
@@ -57,8 +65,61 @@ func main() {
 	}
 	defer kafkaProducer.Close()
 
-	taskService := service.NewTaskService(repo, statusCache, kafkaProducer)
-	taskHandler := handlers.NewTaskHandler(taskService, logger)
+	files, err := storage.New(cfg.Storage)
+	if err != nil {
+		logger.Fatal("Failed to create storage backend", zap.Error(err))
+	}
+
+	relay := outbox.NewRelay(repo, kafkaProducer, cfg.OutboxPollInterval, cfg.OutboxBatchSize, logger)
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		relay.Run(relayCtx)
+	}()
+
+	taskService := service.NewTaskService(repo, statusCache, relay)
+
+	taskScheduler := scheduler.NewScheduler(db.AdvisoryLock(scheduler.LockKey), taskService, cfg.SchedulerInterval, logger)
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		taskScheduler.Run(schedulerCtx)
+	}()
+	blobStore := blobs.NewStore(files, repo)
+	fetcher := fetch.New(fetch.Config{
+		MaxSize:      cfg.MaxFileSize,
+		Timeout:      cfg.FetchTimeout,
+		MaxRedirects: cfg.FetchMaxRedirects,
+	})
+	taskHandler := handlers.NewTaskHandler(taskService, blobStore, files, fetcher, handlers.UploadLimits{
+		MaxFileSize:            cfg.MaxFileSize,
+		MaxArchiveSize:         cfg.MaxArchiveSize,
+		MaxArchiveEntries:      cfg.MaxArchiveEntries,
+		MaxArchiveExpandedSize: cfg.MaxArchiveExpandedSize,
+	}, logger)
+	fileHandler := handlers.NewFileHandler(files, cfg.MaxFileSize, logger)
+	tusHandler := tus.NewHandler(repo, files, taskHandler, cfg.MaxFileSize, logger)
+
+	iiifCache, err := rendercache.New(cfg.IIIFCacheDir, cfg.IIIFCacheMax)
+	if err != nil {
+		logger.Fatal("Failed to create IIIF cache", zap.Error(err))
+	}
+	iiifHandler := iiif.NewHandler(taskService, files, iiifCache, logger)
+
+	imgCache, err := rendercache.New(cfg.ImgCacheDir, cfg.ImgCacheMax)
+	if err != nil {
+		logger.Fatal("Failed to create image cache", zap.Error(err))
+	}
+	transformHandler := transform.NewHandler(taskService, files, imgCache, []byte(cfg.ImgSignKey), logger)
+
+	deadLetters, err := kafka.NewDeadLetterReader([]string{cfg.KafkaBrokers}, workerkafka.DeadLetterTopic(kafka.TasksTopic))
+	if err != nil {
+		logger.Fatal("Failed to connect to Kafka", zap.Error(err))
+	}
+	defer deadLetters.Close()
+	adminHandler := handlers.NewAdminHandler(deadLetters, taskService, logger)
 
 	mux := http.NewServeMux()
 
@@ -77,51 +138,51 @@ func main() {
 		w.Write(content)
 	})
 
-	mux.HandleFunc("/download/", func(w http.ResponseWriter, r *http.Request) {
-		filename := r.URL.Path[len("/download/"):]
-		if filename == "" {
-			http.Error(w, "Filename is required", http.StatusBadRequest)
-			return
-		}
-
-		filePath := "/uploads/" + filename
-
-		fileInfo, err := os.Stat(filePath)
-		if err != nil {
-			http.Error(w, "File not found", http.StatusNotFound)
-			return
-		}
-
-		file, err := os.Open(filePath)
-		if err != nil {
-			http.Error(w, "Failed to open file", http.StatusInternalServerError)
-			return
-		}
-		defer file.Close()
-
-		contentType := "application/octet-stream"
-		switch {
-		case strings.HasSuffix(filename, ".jpg"), strings.HasSuffix(filename, ".jpeg"):
-			contentType = "image/jpeg"
-		case strings.HasSuffix(filename, ".png"):
-			contentType = "image/png"
-		case strings.HasSuffix(filename, ".gif"):
-			contentType = "image/gif"
-		case strings.HasSuffix(filename, ".pdf"):
-			contentType = "application/pdf"
-		case strings.HasSuffix(filename, ".mp4"):
-			contentType = "video/mp4"
-		}
-
-		w.Header().Set("Content-Type", contentType)
-		w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
-		w.Header().Set("Content-Length", strconv.FormatInt(fileInfo.Size(), 10))
-
-		io.Copy(w, file)
-	})
-
+	mux.HandleFunc("GET /download/{filename}", fileHandler.Download)
 	mux.HandleFunc("/upload", taskHandler.Upload)
+	mux.HandleFunc("POST /tasks", taskHandler.CreateFromURL)
+	mux.HandleFunc("POST /jobs", taskHandler.CreateJob)
+	mux.HandleFunc("GET /jobs/{id}", taskHandler.Job)
+	mux.HandleFunc("GET /jobs/{id}/download", taskHandler.JobDownload)
+	mux.HandleFunc("POST /uploads/presign", taskHandler.PresignUpload)
+	mux.HandleFunc("POST /tasks/{id}/commit", taskHandler.CommitUpload)
+	mux.HandleFunc("POST /tasks/{id}/cancel", taskHandler.Cancel)
+	mux.HandleFunc("POST /tasks/{id}/retry", taskHandler.Retry)
+	mux.HandleFunc("GET /tasks/scheduled", taskHandler.Scheduled)
+	mux.HandleFunc("OPTIONS /tus/{$}", tusHandler.Options)
+	mux.HandleFunc("POST /tus/{$}", tusHandler.Create)
+	mux.HandleFunc("OPTIONS /tus/{id}", tusHandler.Options)
+	mux.HandleFunc("HEAD /tus/{id}", tusHandler.Head)
+	mux.HandleFunc("PATCH /tus/{id}", tusHandler.Patch)
+	mux.HandleFunc("DELETE /tus/{id}", tusHandler.Delete)
+	mux.HandleFunc("POST /compare", taskHandler.Compare)
+	mux.HandleFunc("POST /contact-sheet", taskHandler.ContactSheet)
+	mux.HandleFunc("POST /tiles", taskHandler.Tiles)
 	mux.HandleFunc("/status/", taskHandler.Status)
+	mux.HandleFunc("GET /tasks/{id}/similar", taskHandler.Similar)
+	mux.HandleFunc("GET /tasks/{id}/tiles.dzi", taskHandler.TileDescriptor)
+	mux.HandleFunc("GET /tasks/{id}/tiles_files/{level}/{tile}", taskHandler.Tile)
+	mux.HandleFunc("GET /iiif/{id}", iiifHandler.Redirect)
+	mux.HandleFunc("GET /iiif/{id}/info.json", iiifHandler.Info)
+	mux.HandleFunc("GET /iiif/{id}/{region}/{size}/{rotation}/{file}", iiifHandler.Image)
+	if cfg.ImgSignKey != "" {
+		mux.HandleFunc("GET /img/{signature}/{ops}/{taskID}", transformHandler.Image)
+	} else {
+		logger.Warn("IMG_SIGNING_KEY is not set, /img is disabled")
+	}
+	if cfg.AdminToken != "" {
+		admin := middleware.AdminToken(cfg.AdminToken)
+		mux.Handle("GET /admin/dlq", admin(http.HandlerFunc(adminHandler.ListDeadLetters)))
+		mux.Handle("GET /admin/dlq/{partition}/{offset}", admin(http.HandlerFunc(adminHandler.DeadLetter)))
+		mux.Handle("POST /admin/dlq/{partition}/{offset}/replay", admin(http.HandlerFunc(adminHandler.ReplayDeadLetter)))
+	} else {
+		logger.Warn("ADMIN_TOKEN is not set, /admin is disabled")
+	}
+	if _, ok := files.(*storage.Local); ok {
+		mux.HandleFunc("GET /files/{key...}", fileHandler.Presigned)
+		mux.HandleFunc("PUT /files/{key...}", fileHandler.Presigned)
+	}
+	mux.Handle("GET /metrics", promhttp.Handler())
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
@@ -137,6 +198,19 @@ func main() {
 		Handler: handler,
 	}
 
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			purged, err := tusHandler.PurgeExpired(context.Background())
+			if err != nil {
+				logger.Error("Failed to purge expired uploads", zap.Error(err))
+			} else if purged > 0 {
+				logger.Info("Purged expired uploads", zap.Int("count", purged))
+			}
+		}
+	}()
+
 	go func() {
 		logger.Info("Server started", zap.String("address", srv.Addr))
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -157,5 +231,14 @@ func main() {
 		logger.Error("Server forced to shutdown", zap.Error(err))
 	}
 
+	// Another replica takes over the schedule once the lock is released.
+	stopScheduler()
+	<-schedulerDone
+
+	// Messages the relay has not published yet stay in the outbox for the
+	// next relay run, here or on another replica.
+	stopRelay()
+	<-relayDone
+
 	logger.Info("Server exited")
 }
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AdvisoryLock is a session-level Postgres advisory lock. It is held on a
+// connection of its own, so it lasts until released or until that
+// connection breaks. It is not safe for concurrent use.
+type AdvisoryLock struct {
+	pool *pgxpool.Pool
+	key  int64
+	conn *pgxpool.Conn
+}
+
+func (db *DB) AdvisoryLock(key int64) *AdvisoryLock {
+	return &AdvisoryLock{pool: db.Pool, key: key}
+}
+
+// TryAcquire reports whether the lock is held, taking it if it is free. A
+// lock already held is checked to still be held.
+func (l *AdvisoryLock) TryAcquire(ctx context.Context) (bool, error) {
+	if l.conn != nil {
+		if err := l.conn.Ping(ctx); err != nil {
+			l.drop(ctx)
+			return false, err
+		}
+		return true, nil
+	}
+
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&locked); err != nil {
+		conn.Release()
+		return false, err
+	}
+	if !locked {
+		conn.Release()
+		return false, nil
+	}
+
+	l.conn = conn
+	return true, nil
+}
+
+// Release gives the lock up if it is held.
+func (l *AdvisoryLock) Release(ctx context.Context) {
+	if l.conn == nil {
+		return
+	}
+
+	if _, err := l.conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, l.key); err != nil {
+		l.drop(ctx)
+		return
+	}
+	l.conn.Release()
+	l.conn = nil
+}
+
+// drop closes the lock's connection instead of returning it to the pool,
+// since it may still hold the lock; closing the session releases it.
+func (l *AdvisoryLock) drop(ctx context.Context) {
+	l.conn.Hijack().Close(ctx)
+	l.conn = nil
+}
@@ -0,0 +1,6 @@
+ALTER TABLE tasks
+DROP COLUMN ahash,
+DROP COLUMN dhash,
+DROP COLUMN phash,
+DROP COLUMN duplicate_policy,
+DROP COLUMN duplicate_of;
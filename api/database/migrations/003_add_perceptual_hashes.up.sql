@@ -0,0 +1,6 @@
+ALTER TABLE tasks
+ADD COLUMN ahash BIGINT,
+ADD COLUMN dhash BIGINT,
+ADD COLUMN phash BIGINT,
+ADD COLUMN duplicate_policy VARCHAR(10) NOT NULL DEFAULT 'allow',
+ADD COLUMN duplicate_of UUID REFERENCES tasks(id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_tasks_task_type;
+
+ALTER TABLE tasks
+DROP COLUMN task_type,
+DROP COLUMN options,
+DROP COLUMN result;
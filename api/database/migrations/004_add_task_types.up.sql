@@ -0,0 +1,6 @@
+ALTER TABLE tasks
+ADD COLUMN task_type VARCHAR(20) NOT NULL DEFAULT 'convert',
+ADD COLUMN options JSONB,
+ADD COLUMN result JSONB;
+
+CREATE INDEX idx_tasks_task_type ON tasks(task_type);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_tasks_cache_key;
+
+ALTER TABLE tasks
+DROP COLUMN source_hash,
+DROP COLUMN cache_key;
@@ -0,0 +1,5 @@
+ALTER TABLE tasks
+ADD COLUMN source_hash CHAR(64),
+ADD COLUMN cache_key CHAR(64);
+
+CREATE INDEX idx_tasks_cache_key ON tasks(cache_key) WHERE status = 'completed';
@@ -0,0 +1,2 @@
+ALTER TABLE tasks
+DROP COLUMN upload_size;
@@ -0,0 +1,2 @@
+ALTER TABLE tasks
+ADD COLUMN upload_size BIGINT;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS tus_uploads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    trace_id VARCHAR(36) NOT NULL,
+    upload_length BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    chunks TEXT[] NOT NULL DEFAULT '{}',
+    task_id UUID REFERENCES tasks(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_tus_uploads_expires_at ON tus_uploads(expires_at);
@@ -0,0 +1,4 @@
+ALTER TABLE tasks
+DROP COLUMN job_id;
+
+DROP TABLE IF EXISTS jobs;
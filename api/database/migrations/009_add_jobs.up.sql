@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    trace_id VARCHAR(36) NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+ALTER TABLE tasks
+ADD COLUMN job_id UUID REFERENCES jobs(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_tasks_job_id ON tasks(job_id) WHERE job_id IS NOT NULL;
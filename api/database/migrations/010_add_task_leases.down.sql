@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_tasks_lease_expires_at;
+
+ALTER TABLE tasks
+DROP COLUMN lease_expires_at,
+DROP COLUMN lease_owner;
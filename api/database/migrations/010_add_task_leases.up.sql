@@ -0,0 +1,5 @@
+ALTER TABLE tasks
+ADD COLUMN lease_owner VARCHAR(255),
+ADD COLUMN lease_expires_at TIMESTAMP;
+
+CREATE INDEX idx_tasks_lease_expires_at ON tasks(lease_expires_at) WHERE status = 'processing';
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS task_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    topic VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    sent_at TIMESTAMP
+);
+
+CREATE INDEX idx_task_outbox_unsent ON task_outbox(id) WHERE sent_at IS NULL;
+CREATE INDEX idx_task_outbox_sent_at ON task_outbox(sent_at) WHERE sent_at IS NOT NULL;
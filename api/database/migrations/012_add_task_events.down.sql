@@ -0,0 +1,4 @@
+ALTER TABLE tasks
+DROP COLUMN requeue_count;
+
+DROP TABLE IF EXISTS task_events;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS task_events (
+    id BIGSERIAL PRIMARY KEY,
+    task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    event VARCHAR(50) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_task_events_task_id ON task_events(task_id, created_at);
+
+ALTER TABLE tasks
+ADD COLUMN requeue_count INTEGER NOT NULL DEFAULT 0;
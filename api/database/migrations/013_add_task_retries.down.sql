@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_tasks_retry_of;
+
+ALTER TABLE tasks
+DROP COLUMN attempt,
+DROP COLUMN retry_of;
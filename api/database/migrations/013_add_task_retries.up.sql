@@ -0,0 +1,5 @@
+ALTER TABLE tasks
+ADD COLUMN retry_of UUID REFERENCES tasks(id) ON DELETE SET NULL,
+ADD COLUMN attempt INTEGER NOT NULL DEFAULT 1;
+
+CREATE UNIQUE INDEX idx_tasks_retry_of ON tasks(retry_of) WHERE retry_of IS NOT NULL;
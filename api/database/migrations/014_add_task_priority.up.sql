@@ -0,0 +1,2 @@
+ALTER TABLE tasks
+ADD COLUMN priority VARCHAR(20) NOT NULL DEFAULT 'normal';
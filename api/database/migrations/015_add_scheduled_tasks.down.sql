@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_tasks_run_at;
+
+ALTER TABLE tasks
+DROP COLUMN run_at;
@@ -0,0 +1,4 @@
+ALTER TABLE tasks
+ADD COLUMN run_at TIMESTAMP;
+
+CREATE INDEX idx_tasks_run_at ON tasks(run_at) WHERE status = 'scheduled';
@@ -0,0 +1,2 @@
+ALTER TABLE tus_uploads
+DROP COLUMN completing_since;
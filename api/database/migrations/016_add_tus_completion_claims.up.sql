@@ -0,0 +1,2 @@
+ALTER TABLE tus_uploads
+ADD COLUMN completing_since TIMESTAMP;
@@ -1,31 +1,226 @@
 package dto
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
 
-var ErrTaskNotFound = errors.New("task not found")
+var (
+	ErrTaskNotFound   = errors.New("task not found")
+	ErrHashesNotReady = errors.New("perceptual hashes are not computed yet")
+	ErrUploadNotReady = errors.New("task is not awaiting an upload")
+	ErrJobNotFound    = errors.New("job not found")
+	ErrJobNotFinished = errors.New("job has unfinished tasks")
+	ErrNotReplayable  = errors.New("only pending or failed tasks can be replayed")
+	ErrNotCancellable = errors.New("only unfinished tasks can be cancelled")
+	ErrNotRetryable   = errors.New("only failed tasks can be retried")
+	ErrAlreadyRetried = errors.New("task has already been retried")
+)
 
 type CreateTaskRequest struct {
-	OriginalFilename string `json:"original_filename"`
-	FilePath         string `json:"file_path"`
-	OutputFormat     string `json:"output_format"`
-	TargetWidth      *int   `json:"target_width"`
-	TargetHeight     *int   `json:"target_height"`
-	Crop             bool   `json:"crop"`
+	Type             string          `json:"type"`
+	OriginalFilename string          `json:"original_filename"`
+	FilePath         string          `json:"file_path"`
+	OutputFormat     string          `json:"output_format"`
+	TargetWidth      *int            `json:"target_width"`
+	TargetHeight     *int            `json:"target_height"`
+	Crop             bool            `json:"crop"`
+	DuplicatePolicy  string          `json:"duplicate_policy"`
+	Priority         string          `json:"priority"`
+	RunAt            *time.Time      `json:"run_at,omitempty"`
+	Options          json.RawMessage `json:"options,omitempty"`
+	SourceHash       string          `json:"source_hash,omitempty"`
+	JobID            string          `json:"job_id,omitempty"`
+}
+
+// CompareOptions are the options of a compare task: FilePath holds the
+// reference image and CandidatePath the image compared against it.
+type CompareOptions struct {
+	CandidatePath     string `json:"candidate_path"`
+	CandidateFilename string `json:"candidate_filename"`
+	Normalize         bool   `json:"normalize"`
+}
+
+type ContactSheetOptions struct {
+	Sources    []SourceFile `json:"sources"`
+	Columns    int          `json:"columns"`
+	CellWidth  int          `json:"cell_width"`
+	CellHeight int          `json:"cell_height"`
+	Gutter     int          `json:"gutter"`
+	Background string       `json:"background"`
+	Captions   bool         `json:"captions"`
+	Fit        string       `json:"fit"`
+}
+
+type TileOptions struct {
+	TileSize int    `json:"tile_size"`
+	Overlap  int    `json:"overlap"`
+	Format   string `json:"format"`
+}
+
+type SourceFile struct {
+	Path     string `json:"path"`
+	Filename string `json:"filename"`
 }
 
 type TaskResponse struct {
-	ID                string  `json:"id"`
-	TraceID           string  `json:"trace_id"`
-	OriginalFilename  string  `json:"original_filename"`
-	OutputFilename    string  `json:"output_filename,omitempty"`
-	OutputFormat      string  `json:"output_format"`
-	TargetWidth       *int    `json:"target_width,omitempty"`
-	TargetHeight      *int    `json:"target_height,omitempty"`
-	Crop              bool    `json:"crop"`
-	Status            string  `json:"status"`
-	ErrorMessage      string  `json:"error_message,omitempty"`
-	CreatedAt         string  `json:"created_at"`
-	CompletedAt       *string `json:"completed_at,omitempty"`
+	ID               string          `json:"id"`
+	TraceID          string          `json:"trace_id"`
+	Type             string          `json:"type"`
+	OriginalFilename string          `json:"original_filename"`
+	OutputFilename   string          `json:"output_filename,omitempty"`
+	OutputFormat     string          `json:"output_format"`
+	TargetWidth      *int            `json:"target_width,omitempty"`
+	TargetHeight     *int            `json:"target_height,omitempty"`
+	Crop             bool            `json:"crop"`
+	DuplicateOf      string          `json:"duplicate_of,omitempty"`
+	Priority         string          `json:"priority"`
+	JobID            string          `json:"job_id,omitempty"`
+	RunAt            *string         `json:"run_at,omitempty"`
+	RetryOf          string          `json:"retry_of,omitempty"`
+	Attempt          int             `json:"attempt"`
+	Status           string          `json:"status"`
+	ErrorMessage     string          `json:"error_message,omitempty"`
+	Result           json.RawMessage `json:"result,omitempty"`
+	CreatedAt        string          `json:"created_at"`
+	CompletedAt      *string         `json:"completed_at,omitempty"`
+}
+
+// TaskListResponse is a page of tasks.
+type TaskListResponse struct {
+	Tasks []*TaskResponse `json:"tasks"`
+}
+
+type SimilarTask struct {
+	TaskResponse
+	Distance int `json:"distance"`
+}
+
+type SimilarTasksResponse struct {
+	TaskID      string        `json:"task_id"`
+	Hash        string        `json:"hash"`
+	MaxDistance int           `json:"max_distance"`
+	Tasks       []SimilarTask `json:"tasks"`
+}
+
+// PresignUploadRequest describes a file the client is about to upload
+// directly to storage, along with the conversion parameters of /upload.
+type PresignUploadRequest struct {
+	Filename        string     `json:"filename"`
+	Size            int64      `json:"size"`
+	OutputFormat    string     `json:"output_format"`
+	TargetWidth     *int       `json:"target_width"`
+	TargetHeight    *int       `json:"target_height"`
+	Crop            bool       `json:"crop"`
+	DuplicatePolicy string     `json:"duplicate_policy"`
+	Priority        string     `json:"priority"`
+	RunAt           *time.Time `json:"run_at"`
+}
+
+// CreateFromURLRequest asks the API to fetch the source from SourceURL
+// instead of receiving it as an upload.
+type CreateFromURLRequest struct {
+	SourceURL       string     `json:"source_url"`
+	OutputFormat    string     `json:"output_format"`
+	TargetWidth     *int       `json:"target_width"`
+	TargetHeight    *int       `json:"target_height"`
+	Crop            bool       `json:"crop"`
+	DuplicatePolicy string     `json:"duplicate_policy"`
+	Priority        string     `json:"priority"`
+	RunAt           *time.Time `json:"run_at"`
+}
+
+type PresignUploadResponse struct {
+	Task      *TaskResponse `json:"task"`
+	UploadURL string        `json:"upload_url"`
+	Method    string        `json:"method"`
+	ExpiresAt string        `json:"expires_at"`
+}
+
+// PendingUpload is a task waiting for its source to be uploaded.
+type PendingUpload struct {
+	TaskID   string
+	Key      string
+	Filename string
+	Size     int64
+}
+
+// CancelledTask is a task cancelled before a worker picked it up, with the
+// stored objects it no longer needs.
+type CancelledTask struct {
+	Task *TaskResponse
+	// Blobs are the keys of the blobs the task held a reference to.
+	Blobs []string
+	// Upload is the key of a direct upload that was never committed.
+	Upload string
+}
+
+// JobResponse reports the progress of a batch: how many of its tasks are in
+// each status.
+type JobResponse struct {
+	ID          string         `json:"id"`
+	TraceID     string         `json:"trace_id"`
+	Total       int            `json:"total"`
+	Counts      map[string]int `json:"counts"`
+	Done        bool           `json:"done"`
+	DownloadURL string         `json:"download_url,omitempty"`
+	Skipped     []SkippedFile  `json:"skipped,omitempty"`
+	CreatedAt   string         `json:"created_at"`
+}
+
+// SkippedFile is an archive entry that did not become a task.
+type SkippedFile struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// JobOutput is the result file of a completed task of a job.
+type JobOutput struct {
+	TaskID           string
+	OriginalFilename string
+	OutputFilename   string
+}
+
+// DeadLetterResponse is a message parked on the dead-letter topic. Payload
+// holds the message if it is JSON; otherwise RawPayload has its bytes.
+type DeadLetterResponse struct {
+	ID            string            `json:"id"`
+	Partition     int32             `json:"partition"`
+	Offset        int64             `json:"offset"`
+	Timestamp     string            `json:"timestamp"`
+	TaskID        string            `json:"task_id,omitempty"`
+	Reason        string            `json:"reason,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	Attempts      int               `json:"attempts,omitempty"`
+	OriginalTopic string            `json:"original_topic,omitempty"`
+	Headers       map[string]string `json:"headers"`
+	Payload       json.RawMessage   `json:"payload,omitempty"`
+	RawPayload    []byte            `json:"raw_payload,omitempty"`
+}
+
+type DeadLetterListResponse struct {
+	Entries []*DeadLetterResponse `json:"entries"`
+}
+
+// ReplayRequest puts a dead-lettered task back on the queue. Set fields
+// replace the task's conversion parameters; TaskID is only needed when the
+// payload cannot be decoded.
+type ReplayRequest struct {
+	TaskID       string  `json:"task_id"`
+	OutputFormat *string `json:"output_format"`
+	TargetWidth  *int    `json:"target_width"`
+	TargetHeight *int    `json:"target_height"`
+	Crop         *bool   `json:"crop"`
+}
+
+// RetryRequest overrides conversion parameters of the failed task that is
+// being retried; unset fields keep the task's values.
+type RetryRequest struct {
+	OutputFormat *string `json:"output_format"`
+	TargetWidth  *int    `json:"target_width"`
+	TargetHeight *int    `json:"target_height"`
+	Crop         *bool   `json:"crop"`
 }
 
 type ErrorResponse struct {
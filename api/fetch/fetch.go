@@ -0,0 +1,213 @@
+// Package fetch downloads user-supplied URLs without letting them reach the
+// service's own network.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInvalidURL        = errors.New("invalid source URL")
+	ErrForbiddenAddress  = errors.New("source address is not allowed")
+	ErrTooManyRedirects  = errors.New("too many redirects")
+	ErrTooLarge          = errors.New("source exceeds the size limit")
+	ErrUnexpectedStatus  = errors.New("source returned an unexpected status")
+	ErrUnsupportedScheme = errors.New("source URL scheme must be http or https")
+)
+
+type Config struct {
+	// MaxSize is the largest body accepted, in bytes.
+	MaxSize int64
+	// Timeout covers the whole download, redirects and body included.
+	Timeout      time.Duration
+	MaxRedirects int
+}
+
+// blockedPrefixes are special-purpose ranges not covered by the netip
+// predicates in isPublic.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// isPublic reports whether addr is a globally routable unicast address.
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Fetcher downloads http and https URLs. Addresses are checked when the
+// connection is dialled, after DNS resolution, so neither a hostname
+// pointing at a private range nor a redirect to one gets through.
+type Fetcher struct {
+	cfg    Config
+	client *http.Client
+	// allowed decides which resolved addresses may be dialled.
+	allowed func(netip.Addr) bool
+}
+
+func New(cfg Config) *Fetcher {
+	f := &Fetcher{cfg: cfg, allowed: isPublic}
+
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+			}
+			if !f.allowed(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	f.client = &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			// Proxies from the environment would be dialled instead of the
+			// source and bypass the address check.
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			return checkScheme(req.URL)
+		},
+	}
+
+	return f
+}
+
+// Response is a fetched source. Body must be closed; reading past MaxSize
+// fails with ErrTooLarge.
+type Response struct {
+	Body io.ReadCloser
+	// Filename comes from Content-Disposition or, failing that, the last
+	// segment of the final URL. It may be empty.
+	Filename    string
+	ContentType string
+	// Size is the announced length, or -1 if unknown.
+	Size int64
+}
+
+// Get starts downloading rawURL.
+func (f *Fetcher) Get(ctx context.Context, rawURL string) (*Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !u.IsAbs() {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidURL, rawURL)
+	}
+	if err := checkScheme(u); err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidURL, rawURL)
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("%w: credentials are not allowed", ErrInvalidURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		// The client wraps errors from the dialer and CheckRedirect; unwrap
+		// to the sentinel so callers can tell them apart.
+		for _, sentinel := range []error{ErrForbiddenAddress, ErrTooManyRedirects, ErrUnsupportedScheme} {
+			if errors.Is(err, sentinel) {
+				return nil, fmt.Errorf("%w: %v", sentinel, err)
+			}
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+	if resp.ContentLength > f.cfg.MaxSize {
+		resp.Body.Close()
+		return nil, ErrTooLarge
+	}
+
+	return &Response{
+		Body:        &limitedBody{ReadCloser: resp.Body, remaining: f.cfg.MaxSize},
+		Filename:    filename(resp),
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+	}, nil
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: %q", ErrUnsupportedScheme, u.Scheme)
+	}
+	return nil
+}
+
+func filename(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := path.Base(strings.ReplaceAll(params["filename"], "\\", "/")); name != "." && name != "/" {
+			return name
+		}
+	}
+
+	name := path.Base(resp.Request.URL.Path)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// limitedBody fails with ErrTooLarge instead of silently truncating.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/kafka"
+	"mediaConverter/api/middleware"
+	workerkafka "mediaConverter/worker/kafka"
+)
+
+const (
+	defaultDeadLetterLimit = 50
+	maxDeadLetterLimit     = 500
+)
+
+type ReplayService interface {
+	ReplayTask(ctx context.Context, taskID string, req *dto.ReplayRequest) (*dto.TaskResponse, error)
+}
+
+// AdminHandler lets operators inspect the dead-letter topic and queue its
+// tasks again.
+type AdminHandler struct {
+	deadLetters kafka.DeadLetterReader
+	service     ReplayService
+	logger      *zap.Logger
+}
+
+func NewAdminHandler(deadLetters kafka.DeadLetterReader, service ReplayService, logger *zap.Logger) *AdminHandler {
+	return &AdminHandler{
+		deadLetters: deadLetters,
+		service:     service,
+		logger:      logger,
+	}
+}
+
+// ListDeadLetters lists the latest messages of the dead-letter topic.
+//
+//	@Summary		List dead-lettered messages
+//	@Tags			admin
+//	@Produce		json
+//	@Param			limit	query		int	false	"Maximum number of entries"	default(50)
+//	@Success		200		{object}	dto.DeadLetterListResponse
+//	@Failure		400		{object}	dto.ErrorResponse
+//	@Failure		401		{object}	dto.ErrorResponse
+//	@Failure		502		{object}	dto.ErrorResponse
+//	@Router			/admin/dlq [get]
+func (h *AdminHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	limit := defaultDeadLetterLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxDeadLetterLimit {
+			h.handleError(w, "Invalid limit: must be between 1 and "+strconv.Itoa(maxDeadLetterLimit), err, traceID, http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	letters, err := h.deadLetters.List(r.Context(), limit)
+	if err != nil {
+		h.handleError(w, "Failed to read dead-letter topic", err, traceID, http.StatusBadGateway)
+		return
+	}
+
+	resp := dto.DeadLetterListResponse{Entries: make([]*dto.DeadLetterResponse, 0, len(letters))}
+	for _, letter := range letters {
+		resp.Entries = append(resp.Entries, deadLetterResponse(letter))
+	}
+	h.respondJSON(w, http.StatusOK, resp)
+}
+
+// DeadLetter returns a single message of the dead-letter topic.
+//
+//	@Summary		Inspect a dead-lettered message
+//	@Tags			admin
+//	@Produce		json
+//	@Param			partition	path		int	true	"Partition"
+//	@Param			offset		path		int	true	"Offset"
+//	@Success		200			{object}	dto.DeadLetterResponse
+//	@Failure		401			{object}	dto.ErrorResponse
+//	@Failure		404			{object}	dto.ErrorResponse
+//	@Failure		502			{object}	dto.ErrorResponse
+//	@Router			/admin/dlq/{partition}/{offset} [get]
+func (h *AdminHandler) DeadLetter(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	letter, ok := h.getDeadLetter(w, r, traceID)
+	if !ok {
+		return
+	}
+	h.respondJSON(w, http.StatusOK, deadLetterResponse(letter))
+}
+
+// ReplayDeadLetter queues the task of a dead-lettered message again.
+//
+//	@Summary		Replay a dead-lettered message
+//	@Description	Reset the task of the message to pending and publish it to the topic of its priority again. Conversion parameters in the body replace those of the task. task_id is only needed when the message cannot be decoded. The message itself stays on the dead-letter topic.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			partition	path		int					true	"Partition"
+//	@Param			offset		path		int					true	"Offset"
+//	@Param			request		body		dto.ReplayRequest	false	"Parameter overrides"
+//	@Success		202			{object}	dto.TaskResponse
+//	@Failure		400			{object}	dto.ErrorResponse
+//	@Failure		401			{object}	dto.ErrorResponse
+//	@Failure		404			{object}	dto.ErrorResponse
+//	@Failure		409			{object}	dto.ErrorResponse
+//	@Failure		502			{object}	dto.ErrorResponse
+//	@Router			/admin/dlq/{partition}/{offset}/replay [post]
+func (h *AdminHandler) ReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	var req dto.ReplayRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.handleError(w, "Invalid request body", err, traceID, http.StatusBadRequest)
+			return
+		}
+	}
+	if (req.TargetWidth != nil && *req.TargetWidth <= 0) || (req.TargetHeight != nil && *req.TargetHeight <= 0) {
+		h.handleError(w, "Invalid target size: must be positive", nil, traceID, http.StatusBadRequest)
+		return
+	}
+
+	letter, ok := h.getDeadLetter(w, r, traceID)
+	if !ok {
+		return
+	}
+
+	taskID := req.TaskID
+	var msg kafka.TaskMessage
+	if err := json.Unmarshal(letter.Value, &msg); err == nil && msg.TaskID != "" {
+		taskID = msg.TaskID
+	}
+	if _, err := uuid.Parse(taskID); err != nil {
+		h.handleError(w, "Message has no task ID: set task_id", err, traceID, http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.service.ReplayTask(r.Context(), taskID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, dto.ErrTaskNotFound):
+			h.handleError(w, "Task not found", err, traceID, http.StatusNotFound)
+		case errors.Is(err, dto.ErrNotReplayable):
+			h.handleError(w, "Task is neither pending nor failed", err, traceID, http.StatusConflict)
+		default:
+			h.handleError(w, "Failed to replay task", err, traceID, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.logger.Info("Dead letter replayed",
+		zap.String("trace_id", traceID),
+		zap.String("task_id", taskID),
+		zap.Int32("partition", letter.Partition),
+		zap.Int64("offset", letter.Offset),
+	)
+
+	h.respondJSON(w, http.StatusAccepted, resp)
+}
+
+// getDeadLetter reads the message addressed by the request path, writing an
+// error response if there is none.
+func (h *AdminHandler) getDeadLetter(w http.ResponseWriter, r *http.Request, traceID string) (*kafka.DeadLetter, bool) {
+	partition, err := strconv.ParseInt(r.PathValue("partition"), 10, 32)
+	if err != nil || partition < 0 {
+		h.handleError(w, "Dead letter not found", err, traceID, http.StatusNotFound)
+		return nil, false
+	}
+	offset, err := strconv.ParseInt(r.PathValue("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		h.handleError(w, "Dead letter not found", err, traceID, http.StatusNotFound)
+		return nil, false
+	}
+
+	letter, err := h.deadLetters.Get(r.Context(), int32(partition), offset)
+	if err != nil {
+		if errors.Is(err, kafka.ErrDeadLetterNotFound) {
+			h.handleError(w, "Dead letter not found", err, traceID, http.StatusNotFound)
+		} else {
+			h.handleError(w, "Failed to read dead-letter topic", err, traceID, http.StatusBadGateway)
+		}
+		return nil, false
+	}
+	return letter, true
+}
+
+func deadLetterResponse(letter *kafka.DeadLetter) *dto.DeadLetterResponse {
+	resp := &dto.DeadLetterResponse{
+		ID:            strconv.Itoa(int(letter.Partition)) + "/" + strconv.FormatInt(letter.Offset, 10),
+		Partition:     letter.Partition,
+		Offset:        letter.Offset,
+		Timestamp:     letter.Timestamp.UTC().Format(time.RFC3339),
+		Reason:        letter.Headers[workerkafka.HeaderReason],
+		Error:         letter.Headers[workerkafka.HeaderError],
+		OriginalTopic: letter.Headers[workerkafka.HeaderOriginalTopic],
+		Headers:       letter.Headers,
+	}
+	resp.Attempts, _ = strconv.Atoi(letter.Headers[workerkafka.HeaderAttempt])
+
+	var msg kafka.TaskMessage
+	if json.Valid(letter.Value) {
+		resp.Payload = letter.Value
+		if json.Unmarshal(letter.Value, &msg) == nil {
+			resp.TaskID = msg.TaskID
+		}
+	} else {
+		resp.RawPayload = letter.Value
+	}
+	return resp
+}
+
+func (h *AdminHandler) handleError(w http.ResponseWriter, message string, err error, traceID string, status int) {
+	h.logger.Error(message,
+		zap.String("trace_id", traceID),
+		zap.Error(err),
+	)
+
+	h.respondJSON(w, status, dto.ErrorResponse{
+		Error:   message,
+		TraceID: traceID,
+	})
+}
+
+func (h *AdminHandler) respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
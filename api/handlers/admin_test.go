@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/kafka"
+	"mediaConverter/api/middleware"
+	workerkafka "mediaConverter/worker/kafka"
+)
+
+const testTaskID = "7f9c2a4e-1b3d-4c5e-8f6a-0b1c2d3e4f5a"
+
+type fakeDeadLetters struct {
+	letters []*kafka.DeadLetter
+}
+
+func (f *fakeDeadLetters) List(ctx context.Context, limit int) ([]*kafka.DeadLetter, error) {
+	if len(f.letters) > limit {
+		return f.letters[:limit], nil
+	}
+	return f.letters, nil
+}
+
+func (f *fakeDeadLetters) Get(ctx context.Context, partition int32, offset int64) (*kafka.DeadLetter, error) {
+	for _, letter := range f.letters {
+		if letter.Partition == partition && letter.Offset == offset {
+			return letter, nil
+		}
+	}
+	return nil, kafka.ErrDeadLetterNotFound
+}
+
+func (f *fakeDeadLetters) Close() error { return nil }
+
+type mockReplayService struct {
+	replayFunc func(ctx context.Context, taskID string, req *dto.ReplayRequest) (*dto.TaskResponse, error)
+}
+
+func (m *mockReplayService) ReplayTask(ctx context.Context, taskID string, req *dto.ReplayRequest) (*dto.TaskResponse, error) {
+	return m.replayFunc(ctx, taskID, req)
+}
+
+func newTestDeadLetters() *fakeDeadLetters {
+	return &fakeDeadLetters{letters: []*kafka.DeadLetter{
+		{
+			Partition: 0,
+			Offset:    4,
+			Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+			Value:     []byte(`{"task_id":"` + testTaskID + `","output_format":"webp"}`),
+			Headers: map[string]string{
+				workerkafka.HeaderReason:        workerkafka.ReasonRetriesExhausted,
+				workerkafka.HeaderAttempt:       "3",
+				workerkafka.HeaderError:         "storage unavailable",
+				workerkafka.HeaderOriginalTopic: "media_tasks",
+			},
+		},
+		{
+			Partition: 1,
+			Offset:    0,
+			Timestamp: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			Value:     []byte("\x00not json"),
+			Headers: map[string]string{
+				workerkafka.HeaderReason: workerkafka.ReasonUndecodable,
+			},
+		},
+	}}
+}
+
+func TestAdminHandler_ListDeadLetters(t *testing.T) {
+	handler := NewAdminHandler(newTestDeadLetters(), &mockReplayService{}, zaptest.NewLogger(t))
+
+	req := httptest.NewRequest("GET", "/admin/dlq?limit=10", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ListDeadLetters(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp dto.DeadLetterListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(resp.Entries))
+	}
+
+	first := resp.Entries[0]
+	if first.ID != "0/4" || first.TaskID != testTaskID || first.Reason != workerkafka.ReasonRetriesExhausted || first.Attempts != 3 {
+		t.Errorf("Unexpected entry %+v", first)
+	}
+	if first.Payload == nil || first.RawPayload != nil {
+		t.Errorf("Expected a JSON payload, got %+v", first)
+	}
+
+	second := resp.Entries[1]
+	if second.Payload != nil || string(second.RawPayload) != "\x00not json" {
+		t.Errorf("Expected the raw payload of an undecodable message, got %+v", second)
+	}
+}
+
+func TestAdminHandler_ListDeadLetters_InvalidLimit(t *testing.T) {
+	handler := NewAdminHandler(newTestDeadLetters(), &mockReplayService{}, zaptest.NewLogger(t))
+
+	for _, limit := range []string{"0", "-1", "abc", "100000"} {
+		req := httptest.NewRequest("GET", "/admin/dlq?limit="+limit, nil)
+		rec := httptest.NewRecorder()
+
+		handler.ListDeadLetters(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("limit=%s: expected status 400, got %d", limit, rec.Code)
+		}
+	}
+}
+
+func TestAdminHandler_DeadLetter_NotFound(t *testing.T) {
+	handler := NewAdminHandler(newTestDeadLetters(), &mockReplayService{}, zaptest.NewLogger(t))
+
+	for _, path := range [][2]string{{"0", "5"}, {"2", "0"}, {"x", "0"}, {"0", "-1"}} {
+		req := httptest.NewRequest("GET", "/admin/dlq/"+path[0]+"/"+path[1], nil)
+		req.SetPathValue("partition", path[0])
+		req.SetPathValue("offset", path[1])
+		rec := httptest.NewRecorder()
+
+		handler.DeadLetter(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%v: expected status 404, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestAdminHandler_ReplayDeadLetter(t *testing.T) {
+	tests := []struct {
+		name       string
+		partition  string
+		offset     string
+		body       string
+		replayErr  error
+		wantStatus int
+		wantTaskID string
+	}{
+		{
+			name:       "decoded payload with overrides",
+			partition:  "0",
+			offset:     "4",
+			body:       `{"output_format": "png", "target_width": 320}`,
+			wantStatus: http.StatusAccepted,
+			wantTaskID: testTaskID,
+		},
+		{
+			name:       "undecodable payload with task_id",
+			partition:  "1",
+			offset:     "0",
+			body:       `{"task_id": "` + testTaskID + `"}`,
+			wantStatus: http.StatusAccepted,
+			wantTaskID: testTaskID,
+		},
+		{
+			name:       "undecodable payload without task_id",
+			partition:  "1",
+			offset:     "0",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid size",
+			partition:  "0",
+			offset:     "4",
+			body:       `{"target_height": 0}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "task already completed",
+			partition:  "0",
+			offset:     "4",
+			replayErr:  dto.ErrNotReplayable,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "task deleted",
+			partition:  "0",
+			offset:     "4",
+			replayErr:  dto.ErrTaskNotFound,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var replayed string
+			var overrides *dto.ReplayRequest
+			service := &mockReplayService{
+				replayFunc: func(ctx context.Context, taskID string, req *dto.ReplayRequest) (*dto.TaskResponse, error) {
+					if tt.replayErr != nil {
+						return nil, tt.replayErr
+					}
+					replayed, overrides = taskID, req
+					return &dto.TaskResponse{ID: taskID, Status: "pending"}, nil
+				},
+			}
+			handler := NewAdminHandler(newTestDeadLetters(), service, zaptest.NewLogger(t))
+
+			req := httptest.NewRequest("POST", "/admin/dlq/"+tt.partition+"/"+tt.offset+"/replay", strings.NewReader(tt.body))
+			req.SetPathValue("partition", tt.partition)
+			req.SetPathValue("offset", tt.offset)
+			rec := httptest.NewRecorder()
+
+			handler.ReplayDeadLetter(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if replayed != tt.wantTaskID {
+				t.Errorf("Expected task %q to be replayed, got %q", tt.wantTaskID, replayed)
+			}
+			if tt.name == "decoded payload with overrides" {
+				if overrides.OutputFormat == nil || *overrides.OutputFormat != "png" || overrides.TargetWidth == nil || *overrides.TargetWidth != 320 {
+					t.Errorf("Unexpected overrides %+v", overrides)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	handler := NewAdminHandler(newTestDeadLetters(), &mockReplayService{}, zaptest.NewLogger(t))
+	protected := middleware.AdminToken("secret")(http.HandlerFunc(handler.ListDeadLetters))
+
+	for header, want := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"secret":        http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		req := httptest.NewRequest("GET", "/admin/dlq", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+
+		protected.ServeHTTP(rec, req)
+
+		if rec.Code != want {
+			t.Errorf("Authorization %q: expected status %d, got %d", header, want, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"mediaConverter/api/archive"
+	"mediaConverter/api/dto"
+	"mediaConverter/api/validation"
+)
+
+// saveArchive expands an uploaded ZIP or tar.gz and stores each supported
+// entry like a separately uploaded file, at most maxFiles of them. Entries
+// that are not supported images or documents are reported as skipped rather
+// than failing the whole archive; unsafe paths, nested archives and
+// decompression bombs reject it.
+func (h *TaskHandler) saveArchive(ctx context.Context, content io.Reader, maxFiles int) ([]*storedFile, []dto.SkippedFile, error) {
+	// ZIP keeps its directory at the end, so archives are spooled to disk
+	// before they are read.
+	tmp, err := os.CreateTemp("", "archive-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	body := &uploadReader{r: content, remaining: h.limits.MaxArchiveSize}
+	size, err := io.Copy(tmp, body)
+	switch {
+	case errors.Is(err, validation.ErrFileTooLarge):
+		return nil, nil, &requestError{"Archive is too large", http.StatusBadRequest, err}
+	case body.err != nil:
+		return nil, nil, &requestError{"Failed to read archive", http.StatusBadRequest, body.err}
+	case err != nil:
+		return nil, nil, err
+	}
+
+	var stored []*storedFile
+	var skipped []dto.SkippedFile
+	limits := archive.Limits{MaxEntries: h.limits.MaxArchiveEntries, MaxSize: h.limits.MaxArchiveExpandedSize}
+
+	err = archive.Walk(tmp, size, limits, func(entry archive.Entry, content io.Reader) error {
+		name := path.Base(entry.Name)
+		if strings.HasPrefix(name, ".") || strings.HasPrefix(entry.Name, "__MACOSX/") {
+			return nil
+		}
+
+		if len(stored) >= maxFiles {
+			return &requestError{"Too many files", http.StatusBadRequest, nil}
+		}
+
+		file, err := h.saveFile(ctx, name, content)
+		var reqErr *requestError
+		if errors.As(err, &reqErr) && reqErr.status == http.StatusBadRequest && !errors.Is(err, validation.ErrArchiveBomb) {
+			skipped = append(skipped, dto.SkippedFile{Name: entry.Name, Reason: reqErr.Error()})
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		stored = append(stored, file)
+		return nil
+	})
+	if err != nil {
+		h.releaseFiles(ctx, stored...)
+		if isArchiveError(err) {
+			return nil, nil, &requestError{"Invalid archive", http.StatusBadRequest, err}
+		}
+		return nil, nil, err
+	}
+
+	if len(skipped) > 0 {
+		h.logger.Info("Skipped archive entries", zap.Int("skipped", len(skipped)), zap.Int("stored", len(stored)))
+	}
+
+	return stored, skipped, nil
+}
+
+func isArchiveError(err error) bool {
+	for _, target := range []error{archive.ErrInvalid, archive.ErrTooManyEntries, archive.ErrUnsafePath, archive.ErrNested, validation.ErrArchiveBomb} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// isArchiveName reports whether a filename has an archive extension accepted
+// by saveArchive.
+func isArchiveName(filename string) bool {
+	lower := strings.ToLower(filename)
+	return strings.HasSuffix(lower, ".zip") || strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz")
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"mediaConverter/api/dto"
+)
+
+func tarGzOf(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(content)
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func newUploadRequest(t *testing.T, files map[string][]byte, fields map[string]string) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, content := range files {
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write(content)
+	}
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestTaskHandler_Upload_Archive(t *testing.T) {
+	var created []*dto.CreateTaskRequest
+	mockService := &mockTaskService{
+		createJobFunc: func(ctx context.Context, traceID string, reqs []*dto.CreateTaskRequest) (*dto.JobResponse, error) {
+			created = reqs
+			return &dto.JobResponse{ID: uuid.New().String(), Total: len(reqs)}, nil
+		},
+	}
+	handler := newTestTaskHandler(t, mockService, nil)
+
+	archive := tarGzOf(t, map[string][]byte{
+		"scans/a.jpg":   testJPEG,
+		"scans/b.png":   testPNG,
+		"scans/.hidden": testJPEG,
+		"notes.txt":     []byte("notes"),
+	})
+	req := newUploadRequest(t, map[string][]byte{"scans.tar.gz": archive}, map[string]string{"output_format": "png", "crop": "true"})
+	rec := httptest.NewRecorder()
+
+	handler.Upload(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp dto.JobResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 2 || len(resp.Skipped) != 1 || resp.Skipped[0].Name != "notes.txt" {
+		t.Errorf("Unexpected job %+v", resp)
+	}
+
+	var names []string
+	for _, req := range created {
+		names = append(names, req.OriginalFilename)
+		if req.OutputFormat != "png" || !req.Crop {
+			t.Errorf("Expected the upload parameters on every task, got %+v", req)
+		}
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "a.jpg,b.png" {
+		t.Errorf("Unexpected tasks %v", names)
+	}
+}
+
+func TestTaskHandler_Upload_ArchiveRejected(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string][]byte
+	}{
+		{"zip slip", map[string][]byte{"batch.zip": zipOf(t, map[string][]byte{"../../a.jpg": testJPEG})}},
+		{"nested archive", map[string][]byte{"batch.tgz": tarGzOf(t, map[string][]byte{"a.jpg": testJPEG, "more.zip": zipOf(t, nil)})}},
+		{"zip bomb", map[string][]byte{"batch.zip": zipOf(t, map[string][]byte{"a.jpg": append(testJPEG, make([]byte, 4*testMaxFileSize)...)})}},
+		{"not an archive", map[string][]byte{"batch.zip": testJPEG}},
+		{"nothing supported", map[string][]byte{"batch.zip": zipOf(t, map[string][]byte{"notes.txt": []byte("x")})}},
+		{"archive and file", map[string][]byte{"batch.zip": zipOf(t, map[string][]byte{"a.jpg": testJPEG}), "b.jpg": testJPEG}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := newTestStorage(t)
+			handler := newTestTaskHandler(t, &mockTaskService{}, files)
+			rec := httptest.NewRecorder()
+
+			handler.Upload(rec, newUploadRequest(t, tt.files, nil))
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if stored, _ := files.List(context.Background(), "blobs/"); len(stored) != 0 {
+				t.Errorf("Expected rejected upload to leave nothing behind, found %+v", stored)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/middleware"
+	"mediaConverter/api/models"
+	"mediaConverter/api/validation"
+)
+
+// Compare handles visual comparison requests.
+//
+//	@Summary		Compare two images
+//	@Description	Upload a reference and a candidate image. The worker computes PSNR and SSIM and renders a pixel-diff heatmap (PNG), available as the task output.
+//	@Tags			tasks
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			reference	formData	file	true	"Reference image"
+//	@Param			candidate	formData	file	true	"Candidate image"
+//	@Param			normalize	formData	bool	false	"Resize the candidate to the reference size first (true/false)"
+//	@Success		201			{object}	dto.TaskResponse
+//	@Failure		400			{object}	dto.ErrorResponse
+//	@Failure		500			{object}	dto.ErrorResponse
+//	@Router			/compare [post]
+func (h *TaskHandler) Compare(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	form, err := h.readForm(r, 2, "reference", "candidate")
+	if err != nil {
+		h.handleRequestError(w, err, traceID)
+		return
+	}
+
+	reference, candidate := form.File("reference"), form.File("candidate")
+	if reference == nil || candidate == nil {
+		h.releaseFiles(r.Context(), form.all()...)
+		h.handleError(w, "Failed to get file", http.ErrMissingFile, traceID, http.StatusBadRequest)
+		return
+	}
+
+	if !validation.IsAllowedImageType(reference.Type) || !validation.IsAllowedImageType(candidate.Type) {
+		h.releaseFiles(r.Context(), reference, candidate)
+		h.handleError(w, "Only images can be compared", validation.ErrUnsupportedFormat, traceID, http.StatusBadRequest)
+		return
+	}
+
+	options, err := json.Marshal(dto.CompareOptions{
+		CandidatePath:     candidate.Key,
+		CandidateFilename: candidate.Filename,
+		Normalize:         form.Values.Get("normalize") == "true",
+	})
+	if err != nil {
+		h.releaseFiles(r.Context(), reference, candidate)
+		h.handleError(w, "Failed to create task", err, traceID, http.StatusInternalServerError)
+		return
+	}
+
+	req := &dto.CreateTaskRequest{
+		Type:             string(models.TaskTypeCompare),
+		OriginalFilename: reference.Filename,
+		FilePath:         reference.Key,
+		OutputFormat:     "png",
+		Options:          options,
+	}
+
+	resp, err := h.service.CreateTask(r.Context(), traceID, req)
+	if err != nil {
+		h.releaseFiles(r.Context(), reference, candidate)
+		h.handleError(w, "Failed to create task", err, traceID, http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("Comparison requested",
+		zap.String("trace_id", traceID),
+		zap.String("task_id", resp.ID),
+		zap.String("reference", reference.Filename),
+		zap.String("candidate", candidate.Filename),
+	)
+
+	h.respondJSON(w, http.StatusCreated, resp)
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/middleware"
+	"mediaConverter/api/models"
+	"mediaConverter/api/validation"
+)
+
+const maxContactSheetSources = 200
+
+// ContactSheet handles contact sheet composition requests.
+//
+//	@Summary		Compose a contact sheet
+//	@Description	Compose uploaded images and/or the sources of existing tasks into a single grid image.
+//	@Tags			tasks
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			files			formData	file	false	"Images to place on the sheet (repeatable)"
+//	@Param			task_ids		formData	string	false	"IDs of tasks whose sources to place on the sheet (repeatable or comma-separated)"
+//	@Param			columns			formData	int		false	"Number of columns (1-20, default 4)"
+//	@Param			cell_width		formData	int		false	"Cell width in pixels (16-1024, default 256)"
+//	@Param			cell_height		formData	int		false	"Cell height in pixels (16-1024, default 256)"
+//	@Param			gutter			formData	int		false	"Space between cells in pixels (0-100, default 8)"
+//	@Param			background		formData	string	false	"Background color as #RRGGBB (default #ffffff)"
+//	@Param			captions		formData	bool	false	"Draw filenames under the cells (true/false)"
+//	@Param			fit				formData	string	false	"How images fill their cell (contain, cover, stretch; default contain)"
+//	@Param			output_format	formData	string	false	"Output format (jpg, png; default jpg)"
+//	@Success		201				{object}	dto.TaskResponse
+//	@Failure		400				{object}	dto.ErrorResponse
+//	@Failure		404				{object}	dto.ErrorResponse
+//	@Failure		500				{object}	dto.ErrorResponse
+//	@Router			/contact-sheet [post]
+func (h *TaskHandler) ContactSheet(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	form, err := h.readForm(r, maxContactSheetSources, "files")
+	if err != nil {
+		h.handleRequestError(w, err, traceID)
+		return
+	}
+	uploads := form.Files["files"]
+
+	opts, outputFormat, err := parseContactSheetOptions(form.Values)
+	if err != nil {
+		h.releaseFiles(r.Context(), uploads...)
+		h.handleRequestError(w, err, traceID)
+		return
+	}
+
+	var taskIDs []string
+	for _, value := range form.Values["task_ids"] {
+		for _, id := range strings.Split(value, ",") {
+			id = strings.TrimSpace(id)
+			if id == "" {
+				continue
+			}
+			if _, err := uuid.Parse(id); err != nil {
+				h.releaseFiles(r.Context(), uploads...)
+				h.handleError(w, "Invalid task ID "+id, err, traceID, http.StatusBadRequest)
+				return
+			}
+			taskIDs = append(taskIDs, id)
+		}
+	}
+
+	if len(uploads)+len(taskIDs) == 0 {
+		h.handleError(w, "At least one file or task ID is required", nil, traceID, http.StatusBadRequest)
+		return
+	}
+	if len(uploads)+len(taskIDs) > maxContactSheetSources {
+		h.releaseFiles(r.Context(), uploads...)
+		h.handleError(w, fmt.Sprintf("At most %d images fit on a contact sheet", maxContactSheetSources), nil, traceID, http.StatusBadRequest)
+		return
+	}
+
+	for _, stored := range uploads {
+		if !validation.IsAllowedImageType(stored.Type) {
+			h.releaseFiles(r.Context(), uploads...)
+			h.handleError(w, "Only images can be placed on a contact sheet", validation.ErrUnsupportedFormat, traceID, http.StatusBadRequest)
+			return
+		}
+	}
+
+	sources, err := h.service.GetSourceFiles(r.Context(), taskIDs)
+	if err != nil {
+		h.releaseFiles(r.Context(), uploads...)
+		if errors.Is(err, dto.ErrTaskNotFound) {
+			h.handleError(w, "Task not found", err, traceID, http.StatusNotFound)
+			return
+		}
+		h.handleError(w, "Failed to resolve tasks", err, traceID, http.StatusInternalServerError)
+		return
+	}
+
+	for _, stored := range uploads {
+		sources = append(sources, dto.SourceFile{Path: stored.Key, Filename: stored.Filename})
+	}
+	opts.Sources = sources
+
+	options, err := json.Marshal(opts)
+	if err != nil {
+		h.releaseFiles(r.Context(), uploads...)
+		h.handleError(w, "Failed to create task", err, traceID, http.StatusInternalServerError)
+		return
+	}
+
+	req := &dto.CreateTaskRequest{
+		Type:             string(models.TaskTypeContactSheet),
+		OriginalFilename: "contact_sheet." + outputFormat,
+		OutputFormat:     outputFormat,
+		Options:          options,
+	}
+
+	resp, err := h.service.CreateTask(r.Context(), traceID, req)
+	if err != nil {
+		h.releaseFiles(r.Context(), uploads...)
+		h.handleError(w, "Failed to create task", err, traceID, http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("Contact sheet requested",
+		zap.String("trace_id", traceID),
+		zap.String("task_id", resp.ID),
+		zap.Int("images", len(sources)),
+	)
+
+	h.respondJSON(w, http.StatusCreated, resp)
+}
+
+func parseContactSheetOptions(values url.Values) (*dto.ContactSheetOptions, string, error) {
+	opts := &dto.ContactSheetOptions{
+		Background: "#ffffff",
+		Fit:        "contain",
+		Captions:   values.Get("captions") == "true",
+	}
+
+	var err error
+	if opts.Columns, err = formInt(values, "columns", 4, 1, 20); err != nil {
+		return nil, "", err
+	}
+	if opts.CellWidth, err = formInt(values, "cell_width", 256, 16, 1024); err != nil {
+		return nil, "", err
+	}
+	if opts.CellHeight, err = formInt(values, "cell_height", 256, 16, 1024); err != nil {
+		return nil, "", err
+	}
+	if opts.Gutter, err = formInt(values, "gutter", 8, 0, 100); err != nil {
+		return nil, "", err
+	}
+
+	if background := values.Get("background"); background != "" {
+		if !isHexColor(background) {
+			return nil, "", &requestError{"Invalid background: expected #RRGGBB", http.StatusBadRequest, nil}
+		}
+		opts.Background = background
+	}
+
+	if fit := values.Get("fit"); fit != "" {
+		switch fit {
+		case "contain", "cover", "stretch":
+			opts.Fit = fit
+		default:
+			return nil, "", &requestError{"Invalid fit: expected contain, cover or stretch", http.StatusBadRequest, nil}
+		}
+	}
+
+	outputFormat := "jpg"
+	if format := values.Get("output_format"); format != "" {
+		if format != "jpg" && format != "png" {
+			return nil, "", &requestError{"Invalid output_format: expected jpg or png", http.StatusBadRequest, nil}
+		}
+		outputFormat = format
+	}
+
+	return opts, outputFormat, nil
+}
+
+func isHexColor(s string) bool {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return false
+	}
+	for _, c := range hex {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
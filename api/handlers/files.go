@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/middleware"
+	"mediaConverter/worker/storage"
+)
+
+// FileHandler serves stored objects. Presigned /files URLs are only issued by
+// the local backend; S3 clients talk to the bucket directly. Bodies written
+// through them are limited to maxFileSize.
+type FileHandler struct {
+	files       storage.Backend
+	maxFileSize int64
+	logger      *zap.Logger
+}
+
+func NewFileHandler(files storage.Backend, maxFileSize int64, logger *zap.Logger) *FileHandler {
+	return &FileHandler{
+		files:       files,
+		maxFileSize: maxFileSize,
+		logger:      logger,
+	}
+}
+
+// Download serves a task result as an attachment.
+//
+//	@Summary		Download a result
+//	@Tags			files
+//	@Produce		octet-stream
+//	@Param			filename	path	string	true	"Result file name"
+//	@Success		200
+//	@Failure		400	{object}	dto.ErrorResponse
+//	@Failure		404	{object}	dto.ErrorResponse
+//	@Router			/download/{filename} [get]
+func (h *FileHandler) Download(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	filename := r.PathValue("filename")
+	if filename == "" {
+		h.handleError(w, "Filename is required", nil, traceID, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+path.Base(filename)+"\"")
+	h.serve(w, r, filename, traceID)
+}
+
+// Presigned serves GET and PUT requests on URLs presigned by the local
+// backend.
+//
+//	@Summary		Read or write an object through a presigned URL
+//	@Tags			files
+//	@Param			key			path	string	true	"Object key"
+//	@Param			expires		query	int		true	"Expiry as a Unix timestamp"
+//	@Param			signature	query	string	true	"URL signature"
+//	@Success		200
+//	@Success		201
+//	@Failure		403	{object}	dto.ErrorResponse
+//	@Failure		404	{object}	dto.ErrorResponse
+//	@Failure		413	{object}	dto.ErrorResponse
+//	@Router			/files/{key} [get]
+//	@Router			/files/{key} [put]
+func (h *FileHandler) Presigned(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	local, ok := h.files.(*storage.Local)
+	if !ok {
+		h.handleError(w, "Presigned URLs are served by the storage backend", nil, traceID, http.StatusNotFound)
+		return
+	}
+
+	key := r.PathValue("key")
+	if err := local.VerifyPresigned(r.Method, key, r.URL.Query()); err != nil {
+		h.handleError(w, "Invalid or expired signature", err, traceID, http.StatusForbidden)
+		return
+	}
+
+	if r.Method != http.MethodPut {
+		h.serve(w, r, key, traceID)
+		return
+	}
+
+	// Presigned uploads are only checked when committed, so an oversized
+	// body is refused here rather than left on disk until then.
+	if r.ContentLength > h.maxFileSize {
+		h.handleError(w, "File too large", nil, traceID, http.StatusRequestEntityTooLarge)
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, h.maxFileSize)
+
+	if err := local.Put(r.Context(), key, body, r.ContentLength); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.handleError(w, "File too large", err, traceID, http.StatusRequestEntityTooLarge)
+			return
+		}
+		if errors.Is(err, storage.ErrInvalidKey) {
+			h.handleError(w, "Invalid object key", err, traceID, http.StatusBadRequest)
+			return
+		}
+		h.handleError(w, "Failed to store file", err, traceID, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *FileHandler) serve(w http.ResponseWriter, r *http.Request, key, traceID string) {
+	if err := writeObject(w, r, h.files, key); err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			h.handleError(w, "File not found", err, traceID, http.StatusNotFound)
+			return
+		}
+		h.handleError(w, "Failed to read file", err, traceID, http.StatusInternalServerError)
+	}
+}
+
+// writeObject copies an object to w. Errors are only returned before anything
+// has been written.
+func writeObject(w http.ResponseWriter, r *http.Request, files storage.Backend, key string) error {
+	body, info, err := files.Get(r.Context(), key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", storage.ContentType(key))
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	io.Copy(w, body)
+	return nil
+}
+
+func (h *FileHandler) handleError(w http.ResponseWriter, message string, err error, traceID string, status int) {
+	h.logger.Error(message,
+		zap.String("trace_id", traceID),
+		zap.Error(err),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(dto.ErrorResponse{
+		Error:   message,
+		TraceID: traceID,
+	})
+}
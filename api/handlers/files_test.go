@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestFileHandler_Download(t *testing.T) {
+	files := newTestStorage(t)
+	if err := files.Put(context.Background(), "result.png", strings.NewReader("png"), 3); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewFileHandler(files, testMaxFileSize, zaptest.NewLogger(t))
+
+	req := httptest.NewRequest("GET", "/download/result.png", nil)
+	req.SetPathValue("filename", "result.png")
+	rec := httptest.NewRecorder()
+
+	handler.Download(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "png" {
+		t.Fatalf("Expected the stored file, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Expected Content-Type image/png, got %s", rec.Header().Get("Content-Type"))
+	}
+
+	req = httptest.NewRequest("GET", "/download/missing.png", nil)
+	req.SetPathValue("filename", "missing.png")
+	rec = httptest.NewRecorder()
+
+	handler.Download(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestFileHandler_Presigned(t *testing.T) {
+	files := newTestStorage(t)
+	handler := NewFileHandler(files, testMaxFileSize, zaptest.NewLogger(t))
+
+	presignedRequest := func(method, rawURL string, body io.Reader) *http.Request {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(method, u.RequestURI(), body)
+		req.SetPathValue("key", strings.TrimPrefix(u.Path, "/files/"))
+		return req
+	}
+
+	putURL, err := files.Presign(context.Background(), http.MethodPut, "uploads/a.jpg", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.Presigned(rec, presignedRequest("PUT", putURL, strings.NewReader("jpeg")))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.Presigned(rec, presignedRequest("GET", putURL, nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a PUT URL not to allow GET, got %d", rec.Code)
+	}
+
+	getURL, err := files.Presign(context.Background(), http.MethodGet, "uploads/a.jpg", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.Presigned(rec, presignedRequest("GET", getURL, nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "jpeg" {
+		t.Errorf("Expected the uploaded file, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.Presigned(rec, presignedRequest("GET", strings.Replace(getURL, "a.jpg", "b.jpg", 1), nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a tampered URL to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestFileHandler_PresignedTooLarge(t *testing.T) {
+	files := newTestStorage(t)
+	handler := NewFileHandler(files, 8, zaptest.NewLogger(t))
+
+	putURL, err := files.Presign(context.Background(), http.MethodPut, "uploads/a.jpg", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(putURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		length int64
+	}{
+		{"declared length", 16},
+		// Without a Content-Length the limit applies while reading.
+		{"streamed", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", u.RequestURI(), strings.NewReader("too large a body"))
+			req.SetPathValue("key", "uploads/a.jpg")
+			req.ContentLength = tt.length
+			rec := httptest.NewRecorder()
+
+			handler.Presigned(rec, req)
+
+			if rec.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("Expected status 413, got %d", rec.Code)
+			}
+			if _, err := files.Stat(context.Background(), "uploads/a.jpg"); err == nil {
+				t.Error("Expected nothing to be stored")
+			}
+		})
+	}
+}
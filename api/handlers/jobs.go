@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/middleware"
+	"mediaConverter/api/models"
+	"mediaConverter/worker/storage"
+)
+
+const (
+	maxJobFiles  = 10000
+	maxDimension = 65535
+)
+
+// CreateJob handles batch uploads.
+//
+//	@Summary		Upload a batch of files
+//	@Description	Upload many files, directly or as a ZIP or tar.gz archive, and create one task per file under a common job. Conversion parameters apply to every file. Archive entries that are not supported files are listed as skipped.
+//	@Tags			jobs
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			files				formData	file	false	"Files to process (repeatable)"
+//	@Param			archive				formData	file	false	"ZIP or tar.gz archive of files to process"
+//	@Param			output_format		formData	string	false	"Output format (jpg, png)"
+//	@Param			target_width		formData	int		false	"Target width in pixels"
+//	@Param			target_height		formData	int		false	"Target height in pixels"
+//	@Param			crop				formData	bool	false	"Crop to center (true/false)"
+//	@Param			duplicate_policy	formData	string	false	"Near-duplicate handling (allow, reject, reuse)"
+//	@Param			priority			formData	string	false	"Queue lane (interactive, normal, bulk; default bulk)"
+//	@Param			run_at				formData	string	false	"RFC 3339 time to queue the tasks at instead of now"
+//	@Success		201					{object}	dto.JobResponse
+//	@Failure		400					{object}	dto.ErrorResponse
+//	@Failure		500					{object}	dto.ErrorResponse
+//	@Router			/jobs [post]
+func (h *TaskHandler) CreateJob(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	form, err := h.streamForm(r, maxJobFiles, maxJobFiles, []string{"files"}, []string{"archive"})
+	if err != nil {
+		h.handleRequestError(w, err, traceID)
+		return
+	}
+	uploads := form.all()
+
+	params, err := conversionParams(form.Values)
+	if err != nil {
+		h.releaseFiles(r.Context(), uploads...)
+		h.handleRequestError(w, err, traceID)
+		return
+	}
+	resp, err := h.createJob(r.Context(), traceID, params, uploads, form.Skipped)
+	if err != nil {
+		h.handleRequestError(w, err, traceID)
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, resp)
+}
+
+// createJob creates a job with one task per upload, each converted with
+// params. skipped is reported back with the job. The job and its tasks are
+// created together; on failure there is neither, and the uploads are
+// released.
+func (h *TaskHandler) createJob(ctx context.Context, traceID string, params *dto.CreateTaskRequest, uploads []*storedFile, skipped []dto.SkippedFile) (*dto.JobResponse, error) {
+	if len(uploads) == 0 {
+		return nil, &requestError{"No supported files in the batch", http.StatusBadRequest, nil}
+	}
+
+	// Batches are bulk work unless the client asks otherwise.
+	if params.Priority == "" {
+		params.Priority = string(models.PriorityBulk)
+	}
+
+	reqs := make([]*dto.CreateTaskRequest, len(uploads))
+	for i, stored := range uploads {
+		req := *params
+		req.OriginalFilename = stored.Filename
+		req.FilePath = stored.Key
+		req.SourceHash = stored.Hash
+		reqs[i] = &req
+	}
+
+	resp, err := h.service.CreateJob(ctx, traceID, reqs)
+	if err != nil {
+		h.releaseFiles(ctx, uploads...)
+		return nil, &requestError{"Failed to create job", http.StatusInternalServerError, err}
+	}
+	resp.Skipped = skipped
+
+	h.logger.Info("Batch uploaded",
+		zap.String("trace_id", traceID),
+		zap.String("job_id", resp.ID),
+		zap.Int("tasks", len(uploads)),
+		zap.Int("skipped", len(skipped)),
+	)
+
+	return resp, nil
+}
+
+// Job returns the progress of a batch.
+//
+//	@Summary		Get job progress
+//	@Description	Count the tasks of a job per status. Once no task is pending or processing, download_url points to a ZIP of all outputs.
+//	@Tags			jobs
+//	@Produce		json
+//	@Param			id	path		string	true	"Job ID"
+//	@Success		200	{object}	dto.JobResponse
+//	@Failure		400	{object}	dto.ErrorResponse
+//	@Failure		404	{object}	dto.ErrorResponse
+//	@Failure		500	{object}	dto.ErrorResponse
+//	@Router			/jobs/{id} [get]
+func (h *TaskHandler) Job(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	jobID := r.PathValue("id")
+	if _, err := uuid.Parse(jobID); err != nil {
+		h.handleError(w, "Invalid job ID", err, traceID, http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.service.GetJob(r.Context(), jobID)
+	if err != nil {
+		h.handleJobError(w, err, traceID)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, resp)
+}
+
+// JobDownload streams the outputs of a finished batch as one ZIP.
+//
+//	@Summary		Download all outputs of a job
+//	@Description	Stream a ZIP with the output of every completed task of the job, named after the original files. Failed tasks are left out.
+//	@Tags			jobs
+//	@Produce		application/zip
+//	@Param			id	path	string	true	"Job ID"
+//	@Success		200
+//	@Failure		400	{object}	dto.ErrorResponse
+//	@Failure		404	{object}	dto.ErrorResponse
+//	@Failure		409	{object}	dto.ErrorResponse
+//	@Failure		500	{object}	dto.ErrorResponse
+//	@Router			/jobs/{id}/download [get]
+func (h *TaskHandler) JobDownload(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	jobID := r.PathValue("id")
+	if _, err := uuid.Parse(jobID); err != nil {
+		h.handleError(w, "Invalid job ID", err, traceID, http.StatusBadRequest)
+		return
+	}
+
+	outputs, err := h.service.GetJobOutputs(r.Context(), jobID)
+	if err != nil {
+		h.handleJobError(w, err, traceID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"job-%s.zip\"", jobID))
+
+	// Outputs are already compressed images, so entries are stored as is.
+	// Once streaming has started, errors can only end the archive early.
+	zw := zip.NewWriter(w)
+	names := make(map[string]int, len(outputs))
+	for _, output := range outputs {
+		if err := h.writeJobOutput(r, zw, output, names); err != nil {
+			h.logger.Error("Failed to write job output",
+				zap.String("trace_id", traceID),
+				zap.String("job_id", jobID),
+				zap.String("task_id", output.TaskID),
+				zap.Error(err),
+			)
+			if !errors.Is(err, storage.ErrNotFound) {
+				return
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		h.logger.Error("Failed to finish job archive", zap.String("trace_id", traceID), zap.Error(err))
+	}
+}
+
+func (h *TaskHandler) writeJobOutput(r *http.Request, zw *zip.Writer, output dto.JobOutput, names map[string]int) error {
+	obj, info, err := h.files.Get(r.Context(), output.OutputFilename)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     jobEntryName(output, names),
+		Method:   zip.Store,
+		Modified: info.ModTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, obj)
+	return err
+}
+
+// jobEntryName names an output after its original file, with the output
+// extension; repeated names get a numeric suffix.
+func jobEntryName(output dto.JobOutput, names map[string]int) string {
+	original := path.Base(output.OriginalFilename)
+	base := strings.TrimSuffix(original, path.Ext(original))
+	ext := path.Ext(output.OutputFilename)
+
+	name := base + ext
+	names[name]++
+	if n := names[name]; n > 1 {
+		name = fmt.Sprintf("%s_%d%s", base, n, ext)
+	}
+	return name
+}
+
+// conversionParams reads the /upload conversion parameters shared by every
+// task of a batch.
+func conversionParams(values url.Values) (*dto.CreateTaskRequest, error) {
+	req := &dto.CreateTaskRequest{
+		OutputFormat:    values.Get("output_format"),
+		Crop:            values.Get("crop") == "true",
+		DuplicatePolicy: values.Get("duplicate_policy"),
+		Priority:        values.Get("priority"),
+	}
+
+	if !validDuplicatePolicy(models.DuplicatePolicy(req.DuplicatePolicy)) {
+		return nil, &requestError{"Invalid duplicate_policy", http.StatusBadRequest, nil}
+	}
+	if !validPriority(models.Priority(req.Priority)) {
+		return nil, &requestError{"Invalid priority", http.StatusBadRequest, nil}
+	}
+
+	runAt, err := parseRunAt(values.Get("run_at"))
+	if err != nil {
+		return nil, &requestError{"Invalid run_at: must be an RFC 3339 time", http.StatusBadRequest, err}
+	}
+	req.RunAt = runAt
+
+	for field, dest := range map[string]**int{"target_width": &req.TargetWidth, "target_height": &req.TargetHeight} {
+		if values.Get(field) == "" {
+			continue
+		}
+		n, err := formInt(values, field, 0, 1, maxDimension)
+		if err != nil {
+			return nil, err
+		}
+		*dest = &n
+	}
+
+	return req, nil
+}
+
+func (h *TaskHandler) handleJobError(w http.ResponseWriter, err error, traceID string) {
+	switch {
+	case errors.Is(err, dto.ErrJobNotFound):
+		h.handleError(w, "Job not found", err, traceID, http.StatusNotFound)
+	case errors.Is(err, dto.ErrJobNotFinished):
+		h.handleError(w, "Job has unfinished tasks", err, traceID, http.StatusConflict)
+	default:
+		h.handleError(w, "Failed to get job", err, traceID, http.StatusInternalServerError)
+	}
+}
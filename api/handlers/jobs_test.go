@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/models"
+)
+
+var (
+	testJPEG = append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{0}, 60)...)
+	testPNG  = []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}
+)
+
+func zipOf(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newJobRequest(t *testing.T, files map[string][]byte, archive []byte, fields map[string]string) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, content := range files {
+		part, _ := writer.CreateFormFile("files", name)
+		part.Write(content)
+	}
+	if archive != nil {
+		part, _ := writer.CreateFormFile("archive", "batch.zip")
+		part.Write(archive)
+	}
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/jobs", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestTaskHandler_CreateJob(t *testing.T) {
+	var created []*dto.CreateTaskRequest
+	mockService := &mockTaskService{
+		createJobFunc: func(ctx context.Context, traceID string, reqs []*dto.CreateTaskRequest) (*dto.JobResponse, error) {
+			created = reqs
+			return &dto.JobResponse{ID: uuid.New().String(), Total: len(reqs), Counts: map[string]int{"pending": len(reqs)}}, nil
+		},
+	}
+	handler := newTestTaskHandler(t, mockService, nil)
+
+	archive := zipOf(t, map[string][]byte{
+		"photos/c.jpg":        testJPEG,
+		"photos/fake.jpg":     testPNG,
+		"README.txt":          []byte("hello"),
+		"__MACOSX/photos/._c": []byte("resource fork"),
+	})
+	req := newJobRequest(t, map[string][]byte{"a.jpg": testJPEG, "b.png": testPNG}, archive, map[string]string{"output_format": "png", "target_width": "320"})
+	rec := httptest.NewRecorder()
+
+	handler.CreateJob(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp dto.JobResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, req := range created {
+		names = append(names, req.OriginalFilename)
+		if req.OutputFormat != "png" || req.TargetWidth == nil || *req.TargetWidth != 320 || req.Priority != string(models.PriorityBulk) {
+			t.Errorf("Unexpected task request %+v", req)
+		}
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "a.jpg,b.png,c.jpg" {
+		t.Errorf("Unexpected tasks %v", names)
+	}
+
+	var skipped []string
+	for _, s := range resp.Skipped {
+		skipped = append(skipped, s.Name)
+	}
+	sort.Strings(skipped)
+	if strings.Join(skipped, ",") != "README.txt,photos/fake.jpg" {
+		t.Errorf("Unexpected skipped entries %+v", resp.Skipped)
+	}
+}
+
+func TestTaskHandler_CreateJob_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string][]byte
+		archive []byte
+		fields  map[string]string
+	}{
+		{"invalid width", map[string][]byte{"a.jpg": testJPEG}, nil, map[string]string{"target_width": "-5"}},
+		{"invalid policy", map[string][]byte{"a.jpg": testJPEG}, nil, map[string]string{"duplicate_policy": "merge"}},
+		{"invalid priority", map[string][]byte{"a.jpg": testJPEG}, nil, map[string]string{"priority": "urgent"}},
+		{"invalid run_at", map[string][]byte{"a.jpg": testJPEG}, nil, map[string]string{"run_at": "tomorrow"}},
+		{"corrupt archive", map[string][]byte{"a.jpg": testJPEG}, []byte("not a zip"), nil},
+		{"nothing supported", nil, zipOf(t, map[string][]byte{"notes.txt": []byte("x")}), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := newTestStorage(t)
+			handler := newTestTaskHandler(t, &mockTaskService{}, files)
+			rec := httptest.NewRecorder()
+
+			handler.CreateJob(rec, newJobRequest(t, tt.files, tt.archive, tt.fields))
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if stored, _ := files.List(context.Background(), "blobs/"); len(stored) != 0 {
+				t.Errorf("Expected rejected batch to leave nothing behind, found %+v", stored)
+			}
+		})
+	}
+}
+
+func TestTaskHandler_Job(t *testing.T) {
+	jobID := uuid.New().String()
+	mockService := &mockTaskService{
+		getJobFunc: func(ctx context.Context, id string) (*dto.JobResponse, error) {
+			if id != jobID {
+				return nil, dto.ErrJobNotFound
+			}
+			return &dto.JobResponse{ID: id, Total: 3, Counts: map[string]int{"completed": 2, "processing": 1}}, nil
+		},
+	}
+	handler := newTestTaskHandler(t, mockService, nil)
+
+	for id, want := range map[string]int{jobID: http.StatusOK, uuid.New().String(): http.StatusNotFound, "nope": http.StatusBadRequest} {
+		req := httptest.NewRequest("GET", "/jobs/"+id, nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+
+		handler.Job(rec, req)
+
+		if rec.Code != want {
+			t.Errorf("%s: expected status %d, got %d", id, want, rec.Code)
+		}
+	}
+}
+
+func TestTaskHandler_JobDownload(t *testing.T) {
+	files := newTestStorage(t)
+	ctx := context.Background()
+	outputs := []dto.JobOutput{
+		{TaskID: "1", OriginalFilename: "photo.jpg", OutputFilename: "1.png"},
+		{TaskID: "2", OriginalFilename: "photo.jpeg", OutputFilename: "2.png"},
+		{TaskID: "3", OriginalFilename: "scan.pdf", OutputFilename: "3.png"},
+		{TaskID: "4", OriginalFilename: "gone.jpg", OutputFilename: "4.png"},
+	}
+	for _, output := range outputs[:3] {
+		content := "output of " + output.TaskID
+		if err := files.Put(ctx, output.OutputFilename, strings.NewReader(content), int64(len(content))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mockService := &mockTaskService{
+		outputsFunc: func(ctx context.Context, jobID string) ([]dto.JobOutput, error) {
+			return outputs, nil
+		},
+	}
+	handler := newTestTaskHandler(t, mockService, files)
+	jobID := uuid.New().String()
+
+	req := httptest.NewRequest("GET", "/jobs/"+jobID+"/download", nil)
+	req.SetPathValue("id", jobID)
+	rec := httptest.NewRecorder()
+
+	handler.JobDownload(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("Unexpected response %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		got[f.Name] = string(data)
+	}
+	want := map[string]string{"photo.png": "output of 1", "photo_2.png": "output of 2", "scan.png": "output of 3"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("%s: expected %q, got %q", name, content, got[name])
+		}
+	}
+}
+
+func TestTaskHandler_JobDownload_NotFinished(t *testing.T) {
+	mockService := &mockTaskService{
+		outputsFunc: func(ctx context.Context, jobID string) ([]dto.JobOutput, error) {
+			return nil, dto.ErrJobNotFinished
+		},
+	}
+	handler := newTestTaskHandler(t, mockService, nil)
+	jobID := uuid.New().String()
+
+	req := httptest.NewRequest("GET", "/jobs/"+jobID+"/download", nil)
+	req.SetPathValue("id", jobID)
+	rec := httptest.NewRecorder()
+
+	handler.JobDownload(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/validation"
+)
+
+const (
+	// sniffLen is how much of a file is inspected for magic bytes.
+	sniffLen = 512
+	// maxFormValues bounds the combined size of the non-file fields of a form.
+	maxFormValues = 1 << 20
+)
+
+// uploadForm is a multipart form read as a stream. Files are validated and
+// stored while they arrive, so neither memory nor a temp directory ever
+// holds a whole upload.
+type uploadForm struct {
+	Values url.Values
+	Files  map[string][]*storedFile
+	// Skipped lists archive entries that were not stored.
+	Skipped []dto.SkippedFile
+	// Archives counts the archives expanded into Files.
+	Archives int
+
+	stored []*storedFile
+	parts  int
+}
+
+// File returns the first file uploaded in field, or nil.
+func (f *uploadForm) File(field string) *storedFile {
+	if files := f.Files[field]; len(files) > 0 {
+		return files[0]
+	}
+	return nil
+}
+
+// all returns every stored file in the order it was received.
+func (f *uploadForm) all() []*storedFile {
+	return f.stored
+}
+
+func (f *uploadForm) add(field string, files ...*storedFile) {
+	f.Files[field] = append(f.Files[field], files...)
+	f.stored = append(f.stored, files...)
+}
+
+// readForm streams the multipart body of r. Files are accepted in
+// fileFields, at most maxFiles in total; files in other fields are skipped.
+// If reading fails, everything stored so far is released.
+func (h *TaskHandler) readForm(r *http.Request, maxFiles int, fileFields ...string) (*uploadForm, error) {
+	return h.streamForm(r, maxFiles, maxFiles, fileFields, nil)
+}
+
+// streamForm is readForm with archive fields: a ZIP or tar.gz uploaded in
+// one of archiveFields is expanded, and each supported entry stored as a file
+// of that field. A field listed in both takes archives by their extension
+// and anything else as a single file. At most maxParts file parts, archives
+// included, are accepted; the form fails on the next one before storing it.
+func (h *TaskHandler) streamForm(r *http.Request, maxParts, maxFiles int, fileFields, archiveFields []string) (*uploadForm, error) {
+	form, err := h.readParts(r, maxParts, maxFiles, fileFields, archiveFields)
+	if err != nil {
+		h.releaseFiles(r.Context(), form.all()...)
+		return nil, err
+	}
+	return form, nil
+}
+
+func (h *TaskHandler) readParts(r *http.Request, maxParts, maxFiles int, fileFields, archiveFields []string) (*uploadForm, error) {
+	form := &uploadForm{Values: make(url.Values), Files: make(map[string][]*storedFile)}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return form, &requestError{"Failed to parse form", http.StatusBadRequest, err}
+	}
+
+	valuesLeft := int64(maxFormValues)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return form, nil
+		}
+		if err != nil {
+			return form, &requestError{"Failed to parse form", http.StatusBadRequest, err}
+		}
+
+		name := part.FormName()
+		isFile := part.FileName() != "" && (slices.Contains(fileFields, name) || slices.Contains(archiveFields, name))
+		if isFile && form.parts >= maxParts {
+			part.Close()
+			return form, &requestError{"Too many files", http.StatusBadRequest, nil}
+		}
+
+		switch {
+		case part.FileName() == "":
+			value, err := io.ReadAll(io.LimitReader(part, valuesLeft+1))
+			if err == nil && int64(len(value)) > valuesLeft {
+				err = errors.New("form fields are too large")
+			}
+			if err != nil {
+				part.Close()
+				return form, &requestError{"Failed to parse form", http.StatusBadRequest, err}
+			}
+			valuesLeft -= int64(len(value))
+			form.Values.Add(name, string(value))
+
+		case slices.Contains(archiveFields, name) && (!slices.Contains(fileFields, name) || isArchiveName(part.FileName())):
+			stored, skipped, err := h.saveArchive(r.Context(), part, maxFiles-len(form.stored))
+			if err != nil {
+				part.Close()
+				return form, err
+			}
+			form.add(name, stored...)
+			form.Skipped = append(form.Skipped, skipped...)
+			form.Archives++
+			form.parts++
+
+		case slices.Contains(fileFields, name):
+			if len(form.stored) >= maxFiles {
+				part.Close()
+				return form, &requestError{"Too many files", http.StatusBadRequest, nil}
+			}
+			stored, err := h.saveFile(r.Context(), part.FileName(), part)
+			if err != nil {
+				part.Close()
+				return form, err
+			}
+			form.add(name, stored)
+			form.parts++
+		}
+		part.Close()
+	}
+}
+
+// saveFile checks the magic bytes of content against the filename, then
+// streams it into the blob store under the hash of its contents while
+// enforcing the size limit. The original filename is kept only as task
+// metadata.
+func (h *TaskHandler) saveFile(ctx context.Context, filename string, content io.Reader) (*storedFile, error) {
+	buffered := bufio.NewReaderSize(content, sniffLen)
+	head, err := buffered.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, &requestError{"Failed to read file", http.StatusBadRequest, err}
+	}
+
+	fileType, err := h.validateFile(filename, head)
+	if err != nil {
+		return nil, &requestError{"Invalid file", http.StatusBadRequest, err}
+	}
+
+	body := &uploadReader{r: buffered, remaining: h.limits.MaxFileSize}
+	blob, err := h.blobs.Save(ctx, body, fileExtension(fileType))
+	switch {
+	case errors.Is(err, validation.ErrFileTooLarge):
+		h.logger.Warn("File too large",
+			zap.String("filename", filename),
+			zap.Int64("limit", h.limits.MaxFileSize),
+		)
+		return nil, &requestError{"Invalid file", http.StatusBadRequest, err}
+	case body.err != nil:
+		return nil, &requestError{"Failed to read file", http.StatusBadRequest, body.err}
+	case err != nil:
+		return nil, &requestError{"Failed to save file", http.StatusInternalServerError, err}
+	}
+
+	return &storedFile{Filename: filename, Type: fileType, Blob: blob}, nil
+}
+
+func (h *TaskHandler) validateFile(filename string, head []byte) (validation.FileType, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+
+	fileType, err := validation.DetectBytes(head)
+	if err != nil {
+		h.logger.Warn("Magic bytes detection failed",
+			zap.String("filename", filename),
+			zap.Error(err),
+		)
+		return "", validation.ErrInvalidFileType
+	}
+
+	expectedType, ok := extensionTypes[ext]
+	if !ok {
+		h.logger.Warn("Unsupported file extension",
+			zap.String("filename", filename),
+			zap.String("extension", ext),
+		)
+		return "", validation.ErrUnsupportedFormat
+	}
+
+	if fileType != expectedType {
+		h.logger.Warn("File extension mismatch with magic bytes",
+			zap.String("filename", filename),
+			zap.String("extension", ext),
+			zap.String("expected_type", string(expectedType)),
+			zap.String("detected_type", string(fileType)),
+		)
+		return "", validation.ErrExtensionMismatch
+	}
+
+	return fileType, nil
+}
+
+// uploadReader fails with ErrFileTooLarge once more than remaining bytes
+// have been read, and records read errors so a broken request body can be
+// told apart from a storage failure.
+type uploadReader struct {
+	r         io.Reader
+	remaining int64
+	err       error
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > u.remaining+1 {
+		p = p[:u.remaining+1]
+	}
+
+	n, err := u.r.Read(p)
+	u.remaining -= int64(n)
+	if u.remaining < 0 {
+		return n, validation.ErrFileTooLarge
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		u.err = err
+	}
+	return n, err
+}
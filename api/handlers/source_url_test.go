@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/fetch"
+	"mediaConverter/api/models"
+)
+
+type fetcherFunc func(ctx context.Context, rawURL string) (*fetch.Response, error)
+
+func (f fetcherFunc) Get(ctx context.Context, rawURL string) (*fetch.Response, error) {
+	return f(ctx, rawURL)
+}
+
+func serveSource(filename string, content []byte) fetcherFunc {
+	return func(ctx context.Context, rawURL string) (*fetch.Response, error) {
+		return &fetch.Response{
+			Body:     io.NopCloser(bytes.NewReader(content)),
+			Filename: filename,
+			Size:     int64(len(content)),
+		}, nil
+	}
+}
+
+func TestTaskHandler_CreateFromURL(t *testing.T) {
+	jpeg := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{0}, 60)...)
+
+	tests := []struct {
+		name         string
+		body         string
+		fetcher      fetcherFunc
+		wantStatus   int
+		wantFilename string
+	}{
+		{"named source", `{"source_url": "https://example.com/a/photo.jpg", "output_format": "png"}`, serveSource("photo.jpg", jpeg), http.StatusCreated, "photo.jpg"},
+		{"extension from content", `{"source_url": "https://example.com/image?id=1"}`, serveSource("image", jpeg), http.StatusCreated, "image.jpg"},
+		{"extension mismatch", `{"source_url": "https://example.com/photo.png"}`, serveSource("photo.png", jpeg), http.StatusBadRequest, ""},
+		{"not an image", `{"source_url": "https://example.com/page"}`, serveSource("page", []byte("<html>")), http.StatusBadRequest, ""},
+		{"missing url", `{"output_format": "png"}`, serveSource("photo.jpg", jpeg), http.StatusBadRequest, ""},
+		{"invalid policy", `{"source_url": "https://example.com/photo.jpg", "duplicate_policy": "merge"}`, serveSource("photo.jpg", jpeg), http.StatusBadRequest, ""},
+		{"forbidden address", `{"source_url": "http://169.254.169.254/latest"}`, func(ctx context.Context, rawURL string) (*fetch.Response, error) {
+			return nil, fmt.Errorf("%w: 169.254.169.254", fetch.ErrForbiddenAddress)
+		}, http.StatusBadRequest, ""},
+		{"too large", `{"source_url": "https://example.com/huge.jpg"}`, func(ctx context.Context, rawURL string) (*fetch.Response, error) {
+			return nil, fetch.ErrTooLarge
+		}, http.StatusBadRequest, ""},
+		{"upstream error", `{"source_url": "https://example.com/missing.jpg"}`, func(ctx context.Context, rawURL string) (*fetch.Response, error) {
+			return nil, fmt.Errorf("%w: 404 Not Found", fetch.ErrUnexpectedStatus)
+		}, http.StatusBadGateway, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created *dto.CreateTaskRequest
+			mockService := &mockTaskService{
+				createTaskFunc: func(ctx context.Context, traceID string, req *dto.CreateTaskRequest) (*dto.TaskResponse, error) {
+					created = req
+					return &dto.TaskResponse{ID: uuid.New().String(), Status: string(models.StatusPending)}, nil
+				},
+			}
+			handler := newTestTaskHandler(t, mockService, nil)
+			handler.fetcher = tt.fetcher
+
+			req := httptest.NewRequest("POST", "/tasks", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+
+			handler.CreateFromURL(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				if created != nil {
+					t.Error("Expected no task to be created")
+				}
+				return
+			}
+			if created.OriginalFilename != tt.wantFilename || created.SourceHash == "" {
+				t.Errorf("Unexpected task request %+v", created)
+			}
+		})
+	}
+}
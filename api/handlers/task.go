@@ -5,33 +5,84 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
+	"net/url"
+	"strconv"
 	"strings"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 
+	"mediaConverter/api/blobs"
 	"mediaConverter/api/dto"
+	"mediaConverter/api/fetch"
 	"mediaConverter/api/middleware"
+	"mediaConverter/api/models"
 	"mediaConverter/api/validation"
+	"mediaConverter/worker/storage"
 )
 
 type TaskService interface {
 	CreateTask(ctx context.Context, traceID string, req *dto.CreateTaskRequest) (*dto.TaskResponse, error)
 	GetTaskStatus(ctx context.Context, taskID string) (*dto.TaskResponse, error)
+	FindSimilarTasks(ctx context.Context, taskID string, hash models.HashType, maxDistance int) (*dto.SimilarTasksResponse, error)
+	GetSourceFiles(ctx context.Context, taskIDs []string) ([]dto.SourceFile, error)
+	CreatePendingUpload(ctx context.Context, traceID string, req *dto.CreateTaskRequest, size int64) (*dto.TaskResponse, error)
+	GetPendingUpload(ctx context.Context, taskID string) (*dto.PendingUpload, error)
+	CommitUpload(ctx context.Context, taskID, filePath, sourceHash string) (*dto.TaskResponse, error)
+	CancelTask(ctx context.Context, taskID string) (*dto.CancelledTask, error)
+	RetryTask(ctx context.Context, traceID, taskID string, req *dto.RetryRequest) (*dto.TaskResponse, error)
+	ListScheduledTasks(ctx context.Context, limit int) (*dto.TaskListResponse, error)
+	CreateJob(ctx context.Context, traceID string, reqs []*dto.CreateTaskRequest) (*dto.JobResponse, error)
+	GetJob(ctx context.Context, jobID string) (*dto.JobResponse, error)
+	GetJobOutputs(ctx context.Context, jobID string) ([]dto.JobOutput, error)
+}
+
+// SourceFetcher downloads the sources of tasks created from a URL.
+type SourceFetcher interface {
+	Get(ctx context.Context, rawURL string) (*fetch.Response, error)
+}
+
+const defaultSimilarDistance = 10
+
+const (
+	defaultScheduledLimit = 50
+	maxScheduledLimit     = 500
+)
+
+var extensionTypes = map[string]validation.FileType{
+	".jpg":  validation.FileTypeJPEG,
+	".jpeg": validation.FileTypeJPEG,
+	".png":  validation.FileTypePNG,
+	".gif":  validation.FileTypeGIF,
+	".pdf":  validation.FileTypePDF,
+}
+
+// UploadLimits bound what a single request may upload.
+type UploadLimits struct {
+	MaxFileSize       int64
+	MaxArchiveSize    int64
+	MaxArchiveEntries int
+	// MaxArchiveExpandedSize bounds the total uncompressed size of an archive.
+	MaxArchiveExpandedSize int64
 }
 
 type TaskHandler struct {
 	service TaskService
+	blobs   *blobs.Store
+	files   storage.Backend
+	fetcher SourceFetcher
+	limits  UploadLimits
 	logger  *zap.Logger
 }
 
-func NewTaskHandler(service TaskService, logger *zap.Logger) *TaskHandler {
+func NewTaskHandler(service TaskService, blobStore *blobs.Store, files storage.Backend, fetcher SourceFetcher, limits UploadLimits, logger *zap.Logger) *TaskHandler {
 	return &TaskHandler{
 		service: service,
+		blobs:   blobStore,
+		files:   files,
+		fetcher: fetcher,
+		limits:  limits,
 		logger:  logger,
 	}
 }
@@ -39,7 +90,7 @@ func NewTaskHandler(service TaskService, logger *zap.Logger) *TaskHandler {
 // Upload handles file upload requests.
 //
 //	@Summary		Upload file for processing
-//	@Description	Upload a media file (JPEG, PNG, GIF, PDF, MP4) for asynchronous processing. Returns a task ID for tracking.
+//	@Description	Upload a media file (JPEG, PNG, GIF, PDF, MP4) for asynchronous processing. Returns a task ID for tracking. A ZIP or tar.gz archive is expanded into a job with one task per supported file instead.
 //	@Tags			tasks
 //	@Accept			multipart/form-data
 //	@Produce		json
@@ -48,72 +99,96 @@ func NewTaskHandler(service TaskService, logger *zap.Logger) *TaskHandler {
 //	@Param			target_width	formData	int		false	"Target width in pixels"
 //	@Param			target_height	formData	int		false	"Target height in pixels"
 //	@Param			crop			formData	bool	false	"Crop to center (true/false)"
+//	@Param			duplicate_policy	formData	string	false	"Near-duplicate handling (allow, reject, reuse)"
+//	@Param			priority		formData	string	false	"Queue lane (interactive, normal, bulk; default normal, bulk for archives)"
+//	@Param			run_at			formData	string	false	"RFC 3339 time to queue the task at instead of now"
 //	@Success		201				{object}	dto.TaskResponse
+//	@Success		201				{object}	dto.JobResponse
 //	@Failure		400				{object}	dto.ErrorResponse
 //	@Failure		500				{object}	dto.ErrorResponse
 //	@Router			/upload [post]
 func (h *TaskHandler) Upload(w http.ResponseWriter, r *http.Request) {
 	traceID := middleware.GetTraceID(r.Context())
 
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		h.handleError(w, "Failed to parse form", err, traceID, http.StatusBadRequest)
+	// A single file or archive; an archive may expand into many files.
+	form, err := h.streamForm(r, 1, maxJobFiles, []string{"file"}, []string{"file"})
+	if err != nil {
+		h.handleRequestError(w, err, traceID)
 		return
 	}
 
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		h.handleError(w, "Failed to get file", err, traceID, http.StatusBadRequest)
+	stored := form.File("file")
+	if stored == nil && form.Archives == 0 {
+		h.handleError(w, "Failed to get file", http.ErrMissingFile, traceID, http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
 
-	if err := h.validateFile(header, file); err != nil {
-		h.handleError(w, "Invalid file", err, traceID, http.StatusBadRequest)
+	duplicatePolicy := models.DuplicatePolicy(form.Values.Get("duplicate_policy"))
+	if !validDuplicatePolicy(duplicatePolicy) {
+		h.releaseFiles(r.Context(), form.all()...)
+		h.handleError(w, "Invalid duplicate_policy", nil, traceID, http.StatusBadRequest)
 		return
 	}
 
-	filename := sanitizeFilename(header.Filename)
-	filePath := filepath.Join("/uploads", filename)
-
-	dst, err := os.Create(filePath)
-	if err != nil {
-		h.handleError(w, "Failed to save file", err, traceID, http.StatusInternalServerError)
+	priority := models.Priority(form.Values.Get("priority"))
+	if !validPriority(priority) {
+		h.releaseFiles(r.Context(), form.all()...)
+		h.handleError(w, "Invalid priority", nil, traceID, http.StatusBadRequest)
 		return
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		h.handleError(w, "Failed to write file", err, traceID, http.StatusInternalServerError)
+	runAt, err := parseRunAt(form.Values.Get("run_at"))
+	if err != nil {
+		h.releaseFiles(r.Context(), form.all()...)
+		h.handleError(w, "Invalid run_at: must be an RFC 3339 time", err, traceID, http.StatusBadRequest)
 		return
 	}
 
-	outputFormat := r.FormValue("output_format")
+	outputFormat := form.Values.Get("output_format")
 	var targetWidth, targetHeight *int
-	if w := r.FormValue("target_width"); w != "" {
+	if w := form.Values.Get("target_width"); w != "" {
 		width := 0
 		if _, err := fmt.Sscanf(w, "%d", &width); err == nil {
 			targetWidth = &width
 		}
 	}
-	if h := r.FormValue("target_height"); h != "" {
+	if h := form.Values.Get("target_height"); h != "" {
 		height := 0
 		if _, err := fmt.Sscanf(h, "%d", &height); err == nil {
 			targetHeight = &height
 		}
 	}
-	crop := r.FormValue("crop") == "true"
+	crop := form.Values.Get("crop") == "true"
 
 	req := &dto.CreateTaskRequest{
-		OriginalFilename: header.Filename,
-		FilePath:         filePath,
-		OutputFormat:     outputFormat,
-		TargetWidth:      targetWidth,
-		TargetHeight:     targetHeight,
-		Crop:             crop,
+		OutputFormat:    outputFormat,
+		TargetWidth:     targetWidth,
+		TargetHeight:    targetHeight,
+		Crop:            crop,
+		DuplicatePolicy: string(duplicatePolicy),
+		Priority:        string(priority),
+		RunAt:           runAt,
+	}
+
+	// An archive becomes a job with a task per file, all sharing the
+	// parameters of the upload.
+	if form.Archives > 0 {
+		job, err := h.createJob(r.Context(), traceID, req, form.all(), form.Skipped)
+		if err != nil {
+			h.handleRequestError(w, err, traceID)
+			return
+		}
+		h.respondJSON(w, http.StatusCreated, job)
+		return
 	}
 
+	req.OriginalFilename = stored.Filename
+	req.FilePath = stored.Key
+	req.SourceHash = stored.Hash
+
 	resp, err := h.service.CreateTask(r.Context(), traceID, req)
 	if err != nil {
+		h.releaseFiles(r.Context(), stored)
 		h.handleError(w, "Failed to create task", err, traceID, http.StatusInternalServerError)
 		return
 	}
@@ -121,7 +196,7 @@ func (h *TaskHandler) Upload(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("File uploaded",
 		zap.String("trace_id", traceID),
 		zap.String("task_id", resp.ID),
-		zap.String("filename", header.Filename),
+		zap.String("filename", stored.Filename),
 	)
 
 	h.respondJSON(w, http.StatusCreated, resp)
@@ -130,7 +205,7 @@ func (h *TaskHandler) Upload(w http.ResponseWriter, r *http.Request) {
 // Status returns the current status of a processing task.
 //
 //	@Summary		Get task status
-//	@Description	Get the current processing status of a task by its ID. Status can be: pending, processing, completed, or failed.
+//	@Description	Get the current processing status of a task by its ID. Status can be: awaiting_upload, scheduled, pending, processing, completed, failed, or cancelled.
 //	@Tags			tasks
 //	@Produce		json
 //	@Param			id	path		string	true	"Task ID"
@@ -160,60 +235,272 @@ func (h *TaskHandler) Status(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, http.StatusOK, resp)
 }
 
-func (h *TaskHandler) validateFile(header *multipart.FileHeader, file multipart.File) error {
-	const maxSize = 100 * 1024 * 1024
+// Cancel stops a task that has not finished yet.
+//
+//	@Summary		Cancel a task
+//	@Description	Set an unfinished task to cancelled, including a scheduled one. A worker already processing it stops between conversion steps and discards its result.
+//	@Tags			tasks
+//	@Produce		json
+//	@Param			id	path		string	true	"Task ID"
+//	@Success		200	{object}	dto.TaskResponse
+//	@Failure		404	{object}	dto.ErrorResponse
+//	@Failure		409	{object}	dto.ErrorResponse
+//	@Failure		500	{object}	dto.ErrorResponse
+//	@Router			/tasks/{id}/cancel [post]
+func (h *TaskHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	taskID := r.PathValue("id")
+	if _, err := uuid.Parse(taskID); err != nil {
+		h.handleError(w, "Task not found", err, traceID, http.StatusNotFound)
+		return
+	}
+
+	resp, err := h.service.CancelTask(r.Context(), taskID)
+	if err != nil {
+		switch {
+		case errors.Is(err, dto.ErrTaskNotFound):
+			h.handleError(w, "Task not found", err, traceID, http.StatusNotFound)
+		case errors.Is(err, dto.ErrNotCancellable):
+			h.handleError(w, "Task has already finished", err, traceID, http.StatusConflict)
+		default:
+			h.handleError(w, "Failed to cancel task", err, traceID, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The task never ran, so nothing reads its sources anymore.
+	for _, key := range resp.Blobs {
+		if blob, ok := blobs.FromKey(key); ok {
+			h.releaseFiles(r.Context(), &storedFile{Blob: blob})
+		}
+	}
+	if resp.Upload != "" {
+		h.deleteUpload(r.Context(), resp.Upload)
+	}
+
+	h.logger.Info("Task cancelled",
+		zap.String("trace_id", traceID),
+		zap.String("task_id", taskID),
+	)
+
+	h.respondJSON(w, http.StatusOK, resp.Task)
+}
+
+// Retry queues a new attempt of a failed task.
+//
+//	@Summary		Retry a failed task
+//	@Description	Create a new task from the source and parameters of a failed task and queue it. Parameters in the body replace those of the failed task. The new task links to the failed one through retry_of and counts its attempt. A task can be retried once; retry the latest attempt to try again.
+//	@Tags			tasks
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string				true	"Task ID"
+//	@Param			request	body		dto.RetryRequest	false	"Parameter overrides"
+//	@Success		202		{object}	dto.TaskResponse
+//	@Failure		400		{object}	dto.ErrorResponse
+//	@Failure		404		{object}	dto.ErrorResponse
+//	@Failure		409		{object}	dto.ErrorResponse
+//	@Failure		500		{object}	dto.ErrorResponse
+//	@Router			/tasks/{id}/retry [post]
+func (h *TaskHandler) Retry(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	taskID := r.PathValue("id")
+	if _, err := uuid.Parse(taskID); err != nil {
+		h.handleError(w, "Task not found", err, traceID, http.StatusNotFound)
+		return
+	}
+
+	var req dto.RetryRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.handleError(w, "Invalid request body", err, traceID, http.StatusBadRequest)
+			return
+		}
+	}
+	if (req.TargetWidth != nil && *req.TargetWidth <= 0) || (req.TargetHeight != nil && *req.TargetHeight <= 0) {
+		h.handleError(w, "Invalid target size: must be positive", nil, traceID, http.StatusBadRequest)
+		return
+	}
 
-	if header.Size > maxSize {
-		h.logger.Warn("File too large",
-			zap.String("filename", header.Filename),
-			zap.Int64("size", header.Size),
-		)
-		return validation.ErrFileTooLarge
+	resp, err := h.service.RetryTask(r.Context(), traceID, taskID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, dto.ErrTaskNotFound):
+			h.handleError(w, "Task not found", err, traceID, http.StatusNotFound)
+		case errors.Is(err, dto.ErrNotRetryable):
+			h.handleError(w, "Only failed tasks can be retried", err, traceID, http.StatusConflict)
+		case errors.Is(err, dto.ErrAlreadyRetried):
+			h.handleError(w, "Task has already been retried", err, traceID, http.StatusConflict)
+		default:
+			h.handleError(w, "Failed to retry task", err, traceID, http.StatusInternalServerError)
+		}
+		return
 	}
 
-	ext := strings.ToLower(filepath.Ext(header.Filename))
+	h.logger.Info("Task retried",
+		zap.String("trace_id", traceID),
+		zap.String("task_id", taskID),
+		zap.String("retry_id", resp.ID),
+		zap.Int("attempt", resp.Attempt),
+	)
+
+	h.respondJSON(w, http.StatusAccepted, resp)
+}
+
+// Scheduled lists the tasks waiting for their run_at.
+//
+//	@Summary		List scheduled tasks
+//	@Description	List the tasks waiting for their run_at, the next due first. Cancel one with POST /tasks/{id}/cancel.
+//	@Tags			tasks
+//	@Produce		json
+//	@Param			limit	query		int	false	"Maximum number of tasks (1-500)"	default(50)
+//	@Success		200		{object}	dto.TaskListResponse
+//	@Failure		400		{object}	dto.ErrorResponse
+//	@Failure		500		{object}	dto.ErrorResponse
+//	@Router			/tasks/scheduled [get]
+func (h *TaskHandler) Scheduled(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	limit, err := formInt(r.URL.Query(), "limit", defaultScheduledLimit, 1, maxScheduledLimit)
+	if err != nil {
+		h.handleRequestError(w, err, traceID)
+		return
+	}
 
-	fileType, err := validation.DetectFileType(file)
+	resp, err := h.service.ListScheduledTasks(r.Context(), limit)
 	if err != nil {
-		h.logger.Warn("Magic bytes detection failed",
-			zap.String("filename", header.Filename),
-			zap.Error(err),
-		)
-		return validation.ErrInvalidFileType
+		h.handleError(w, "Failed to list scheduled tasks", err, traceID, http.StatusInternalServerError)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, resp)
+}
+
+// Similar lists earlier tasks whose source looks like this task's source.
+//
+//	@Summary		Find near-duplicate tasks
+//	@Description	List earlier tasks whose perceptual hash is within the given Hamming distance of this task's hash.
+//	@Tags			tasks
+//	@Produce		json
+//	@Param			id			path		string	true	"Task ID"
+//	@Param			distance	query		int		false	"Maximum Hamming distance (0-64, default 10)"
+//	@Param			hash		query		string	false	"Hash to compare (ahash, dhash, phash; default phash)"
+//	@Success		200			{object}	dto.SimilarTasksResponse
+//	@Failure		400			{object}	dto.ErrorResponse
+//	@Failure		404			{object}	dto.ErrorResponse
+//	@Failure		409			{object}	dto.ErrorResponse
+//	@Failure		500			{object}	dto.ErrorResponse
+//	@Router			/tasks/{id}/similar [get]
+func (h *TaskHandler) Similar(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	taskID := r.PathValue("id")
+	if _, err := uuid.Parse(taskID); err != nil {
+		h.handleError(w, "Task not found", err, traceID, http.StatusNotFound)
+		return
+	}
+
+	distance := defaultSimilarDistance
+	if d := r.URL.Query().Get("distance"); d != "" {
+		parsed, err := strconv.Atoi(d)
+		if err != nil || parsed < 0 || parsed > 64 {
+			h.handleError(w, "Invalid distance", err, traceID, http.StatusBadRequest)
+			return
+		}
+		distance = parsed
+	}
+
+	hash := models.HashPerceptual
+	if hashParam := r.URL.Query().Get("hash"); hashParam != "" {
+		hash = models.HashType(hashParam)
+		switch hash {
+		case models.HashAverage, models.HashDifference, models.HashPerceptual:
+		default:
+			h.handleError(w, "Invalid hash", nil, traceID, http.StatusBadRequest)
+			return
+		}
 	}
 
-	extToType := map[string]validation.FileType{
-		".jpg":  validation.FileTypeJPEG,
-		".jpeg": validation.FileTypeJPEG,
-		".png":  validation.FileTypePNG,
-		".gif":  validation.FileTypeGIF,
-		".pdf":  validation.FileTypePDF,
+	resp, err := h.service.FindSimilarTasks(r.Context(), taskID, hash, distance)
+	if err != nil {
+		switch {
+		case errors.Is(err, dto.ErrTaskNotFound):
+			h.handleError(w, "Task not found", err, traceID, http.StatusNotFound)
+		case errors.Is(err, dto.ErrHashesNotReady):
+			h.handleError(w, "Task has not been hashed yet", err, traceID, http.StatusConflict)
+		default:
+			h.handleError(w, "Failed to find similar tasks", err, traceID, http.StatusInternalServerError)
+		}
+		return
 	}
 
-	expectedType, ok := extToType[ext]
-	if !ok {
-		h.logger.Warn("Unsupported file extension",
-			zap.String("filename", header.Filename),
-			zap.String("extension", ext),
-		)
-		return validation.ErrUnsupportedFormat
+	h.respondJSON(w, http.StatusOK, resp)
+}
+
+// requestError carries the client-facing message and status of a failure in
+// a helper shared by several handlers.
+type requestError struct {
+	message string
+	status  int
+	err     error
+}
+
+func (e *requestError) Error() string {
+	if e.err == nil {
+		return e.message
 	}
+	return e.message + ": " + e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// storedFile is an uploaded file saved to the blob store.
+type storedFile struct {
+	Filename string
+	Type     validation.FileType
+	*blobs.Blob
+}
 
-	if fileType != expectedType {
-		h.logger.Warn("File extension mismatch with magic bytes",
-			zap.String("filename", header.Filename),
-			zap.String("extension", ext),
-			zap.String("expected_type", string(expectedType)),
-			zap.String("detected_type", string(fileType)),
-		)
-		return validation.ErrExtensionMismatch
+// releaseFiles drops the blob references of uploads that did not end up in a
+// task, or whose task will never run.
+func (h *TaskHandler) releaseFiles(ctx context.Context, files ...*storedFile) {
+	for _, f := range files {
+		if f == nil {
+			continue
+		}
+		if err := h.blobs.Release(ctx, f.Blob); err != nil {
+			h.logger.Warn("Failed to release upload",
+				zap.String("hash", f.Hash),
+				zap.Error(err),
+			)
+		}
 	}
+}
 
-	return nil
+func fileExtension(fileType validation.FileType) string {
+	if fileType == validation.FileTypeJPEG {
+		return ".jpg"
+	}
+	return "." + string(fileType)
 }
 
-func sanitizeFilename(filename string) string {
-	return filepath.Base(filename)
+// formInt parses an optional integer form field, falling back to def when it
+// is empty.
+func formInt(values url.Values, field string, def, minValue, maxValue int) (int, error) {
+	value := values.Get(field)
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < minValue || n > maxValue {
+		return 0, &requestError{fmt.Sprintf("Invalid %s: must be between %d and %d", field, minValue, maxValue), http.StatusBadRequest, err}
+	}
+
+	return n, nil
 }
 
 func (h *TaskHandler) handleError(w http.ResponseWriter, message string, err error, traceID string, status int) {
@@ -230,8 +517,28 @@ func (h *TaskHandler) handleError(w http.ResponseWriter, message string, err err
 	})
 }
 
+func (h *TaskHandler) handleRequestError(w http.ResponseWriter, err error, traceID string) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		h.handleError(w, reqErr.message, reqErr.err, traceID, reqErr.status)
+		return
+	}
+	h.handleError(w, "Internal server error", err, traceID, http.StatusInternalServerError)
+}
+
 func (h *TaskHandler) respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(data)
 }
+
+// serveFile streams a stored object, wherever the backend keeps it.
+func (h *TaskHandler) serveFile(w http.ResponseWriter, r *http.Request, key, traceID string) {
+	if err := writeObject(w, r, h.files, key); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.handleError(w, "File not found", err, traceID, http.StatusNotFound)
+			return
+		}
+		h.handleError(w, "Failed to read file", err, traceID, http.StatusInternalServerError)
+	}
+}
@@ -3,6 +3,11 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
@@ -15,14 +20,64 @@ import (
 	"github.com/google/uuid"
 	"go.uber.org/zap/zaptest"
 
+	"mediaConverter/api/blobs"
 	"mediaConverter/api/dto"
 	"mediaConverter/api/middleware"
 	"mediaConverter/api/models"
+	"mediaConverter/worker/storage"
 )
 
 type mockTaskService struct {
 	createTaskFunc func(ctx context.Context, traceID string, req *dto.CreateTaskRequest) (*dto.TaskResponse, error)
 	getTaskFunc    func(ctx context.Context, taskID string) (*dto.TaskResponse, error)
+	similarFunc    func(ctx context.Context, taskID string, hash models.HashType, maxDistance int) (*dto.SimilarTasksResponse, error)
+	sourcesFunc    func(ctx context.Context, taskIDs []string) ([]dto.SourceFile, error)
+	pendingFunc    func(ctx context.Context, taskID string) (*dto.PendingUpload, error)
+	commitFunc     func(ctx context.Context, taskID, filePath, sourceHash string) (*dto.TaskResponse, error)
+	cancelFunc     func(ctx context.Context, taskID string) (*dto.CancelledTask, error)
+	retryFunc      func(ctx context.Context, traceID, taskID string, req *dto.RetryRequest) (*dto.TaskResponse, error)
+	scheduledFunc  func(ctx context.Context, limit int) (*dto.TaskListResponse, error)
+	createJobFunc  func(ctx context.Context, traceID string, reqs []*dto.CreateTaskRequest) (*dto.JobResponse, error)
+	getJobFunc     func(ctx context.Context, jobID string) (*dto.JobResponse, error)
+	outputsFunc    func(ctx context.Context, jobID string) ([]dto.JobOutput, error)
+}
+
+const testMaxFileSize = 1 << 20
+
+var testLimits = UploadLimits{
+	MaxFileSize:            testMaxFileSize,
+	MaxArchiveSize:         4 * testMaxFileSize,
+	MaxArchiveEntries:      10,
+	MaxArchiveExpandedSize: 8 * testMaxFileSize,
+}
+
+type mockBlobRefs struct{}
+
+func (m *mockBlobRefs) AcquireBlob(ctx context.Context, hash, path string, size int64) error {
+	return nil
+}
+
+func (m *mockBlobRefs) ReleaseBlob(ctx context.Context, hash string, remove func() error) error {
+	return remove()
+}
+
+func newTestStorage(t *testing.T) *storage.Local {
+	t.Helper()
+
+	files, err := storage.NewLocal(t.TempDir(), "http://localhost", []byte("secret"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	return files
+}
+
+func newTestTaskHandler(t *testing.T, service TaskService, files storage.Backend) *TaskHandler {
+	t.Helper()
+
+	if files == nil {
+		files = newTestStorage(t)
+	}
+	return NewTaskHandler(service, blobs.NewStore(files, &mockBlobRefs{}), files, nil, testLimits, zaptest.NewLogger(t))
 }
 
 func (m *mockTaskService) CreateTask(ctx context.Context, traceID string, req *dto.CreateTaskRequest) (*dto.TaskResponse, error) {
@@ -51,6 +106,99 @@ func (m *mockTaskService) GetTaskStatus(ctx context.Context, taskID string) (*dt
 	}, nil
 }
 
+func (m *mockTaskService) FindSimilarTasks(ctx context.Context, taskID string, hash models.HashType, maxDistance int) (*dto.SimilarTasksResponse, error) {
+	if m.similarFunc != nil {
+		return m.similarFunc(ctx, taskID, hash, maxDistance)
+	}
+	return &dto.SimilarTasksResponse{
+		TaskID:      taskID,
+		Hash:        string(hash),
+		MaxDistance: maxDistance,
+		Tasks:       []dto.SimilarTask{},
+	}, nil
+}
+
+func (m *mockTaskService) GetSourceFiles(ctx context.Context, taskIDs []string) ([]dto.SourceFile, error) {
+	if m.sourcesFunc != nil {
+		return m.sourcesFunc(ctx, taskIDs)
+	}
+	sources := make([]dto.SourceFile, len(taskIDs))
+	for i, id := range taskIDs {
+		sources[i] = dto.SourceFile{Path: "/uploads/" + id + ".jpg", Filename: id + ".jpg"}
+	}
+	return sources, nil
+}
+
+func (m *mockTaskService) CreatePendingUpload(ctx context.Context, traceID string, req *dto.CreateTaskRequest, size int64) (*dto.TaskResponse, error) {
+	return &dto.TaskResponse{
+		ID:               uuid.New().String(),
+		TraceID:          traceID,
+		OriginalFilename: req.OriginalFilename,
+		Status:           string(models.StatusAwaitingUpload),
+	}, nil
+}
+
+func (m *mockTaskService) GetPendingUpload(ctx context.Context, taskID string) (*dto.PendingUpload, error) {
+	if m.pendingFunc != nil {
+		return m.pendingFunc(ctx, taskID)
+	}
+	return nil, dto.ErrTaskNotFound
+}
+
+func (m *mockTaskService) CommitUpload(ctx context.Context, taskID, filePath, sourceHash string) (*dto.TaskResponse, error) {
+	if m.commitFunc != nil {
+		return m.commitFunc(ctx, taskID, filePath, sourceHash)
+	}
+	return &dto.TaskResponse{ID: taskID, Status: string(models.StatusPending)}, nil
+}
+
+func (m *mockTaskService) CancelTask(ctx context.Context, taskID string) (*dto.CancelledTask, error) {
+	if m.cancelFunc != nil {
+		return m.cancelFunc(ctx, taskID)
+	}
+	return &dto.CancelledTask{Task: &dto.TaskResponse{ID: taskID, Status: string(models.StatusCancelled)}}, nil
+}
+
+func (m *mockTaskService) ListScheduledTasks(ctx context.Context, limit int) (*dto.TaskListResponse, error) {
+	if m.scheduledFunc != nil {
+		return m.scheduledFunc(ctx, limit)
+	}
+	return &dto.TaskListResponse{Tasks: []*dto.TaskResponse{}}, nil
+}
+
+func (m *mockTaskService) RetryTask(ctx context.Context, traceID, taskID string, req *dto.RetryRequest) (*dto.TaskResponse, error) {
+	if m.retryFunc != nil {
+		return m.retryFunc(ctx, traceID, taskID, req)
+	}
+	return &dto.TaskResponse{ID: uuid.New().String(), TraceID: traceID, RetryOf: taskID, Attempt: 2, Status: string(models.StatusPending)}, nil
+}
+
+func (m *mockTaskService) CreateJob(ctx context.Context, traceID string, reqs []*dto.CreateTaskRequest) (*dto.JobResponse, error) {
+	if m.createJobFunc != nil {
+		return m.createJobFunc(ctx, traceID, reqs)
+	}
+	return &dto.JobResponse{
+		ID:      uuid.New().String(),
+		TraceID: traceID,
+		Total:   len(reqs),
+		Counts:  map[string]int{string(models.StatusPending): len(reqs)},
+	}, nil
+}
+
+func (m *mockTaskService) GetJob(ctx context.Context, jobID string) (*dto.JobResponse, error) {
+	if m.getJobFunc != nil {
+		return m.getJobFunc(ctx, jobID)
+	}
+	return nil, dto.ErrJobNotFound
+}
+
+func (m *mockTaskService) GetJobOutputs(ctx context.Context, jobID string) ([]dto.JobOutput, error) {
+	if m.outputsFunc != nil {
+		return m.outputsFunc(ctx, jobID)
+	}
+	return nil, dto.ErrJobNotFound
+}
+
 func createTestImageFile(t *testing.T) (*os.File, *multipart.FileHeader) {
 	tmpDir := t.TempDir()
 	path := filepath.Join(tmpDir, "test.jpg")
@@ -83,19 +231,13 @@ func createTestImageFile(t *testing.T) (*os.File, *multipart.FileHeader) {
 }
 
 func TestTaskHandler_Upload_Success(t *testing.T) {
-	if os.Geteuid() != 0 {
-		t.Skip("Skipping test: requires root to create /uploads directory")
-	}
-
-	uploadsDir := "/uploads"
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		t.Fatalf("Failed to create uploads dir: %v", err)
-	}
-	defer os.RemoveAll(uploadsDir)
-
-	logger := zaptest.NewLogger(t)
+	var sourceHash string
 	mockService := &mockTaskService{}
-	handler := NewTaskHandler(mockService, logger)
+	mockService.createTaskFunc = func(ctx context.Context, traceID string, req *dto.CreateTaskRequest) (*dto.TaskResponse, error) {
+		sourceHash = req.SourceHash
+		return &dto.TaskResponse{ID: uuid.New().String(), TraceID: traceID, Status: string(models.StatusPending)}, nil
+	}
+	handler := newTestTaskHandler(t, mockService, nil)
 
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
@@ -141,12 +283,16 @@ func TestTaskHandler_Upload_Success(t *testing.T) {
 	if contentType != "application/json" {
 		t.Errorf("Expected Content-Type application/json, got %s", contentType)
 	}
+
+	sum := sha256.Sum256(fileContent)
+	if sourceHash != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected source hash %x, got %s", sum, sourceHash)
+	}
 }
 
 func TestTaskHandler_Upload_NoFile(t *testing.T) {
-	logger := zaptest.NewLogger(t)
 	mockService := &mockTaskService{}
-	handler := NewTaskHandler(mockService, logger)
+	handler := newTestTaskHandler(t, mockService, nil)
 
 	req := httptest.NewRequest("POST", "/upload", strings.NewReader(""))
 	req.Header.Set("Content-Type", "multipart/form-data")
@@ -165,8 +311,114 @@ func TestTaskHandler_Upload_NoFile(t *testing.T) {
 	}
 }
 
+func TestTaskHandler_Upload_Streamed(t *testing.T) {
+	jpeg := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{0}, 60)...)
+
+	tests := []struct {
+		name       string
+		content    []byte
+		fields     map[string]string
+		wantStatus int
+	}{
+		{"fields after the file", jpeg, map[string]string{"output_format": "png", "crop": "true"}, http.StatusCreated},
+		{"invalid field after the file", jpeg, map[string]string{"duplicate_policy": "merge"}, http.StatusBadRequest},
+		{"too large", append(jpeg, make([]byte, testMaxFileSize)...), nil, http.StatusBadRequest},
+		{"wrong magic bytes", []byte("GIF89a"), nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created *dto.CreateTaskRequest
+			mockService := &mockTaskService{}
+			mockService.createTaskFunc = func(ctx context.Context, traceID string, req *dto.CreateTaskRequest) (*dto.TaskResponse, error) {
+				created = req
+				return &dto.TaskResponse{ID: uuid.New().String(), Status: string(models.StatusPending)}, nil
+			}
+			files := newTestStorage(t)
+			handler := newTestTaskHandler(t, mockService, files)
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			part, _ := writer.CreateFormFile("file", "photo.jpg")
+			part.Write(tt.content)
+			for name, value := range tt.fields {
+				writer.WriteField(name, value)
+			}
+			writer.Close()
+
+			req := httptest.NewRequest("POST", "/upload", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			rec := httptest.NewRecorder()
+
+			handler.Upload(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+
+			stored, err := files.List(context.Background(), "blobs/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				if len(stored) != 0 {
+					t.Errorf("Expected rejected upload to leave nothing behind, found %+v", stored)
+				}
+				return
+			}
+			if len(stored) != 1 || created.OutputFormat != "png" || !created.Crop {
+				t.Errorf("Unexpected result: stored %+v, request %+v", stored, created)
+			}
+		})
+	}
+}
+
+// countingStorage counts the objects written through it.
+type countingStorage struct {
+	*storage.Local
+	puts int
+}
+
+func (s *countingStorage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	s.puts++
+	return s.Local.Put(ctx, key, r, size)
+}
+
+func TestTaskHandler_Upload_SecondFileNotStored(t *testing.T) {
+	jpeg := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{0}, 60)...)
+	files := &countingStorage{Local: newTestStorage(t)}
+	handler := newTestTaskHandler(t, &mockTaskService{}, files)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, name := range []string{"first.jpg", "second.jpg", "third.jpg"} {
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write(jpeg)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+
+	handler.Upload(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if files.puts != 1 {
+		t.Errorf("Expected only the first file to be stored, got %d writes", files.puts)
+	}
+	stored, err := files.List(context.Background(), "blobs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 0 {
+		t.Errorf("Expected the first file to be released, found %+v", stored)
+	}
+}
+
 func TestTaskHandler_Status_Success(t *testing.T) {
-	logger := zaptest.NewLogger(t)
 	taskID := uuid.New().String()
 	traceID := uuid.New().String()
 
@@ -181,7 +433,7 @@ func TestTaskHandler_Status_Success(t *testing.T) {
 		},
 	}
 
-	handler := NewTaskHandler(mockService, logger)
+	handler := newTestTaskHandler(t, mockService, nil)
 
 	req := httptest.NewRequest("GET", "/status/"+taskID, nil)
 	req.Header.Set("X-Trace-ID", traceID)
@@ -204,7 +456,6 @@ func TestTaskHandler_Status_Success(t *testing.T) {
 }
 
 func TestTaskHandler_Status_NotFound(t *testing.T) {
-	logger := zaptest.NewLogger(t)
 	taskID := uuid.New().String()
 	traceID := uuid.New().String()
 
@@ -214,7 +465,7 @@ func TestTaskHandler_Status_NotFound(t *testing.T) {
 		},
 	}
 
-	handler := NewTaskHandler(mockService, logger)
+	handler := newTestTaskHandler(t, mockService, nil)
 
 	req := httptest.NewRequest("GET", "/status/"+taskID, nil)
 	req.Header.Set("X-Trace-ID", traceID)
@@ -232,9 +483,8 @@ func TestTaskHandler_Status_NotFound(t *testing.T) {
 }
 
 func TestTaskHandler_Status_EmptyTaskID(t *testing.T) {
-	logger := zaptest.NewLogger(t)
 	mockService := &mockTaskService{}
-	handler := NewTaskHandler(mockService, logger)
+	handler := newTestTaskHandler(t, mockService, nil)
 
 	req := httptest.NewRequest("GET", "/status/", nil)
 	traceID := uuid.New().String()
@@ -251,3 +501,573 @@ func TestTaskHandler_Status_EmptyTaskID(t *testing.T) {
 		t.Errorf("Expected status 400, got %d", rec.Code)
 	}
 }
+
+func TestTaskHandler_Similar_Success(t *testing.T) {
+	taskID := uuid.New().String()
+	traceID := uuid.New().String()
+
+	var gotHash models.HashType
+	var gotDistance int
+	mockService := &mockTaskService{
+		similarFunc: func(ctx context.Context, id string, hash models.HashType, maxDistance int) (*dto.SimilarTasksResponse, error) {
+			gotHash, gotDistance = hash, maxDistance
+			return &dto.SimilarTasksResponse{TaskID: id, Hash: string(hash), MaxDistance: maxDistance}, nil
+		},
+	}
+
+	handler := newTestTaskHandler(t, mockService, nil)
+
+	req := httptest.NewRequest("GET", "/tasks/"+taskID+"/similar?distance=6&hash=dhash", nil)
+	req.SetPathValue("id", taskID)
+
+	ctx := context.WithValue(req.Context(), middleware.TraceIDKey, traceID)
+	req = req.WithContext(ctx)
+
+	rec := httptest.NewRecorder()
+
+	handler.Similar(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+	if gotHash != models.HashDifference || gotDistance != 6 {
+		t.Errorf("Expected dhash with distance 6, got %s with distance %d", gotHash, gotDistance)
+	}
+}
+
+func TestTaskHandler_Similar_InvalidDistance(t *testing.T) {
+	handler := newTestTaskHandler(t, &mockTaskService{}, nil)
+	taskID := uuid.New().String()
+
+	req := httptest.NewRequest("GET", "/tasks/"+taskID+"/similar?distance=65", nil)
+	req.SetPathValue("id", taskID)
+
+	rec := httptest.NewRecorder()
+
+	handler.Similar(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+}
+
+func TestTaskHandler_Similar_HashesNotReady(t *testing.T) {
+	taskID := uuid.New().String()
+
+	mockService := &mockTaskService{
+		similarFunc: func(ctx context.Context, id string, hash models.HashType, maxDistance int) (*dto.SimilarTasksResponse, error) {
+			return nil, dto.ErrHashesNotReady
+		},
+	}
+
+	handler := newTestTaskHandler(t, mockService, nil)
+
+	req := httptest.NewRequest("GET", "/tasks/"+taskID+"/similar", nil)
+	req.SetPathValue("id", taskID)
+
+	rec := httptest.NewRecorder()
+
+	handler.Similar(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", rec.Code)
+	}
+}
+
+func TestTaskHandler_Cancel(t *testing.T) {
+	tests := []struct {
+		name       string
+		taskID     string
+		err        error
+		wantStatus int
+	}{
+		{name: "unfinished", taskID: uuid.New().String(), wantStatus: http.StatusOK},
+		{name: "finished", taskID: uuid.New().String(), err: dto.ErrNotCancellable, wantStatus: http.StatusConflict},
+		{name: "unknown", taskID: uuid.New().String(), err: dto.ErrTaskNotFound, wantStatus: http.StatusNotFound},
+		{name: "invalid id", taskID: "not-a-uuid", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &mockTaskService{
+				cancelFunc: func(ctx context.Context, taskID string) (*dto.CancelledTask, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &dto.CancelledTask{Task: &dto.TaskResponse{ID: taskID, Status: string(models.StatusCancelled)}}, nil
+				},
+			}
+			handler := newTestTaskHandler(t, mockService, nil)
+
+			req := httptest.NewRequest("POST", "/tasks/"+tt.taskID+"/cancel", nil)
+			req.SetPathValue("id", tt.taskID)
+			rec := httptest.NewRecorder()
+
+			handler.Cancel(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK {
+				var resp dto.TaskResponse
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatal(err)
+				}
+				if resp.Status != string(models.StatusCancelled) {
+					t.Errorf("Expected status cancelled, got %s", resp.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestTaskHandler_Cancel_ReleasesSources(t *testing.T) {
+	files := newTestStorage(t)
+	ctx := context.Background()
+
+	jpeg := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{0}, 60)...)
+	if err := files.Put(ctx, "uploads/pending.jpg", bytes.NewReader(jpeg), int64(len(jpeg))); err != nil {
+		t.Fatal(err)
+	}
+
+	var handler *TaskHandler
+	mockService := &mockTaskService{
+		cancelFunc: func(ctx context.Context, taskID string) (*dto.CancelledTask, error) {
+			blob, err := handler.blobs.Save(ctx, bytes.NewReader(jpeg), ".jpg")
+			if err != nil {
+				return nil, err
+			}
+			return &dto.CancelledTask{
+				Task:   &dto.TaskResponse{ID: taskID, Status: string(models.StatusCancelled)},
+				Blobs:  []string{blob.Key},
+				Upload: "uploads/pending.jpg",
+			}, nil
+		},
+	}
+	handler = newTestTaskHandler(t, mockService, files)
+
+	taskID := uuid.New().String()
+	req := httptest.NewRequest("POST", "/tasks/"+taskID+"/cancel", nil)
+	req.SetPathValue("id", taskID)
+	rec := httptest.NewRecorder()
+
+	handler.Cancel(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, prefix := range []string{"blobs/", "uploads/"} {
+		stored, err := files.List(ctx, prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stored) != 0 {
+			t.Errorf("Expected the sources of the cancelled task to be freed, found %+v", stored)
+		}
+	}
+}
+
+func TestTaskHandler_Retry(t *testing.T) {
+	tests := []struct {
+		name       string
+		taskID     string
+		body       string
+		err        error
+		wantStatus int
+		wantFormat string
+	}{
+		{name: "no overrides", taskID: uuid.New().String(), wantStatus: http.StatusAccepted, wantFormat: "jpg"},
+		{name: "format override", taskID: uuid.New().String(), body: `{"output_format":"png"}`, wantStatus: http.StatusAccepted, wantFormat: "png"},
+		{name: "invalid size", taskID: uuid.New().String(), body: `{"target_width":0}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid body", taskID: uuid.New().String(), body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "not failed", taskID: uuid.New().String(), err: dto.ErrNotRetryable, wantStatus: http.StatusConflict},
+		{name: "already retried", taskID: uuid.New().String(), err: dto.ErrAlreadyRetried, wantStatus: http.StatusConflict},
+		{name: "unknown", taskID: uuid.New().String(), err: dto.ErrTaskNotFound, wantStatus: http.StatusNotFound},
+		{name: "invalid id", taskID: "not-a-uuid", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &mockTaskService{
+				retryFunc: func(ctx context.Context, traceID, taskID string, req *dto.RetryRequest) (*dto.TaskResponse, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					format := "jpg"
+					if req.OutputFormat != nil {
+						format = *req.OutputFormat
+					}
+					return &dto.TaskResponse{ID: uuid.New().String(), RetryOf: taskID, Attempt: 2, OutputFormat: format, Status: string(models.StatusPending)}, nil
+				},
+			}
+			handler := newTestTaskHandler(t, mockService, nil)
+
+			req := httptest.NewRequest("POST", "/tasks/"+tt.taskID+"/retry", strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.taskID)
+			rec := httptest.NewRecorder()
+
+			handler.Retry(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusAccepted {
+				var resp dto.TaskResponse
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatal(err)
+				}
+				if resp.RetryOf != tt.taskID {
+					t.Errorf("Expected retry_of %s, got %s", tt.taskID, resp.RetryOf)
+				}
+				if resp.OutputFormat != tt.wantFormat {
+					t.Errorf("Expected output format %s, got %s", tt.wantFormat, resp.OutputFormat)
+				}
+			}
+		})
+	}
+}
+
+func TestTaskHandler_Scheduled(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantLimit  int
+	}{
+		{name: "default limit", wantStatus: http.StatusOK, wantLimit: defaultScheduledLimit},
+		{name: "custom limit", query: "?limit=10", wantStatus: http.StatusOK, wantLimit: 10},
+		{name: "limit too large", query: "?limit=1000", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotLimit int
+			runAt := "2030-01-01T00:00:00Z"
+			mockService := &mockTaskService{
+				scheduledFunc: func(ctx context.Context, limit int) (*dto.TaskListResponse, error) {
+					gotLimit = limit
+					return &dto.TaskListResponse{Tasks: []*dto.TaskResponse{
+						{ID: uuid.New().String(), Status: string(models.StatusScheduled), RunAt: &runAt},
+					}}, nil
+				},
+			}
+			handler := newTestTaskHandler(t, mockService, nil)
+
+			req := httptest.NewRequest("GET", "/tasks/scheduled"+tt.query, nil)
+			rec := httptest.NewRecorder()
+
+			handler.Scheduled(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if gotLimit != tt.wantLimit {
+				t.Errorf("Expected limit %d, got %d", tt.wantLimit, gotLimit)
+			}
+
+			var resp dto.TaskListResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Tasks) != 1 || resp.Tasks[0].RunAt == nil || *resp.Tasks[0].RunAt != runAt {
+				t.Errorf("Unexpected tasks %+v", resp.Tasks)
+			}
+		})
+	}
+}
+
+func TestTaskHandler_Compare_MissingFiles(t *testing.T) {
+	handler := newTestTaskHandler(t, &mockTaskService{}, nil)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("normalize", "true")
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/compare", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	rec := httptest.NewRecorder()
+
+	handler.Compare(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+}
+
+func newCompareRequest(t *testing.T, reference, candidate string, referenceBody, candidateBody []byte) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, f := range []struct {
+		field, name string
+		content     []byte
+	}{{"reference", reference, referenceBody}, {"candidate", candidate, candidateBody}} {
+		part, err := writer.CreateFormFile(f.field, f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(f.content)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/compare", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestTaskHandler_Compare_SameFilename(t *testing.T) {
+	var created *dto.CreateTaskRequest
+	mockService := &mockTaskService{
+		createTaskFunc: func(ctx context.Context, traceID string, req *dto.CreateTaskRequest) (*dto.TaskResponse, error) {
+			created = req
+			return &dto.TaskResponse{ID: uuid.New().String(), Status: string(models.StatusPending)}, nil
+		},
+	}
+	files := newTestStorage(t)
+	handler := newTestTaskHandler(t, mockService, files)
+
+	// Both sides are commonly exported under the same name.
+	reference := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{1}, 60)...)
+	candidate := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{2}, 60)...)
+	rec := httptest.NewRecorder()
+
+	handler.Compare(rec, newCompareRequest(t, "scan.jpg", "scan.jpg", reference, candidate))
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var options dto.CompareOptions
+	if err := json.Unmarshal(created.Options, &options); err != nil {
+		t.Fatal(err)
+	}
+	if created.FilePath == options.CandidatePath {
+		t.Fatalf("Expected separate files, both stored at %s", created.FilePath)
+	}
+	for path, want := range map[string][]byte{created.FilePath: reference, options.CandidatePath: candidate} {
+		body, _, err := files.Get(context.Background(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(body)
+		body.Close()
+		if !bytes.Equal(got, want) {
+			t.Errorf("Unexpected contents at %s", path)
+		}
+	}
+}
+
+func TestTaskHandler_Compare_RejectedFilesReleased(t *testing.T) {
+	jpeg := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{0}, 60)...)
+	pdf := []byte("%PDF-1.4\n%test\n")
+
+	tests := []struct {
+		name      string
+		service   *mockTaskService
+		wantCode  int
+		candidate string
+		content   []byte
+	}{
+		{"not an image", &mockTaskService{}, http.StatusBadRequest, "candidate.pdf", pdf},
+		{"task not created", &mockTaskService{
+			createTaskFunc: func(ctx context.Context, traceID string, req *dto.CreateTaskRequest) (*dto.TaskResponse, error) {
+				return nil, errors.New("database is down")
+			},
+		}, http.StatusInternalServerError, "candidate.jpg", jpeg},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := newTestStorage(t)
+			handler := newTestTaskHandler(t, tt.service, files)
+
+			rec := httptest.NewRecorder()
+
+			handler.Compare(rec, newCompareRequest(t, "reference.jpg", tt.candidate, jpeg, tt.content))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantCode, rec.Code, rec.Body.String())
+			}
+			stored, err := files.List(context.Background(), "blobs/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stored) != 0 {
+				t.Errorf("Expected both files to be released, found %+v", stored)
+			}
+		})
+	}
+}
+
+func TestTaskHandler_ContactSheet_FromTaskIDs(t *testing.T) {
+
+	var created *dto.CreateTaskRequest
+	mockService := &mockTaskService{
+		createTaskFunc: func(ctx context.Context, traceID string, req *dto.CreateTaskRequest) (*dto.TaskResponse, error) {
+			created = req
+			return &dto.TaskResponse{ID: uuid.New().String(), Status: string(models.StatusPending)}, nil
+		},
+	}
+	handler := newTestTaskHandler(t, mockService, nil)
+
+	first, second := uuid.New().String(), uuid.New().String()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("task_ids", first+","+second)
+	writer.WriteField("columns", "2")
+	writer.WriteField("fit", "cover")
+	writer.WriteField("output_format", "png")
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/contact-sheet", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	rec := httptest.NewRecorder()
+
+	handler.ContactSheet(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", rec.Code)
+	}
+	if created.Type != string(models.TaskTypeContactSheet) || created.OutputFormat != "png" {
+		t.Errorf("Unexpected task request: type %q, format %q", created.Type, created.OutputFormat)
+	}
+
+	var opts dto.ContactSheetOptions
+	if err := json.Unmarshal(created.Options, &opts); err != nil {
+		t.Fatalf("Failed to decode options: %v", err)
+	}
+	if len(opts.Sources) != 2 || opts.Columns != 2 || opts.Fit != "cover" || opts.Background != "#ffffff" {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+}
+
+func TestTaskHandler_ContactSheet_InvalidOptions(t *testing.T) {
+	handler := newTestTaskHandler(t, &mockTaskService{}, nil)
+
+	tests := map[string]string{
+		"columns":    "0",
+		"background": "red",
+		"fit":        "zoom",
+	}
+
+	for field, value := range tests {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		writer.WriteField("task_ids", uuid.New().String())
+		writer.WriteField(field, value)
+		writer.Close()
+
+		req := httptest.NewRequest("POST", "/contact-sheet", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		rec := httptest.NewRecorder()
+
+		handler.ContactSheet(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s=%s: expected status 400, got %d", field, value, rec.Code)
+		}
+	}
+}
+
+func TestTaskHandler_Tile_InvalidName(t *testing.T) {
+	handler := newTestTaskHandler(t, &mockTaskService{}, nil)
+	taskID := uuid.New().String()
+
+	req := httptest.NewRequest("GET", "/tasks/"+taskID+"/tiles_files/3/..%2F..%2Fsecret", nil)
+	req.SetPathValue("id", taskID)
+	req.SetPathValue("level", "3")
+	req.SetPathValue("tile", "../../secret")
+
+	rec := httptest.NewRecorder()
+
+	handler.Tile(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestTaskHandler_Tile_NotReady(t *testing.T) {
+	taskID := uuid.New().String()
+
+	mockService := &mockTaskService{
+		getTaskFunc: func(ctx context.Context, id string) (*dto.TaskResponse, error) {
+			return &dto.TaskResponse{
+				ID:     id,
+				Type:   string(models.TaskTypeTiles),
+				Status: string(models.StatusProcessing),
+			}, nil
+		},
+	}
+	handler := newTestTaskHandler(t, mockService, nil)
+
+	req := httptest.NewRequest("GET", "/tasks/"+taskID+"/tiles_files/0/0_0.jpg", nil)
+	req.SetPathValue("id", taskID)
+	req.SetPathValue("level", "0")
+	req.SetPathValue("tile", "0_0.jpg")
+
+	rec := httptest.NewRecorder()
+
+	handler.Tile(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", rec.Code)
+	}
+}
+
+func TestTaskHandler_Tile_Success(t *testing.T) {
+	taskID := uuid.New().String()
+	files := newTestStorage(t)
+	if err := files.Put(context.Background(), taskID+"_files/2/1_0.jpg", strings.NewReader("tile"), 4); err != nil {
+		t.Fatal(err)
+	}
+
+	mockService := &mockTaskService{
+		getTaskFunc: func(ctx context.Context, id string) (*dto.TaskResponse, error) {
+			return &dto.TaskResponse{
+				ID:     id,
+				Type:   string(models.TaskTypeTiles),
+				Status: string(models.StatusCompleted),
+			}, nil
+		},
+	}
+	handler := newTestTaskHandler(t, mockService, files)
+
+	req := httptest.NewRequest("GET", "/tasks/"+taskID+"/tiles_files/2/1_0.jpg", nil)
+	req.SetPathValue("id", taskID)
+	req.SetPathValue("level", "2")
+	req.SetPathValue("tile", "1_0.jpg")
+
+	rec := httptest.NewRecorder()
+
+	handler.Tile(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if rec.Body.String() != "tile" || rec.Header().Get("Content-Type") != "image/jpeg" {
+		t.Errorf("Unexpected tile %q (%s)", rec.Body.String(), rec.Header().Get("Content-Type"))
+	}
+
+	req = httptest.NewRequest("GET", "/tasks/"+taskID+"/tiles_files/2/9_9.jpg", nil)
+	req.SetPathValue("id", taskID)
+	req.SetPathValue("level", "2")
+	req.SetPathValue("tile", "9_9.jpg")
+
+	rec = httptest.NewRecorder()
+
+	handler.Tile(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing tile, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/middleware"
+	"mediaConverter/api/models"
+	"mediaConverter/api/validation"
+)
+
+var tileNamePattern = regexp.MustCompile(`^[0-9]+_[0-9]+\.(jpg|png)$`)
+
+// Tiles handles Deep Zoom tile pyramid requests.
+//
+//	@Summary		Generate a Deep Zoom tile pyramid
+//	@Description	Upload a high-resolution image to slice into a DZI tile pyramid. The output is a ZIP with the descriptor and tiles; tiles are also served individually.
+//	@Tags			tiles
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			file		formData	file	true	"Image to slice"
+//	@Param			tile_size	formData	int		false	"Tile size in pixels (64-2048, default 254)"
+//	@Param			overlap		formData	int		false	"Tile overlap in pixels (0-16, default 1)"
+//	@Param			format		formData	string	false	"Tile format (jpg, png; default jpg)"
+//	@Success		201			{object}	dto.TaskResponse
+//	@Failure		400			{object}	dto.ErrorResponse
+//	@Failure		500			{object}	dto.ErrorResponse
+//	@Router			/tiles [post]
+func (h *TaskHandler) Tiles(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	form, err := h.readForm(r, 1, "file")
+	if err != nil {
+		h.handleRequestError(w, err, traceID)
+		return
+	}
+
+	stored := form.File("file")
+	if stored == nil {
+		h.handleError(w, "Failed to get file", http.ErrMissingFile, traceID, http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseTileOptions(form.Values)
+	if err != nil {
+		h.releaseFiles(r.Context(), stored)
+		h.handleRequestError(w, err, traceID)
+		return
+	}
+	if !validation.IsAllowedImageType(stored.Type) {
+		h.releaseFiles(r.Context(), stored)
+		h.handleError(w, "Only images can be tiled", validation.ErrUnsupportedFormat, traceID, http.StatusBadRequest)
+		return
+	}
+
+	options, err := json.Marshal(opts)
+	if err != nil {
+		h.releaseFiles(r.Context(), stored)
+		h.handleError(w, "Failed to create task", err, traceID, http.StatusInternalServerError)
+		return
+	}
+
+	req := &dto.CreateTaskRequest{
+		Type:             string(models.TaskTypeTiles),
+		OriginalFilename: stored.Filename,
+		FilePath:         stored.Key,
+		OutputFormat:     "zip",
+		Options:          options,
+		SourceHash:       stored.Hash,
+	}
+
+	resp, err := h.service.CreateTask(r.Context(), traceID, req)
+	if err != nil {
+		h.releaseFiles(r.Context(), stored)
+		h.handleError(w, "Failed to create task", err, traceID, http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("Tile pyramid requested",
+		zap.String("trace_id", traceID),
+		zap.String("task_id", resp.ID),
+		zap.String("filename", stored.Filename),
+	)
+
+	h.respondJSON(w, http.StatusCreated, resp)
+}
+
+func parseTileOptions(values url.Values) (*dto.TileOptions, error) {
+	opts := &dto.TileOptions{Format: "jpg"}
+
+	var err error
+	if opts.TileSize, err = formInt(values, "tile_size", 254, 64, 2048); err != nil {
+		return nil, err
+	}
+	if opts.Overlap, err = formInt(values, "overlap", 1, 0, 16); err != nil {
+		return nil, err
+	}
+	if format := values.Get("format"); format != "" {
+		if format != "jpg" && format != "png" {
+			return nil, &requestError{"Invalid format: expected jpg or png", http.StatusBadRequest, nil}
+		}
+		opts.Format = format
+	}
+
+	return opts, nil
+}
+
+// TileDescriptor serves the DZI descriptor of a completed tiles task.
+//
+//	@Summary		Get the DZI descriptor
+//	@Tags			tiles
+//	@Produce		xml
+//	@Param			id	path	string	true	"Task ID"
+//	@Success		200
+//	@Failure		404	{object}	dto.ErrorResponse
+//	@Failure		409	{object}	dto.ErrorResponse
+//	@Router			/tasks/{id}/tiles.dzi [get]
+func (h *TaskHandler) TileDescriptor(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	task, err := h.completedTilesTask(r)
+	if err != nil {
+		h.handleRequestError(w, err, traceID)
+		return
+	}
+
+	h.serveFile(w, r, tilesOutputID(task)+".dzi", traceID)
+}
+
+// Tile serves a single tile of a completed tiles task. The path mirrors the
+// DZI convention, so viewers such as OpenSeadragon can open
+// /tasks/{id}/tiles.dzi directly.
+//
+//	@Summary		Get a single tile
+//	@Tags			tiles
+//	@Produce		jpeg,png
+//	@Param			id		path	string	true	"Task ID"
+//	@Param			level	path	int		true	"Pyramid level"
+//	@Param			tile	path	string	true	"Tile name, <col>_<row>.<format>"
+//	@Success		200
+//	@Failure		404	{object}	dto.ErrorResponse
+//	@Failure		409	{object}	dto.ErrorResponse
+//	@Router			/tasks/{id}/tiles_files/{level}/{tile} [get]
+func (h *TaskHandler) Tile(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	level, err := strconv.Atoi(r.PathValue("level"))
+	if err != nil || level < 0 || !tileNamePattern.MatchString(r.PathValue("tile")) {
+		h.handleError(w, "Tile not found", err, traceID, http.StatusNotFound)
+		return
+	}
+
+	task, err := h.completedTilesTask(r)
+	if err != nil {
+		h.handleRequestError(w, err, traceID)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=86400, immutable")
+	h.serveFile(w, r, path.Join(tilesOutputID(task)+"_files", strconv.Itoa(level), r.PathValue("tile")), traceID)
+}
+
+func (h *TaskHandler) completedTilesTask(r *http.Request) (*dto.TaskResponse, error) {
+	taskID := r.PathValue("id")
+	if _, err := uuid.Parse(taskID); err != nil {
+		return nil, &requestError{"Task not found", http.StatusNotFound, err}
+	}
+
+	task, err := h.service.GetTaskStatus(r.Context(), taskID)
+	if err != nil {
+		if errors.Is(err, dto.ErrTaskNotFound) {
+			return nil, &requestError{"Task not found", http.StatusNotFound, err}
+		}
+		return nil, err
+	}
+
+	if task.Type != string(models.TaskTypeTiles) {
+		return nil, &requestError{"Task has no tiles", http.StatusNotFound, nil}
+	}
+	if task.Status != string(models.StatusCompleted) {
+		return nil, &requestError{"Tiles are not ready yet", http.StatusConflict, nil}
+	}
+
+	return task, nil
+}
+
+// tilesOutputID returns the ID the pyramid is stored under, which is another
+// task's when the result was reused.
+func tilesOutputID(task *dto.TaskResponse) string {
+	if task.DuplicateOf != "" {
+		return task.DuplicateOf
+	}
+	return task.ID
+}
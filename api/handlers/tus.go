@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/models"
+	"mediaConverter/api/tus"
+	"mediaConverter/api/validation"
+)
+
+// CheckMetadata validates the Upload-Metadata of a resumable upload, which
+// carries the same parameters as the /upload form.
+func (h *TaskHandler) CheckMetadata(metadata map[string]string) error {
+	_, err := uploadRequest(metadata)
+	return err
+}
+
+// CompleteUpload implements tus.Completer: it runs the /upload validation on
+// a finished resumable upload, stores it as a blob and creates its task.
+func (h *TaskHandler) CompleteUpload(ctx context.Context, upload *models.TusUpload, content io.Reader) (string, error) {
+	req, err := uploadRequest(upload.Metadata)
+	if err != nil {
+		return "", err
+	}
+
+	stored, err := h.saveFile(ctx, req.OriginalFilename, content)
+	if err != nil {
+		var reqErr *requestError
+		if errors.As(err, &reqErr) && reqErr.status == http.StatusBadRequest {
+			return "", fmt.Errorf("%w: %w", tus.ErrInvalidUpload, reqErr)
+		}
+		return "", err
+	}
+
+	req.FilePath = stored.Key
+	req.SourceHash = stored.Hash
+
+	resp, err := h.service.CreateTask(ctx, upload.TraceID, req)
+	if err != nil {
+		h.releaseFiles(ctx, stored)
+		return "", err
+	}
+
+	h.logger.Info("Resumable upload completed",
+		zap.String("trace_id", upload.TraceID),
+		zap.String("upload_id", upload.ID),
+		zap.String("task_id", resp.ID),
+		zap.String("filename", req.OriginalFilename),
+	)
+
+	return resp.ID, nil
+}
+
+// uploadRequest builds a convert task request from tus metadata.
+func uploadRequest(metadata map[string]string) (*dto.CreateTaskRequest, error) {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: "+format, append([]any{tus.ErrInvalidUpload}, args...)...)
+	}
+
+	filename := metadata["filename"]
+	if filename == "" {
+		return nil, invalid("filename metadata is required")
+	}
+	if _, ok := extensionTypes[strings.ToLower(filepath.Ext(filename))]; !ok {
+		return nil, fmt.Errorf("%w: %w", tus.ErrInvalidUpload, validation.ErrUnsupportedFormat)
+	}
+
+	req := &dto.CreateTaskRequest{
+		OriginalFilename: filename,
+		OutputFormat:     metadata["output_format"],
+		Crop:             metadata["crop"] == "true",
+		DuplicatePolicy:  metadata["duplicate_policy"],
+		Priority:         metadata["priority"],
+	}
+
+	if !validDuplicatePolicy(models.DuplicatePolicy(req.DuplicatePolicy)) {
+		return nil, invalid("invalid duplicate_policy")
+	}
+	if !validPriority(models.Priority(req.Priority)) {
+		return nil, invalid("invalid priority")
+	}
+	runAt, err := parseRunAt(metadata["run_at"])
+	if err != nil {
+		return nil, invalid("invalid run_at")
+	}
+	req.RunAt = runAt
+
+	for field, dest := range map[string]**int{"target_width": &req.TargetWidth, "target_height": &req.TargetHeight} {
+		value, ok := metadata[field]
+		if !ok || value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return nil, invalid("invalid %s", field)
+		}
+		*dest = &n
+	}
+
+	return req, nil
+}
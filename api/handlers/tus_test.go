@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/models"
+	"mediaConverter/api/tus"
+)
+
+func TestTaskHandler_CheckMetadata(t *testing.T) {
+	handler := newTestTaskHandler(t, &mockTaskService{}, nil)
+
+	valid := map[string]string{"filename": "a.PNG", "target_width": "300", "crop": "true", "duplicate_policy": "reuse"}
+	if err := handler.CheckMetadata(valid); err != nil {
+		t.Errorf("Expected valid metadata, got %v", err)
+	}
+
+	invalid := []map[string]string{
+		{},
+		{"filename": "a.exe"},
+		{"filename": "a.jpg", "target_width": "wide"},
+		{"filename": "a.jpg", "target_height": "-1"},
+		{"filename": "a.jpg", "duplicate_policy": "merge"},
+	}
+	for _, metadata := range invalid {
+		if err := handler.CheckMetadata(metadata); !errors.Is(err, tus.ErrInvalidUpload) {
+			t.Errorf("%v: expected ErrInvalidUpload, got %v", metadata, err)
+		}
+	}
+}
+
+func TestTaskHandler_CompleteUpload(t *testing.T) {
+	var created *dto.CreateTaskRequest
+	mockService := &mockTaskService{
+		createTaskFunc: func(ctx context.Context, traceID string, req *dto.CreateTaskRequest) (*dto.TaskResponse, error) {
+			created = req
+			return &dto.TaskResponse{ID: uuid.New().String(), Status: string(models.StatusPending)}, nil
+		},
+	}
+	handler := newTestTaskHandler(t, mockService, nil)
+
+	upload := &models.TusUpload{
+		ID:       uuid.New().String(),
+		TraceID:  uuid.New().String(),
+		Metadata: map[string]string{"filename": "photo.jpg", "target_width": "640"},
+	}
+	content := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10}
+
+	taskID, err := handler.CompleteUpload(context.Background(), upload, bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if taskID == "" || created == nil {
+		t.Fatal("Expected a task to be created")
+	}
+	if created.SourceHash == "" || created.TargetWidth == nil || *created.TargetWidth != 640 {
+		t.Errorf("Unexpected task request %+v", created)
+	}
+
+	upload.Metadata["filename"] = "photo.png"
+	if _, err := handler.CompleteUpload(context.Background(), upload, bytes.NewReader(content)); !errors.Is(err, tus.ErrInvalidUpload) {
+		t.Errorf("Expected mismatched content to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/middleware"
+	"mediaConverter/api/models"
+	"mediaConverter/api/validation"
+	"mediaConverter/worker/storage"
+)
+
+const presignTTL = 15 * time.Minute
+
+// PresignUpload starts a direct-to-storage upload.
+//
+//	@Summary		Start a direct upload
+//	@Description	Create a task awaiting its source and return a short-lived URL the client PUTs the file to, bypassing the API. Call POST /tasks/{id}/commit once the upload has finished.
+//	@Tags			tasks
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		dto.PresignUploadRequest	true	"File and conversion parameters"
+//	@Success		201		{object}	dto.PresignUploadResponse
+//	@Failure		400		{object}	dto.ErrorResponse
+//	@Failure		500		{object}	dto.ErrorResponse
+//	@Router			/uploads/presign [post]
+func (h *TaskHandler) PresignUpload(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	var body dto.PresignUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		h.handleError(w, "Invalid request body", err, traceID, http.StatusBadRequest)
+		return
+	}
+
+	fileType, ok := extensionTypes[strings.ToLower(filepath.Ext(body.Filename))]
+	if !ok {
+		h.handleError(w, "Invalid file", validation.ErrUnsupportedFormat, traceID, http.StatusBadRequest)
+		return
+	}
+	if body.Size <= 0 {
+		h.handleError(w, "Invalid size", nil, traceID, http.StatusBadRequest)
+		return
+	}
+	if body.Size > h.limits.MaxFileSize {
+		h.handleError(w, "Invalid file", validation.ErrFileTooLarge, traceID, http.StatusBadRequest)
+		return
+	}
+	if !validDuplicatePolicy(models.DuplicatePolicy(body.DuplicatePolicy)) {
+		h.handleError(w, "Invalid duplicate_policy", nil, traceID, http.StatusBadRequest)
+		return
+	}
+	if !validPriority(models.Priority(body.Priority)) {
+		h.handleError(w, "Invalid priority", nil, traceID, http.StatusBadRequest)
+		return
+	}
+
+	key := "uploads/" + uuid.New().String() + fileExtension(fileType)
+	uploadURL, err := h.files.Presign(r.Context(), http.MethodPut, key, presignTTL)
+	if err != nil {
+		h.handleError(w, "Failed to presign upload", err, traceID, http.StatusInternalServerError)
+		return
+	}
+
+	req := &dto.CreateTaskRequest{
+		OriginalFilename: body.Filename,
+		FilePath:         key,
+		OutputFormat:     body.OutputFormat,
+		TargetWidth:      body.TargetWidth,
+		TargetHeight:     body.TargetHeight,
+		Crop:             body.Crop,
+		DuplicatePolicy:  body.DuplicatePolicy,
+		Priority:         body.Priority,
+		RunAt:            body.RunAt,
+	}
+
+	task, err := h.service.CreatePendingUpload(r.Context(), traceID, req, body.Size)
+	if err != nil {
+		h.handleError(w, "Failed to create task", err, traceID, http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("Direct upload started",
+		zap.String("trace_id", traceID),
+		zap.String("task_id", task.ID),
+		zap.String("filename", body.Filename),
+		zap.Int64("size", body.Size),
+	)
+
+	h.respondJSON(w, http.StatusCreated, dto.PresignUploadResponse{
+		Task:      task,
+		UploadURL: uploadURL,
+		Method:    http.MethodPut,
+		ExpiresAt: time.Now().Add(presignTTL).UTC().Format("2006-01-02T15:04:05Z"),
+	})
+}
+
+// CommitUpload verifies a direct upload and queues its task.
+//
+//	@Summary		Finish a direct upload
+//	@Description	Copy the object uploaded to the presigned URL into the blob store, check its size and magic bytes and enqueue the task. The uploaded object is deleted either way; after a rejection the client may upload again while the URL is valid.
+//	@Tags			tasks
+//	@Produce		json
+//	@Param			id	path		string	true	"Task ID"
+//	@Success		202	{object}	dto.TaskResponse
+//	@Failure		400	{object}	dto.ErrorResponse
+//	@Failure		404	{object}	dto.ErrorResponse
+//	@Failure		409	{object}	dto.ErrorResponse
+//	@Router			/tasks/{id}/commit [post]
+func (h *TaskHandler) CommitUpload(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	taskID := r.PathValue("id")
+	if _, err := uuid.Parse(taskID); err != nil {
+		h.handleError(w, "Task not found", err, traceID, http.StatusNotFound)
+		return
+	}
+
+	pending, err := h.service.GetPendingUpload(r.Context(), taskID)
+	if err != nil {
+		h.handleUploadError(w, err, traceID)
+		return
+	}
+
+	stored, err := h.claimUpload(r.Context(), pending)
+	if err != nil {
+		h.handleRequestError(w, err, traceID)
+		return
+	}
+
+	resp, err := h.service.CommitUpload(r.Context(), taskID, stored.Key, stored.Hash)
+	if err != nil {
+		h.releaseFiles(r.Context(), stored)
+		h.handleUploadError(w, err, traceID)
+		return
+	}
+
+	h.logger.Info("Direct upload committed",
+		zap.String("trace_id", traceID),
+		zap.String("task_id", taskID),
+		zap.String("hash", stored.Hash),
+	)
+
+	h.respondJSON(w, http.StatusAccepted, resp)
+}
+
+// claimUpload copies a direct upload into the blob store and verifies the
+// copy. The presigned URL stays valid after the commit, so the task must not
+// read the key the client can still write to; the client's object is deleted
+// once copied.
+func (h *TaskHandler) claimUpload(ctx context.Context, pending *dto.PendingUpload) (*storedFile, error) {
+	info, err := h.files.Stat(ctx, pending.Key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, &requestError{"File has not been uploaded yet", http.StatusConflict, err}
+		}
+		return nil, err
+	}
+	if info.Size > h.limits.MaxFileSize {
+		h.deleteUpload(ctx, pending.Key)
+		return nil, &requestError{"Invalid file", http.StatusBadRequest, validation.ErrFileTooLarge}
+	}
+
+	body, _, err := h.files.Get(ctx, pending.Key)
+	if err != nil {
+		return nil, err
+	}
+	fileType := extensionTypes[strings.ToLower(filepath.Ext(pending.Filename))]
+	// The object may be replaced between Stat and Get, so the copy is
+	// bounded and checked on its own.
+	blob, err := h.blobs.Save(ctx, io.LimitReader(body, h.limits.MaxFileSize+1), fileExtension(fileType))
+	body.Close()
+	if err != nil {
+		return nil, err
+	}
+	h.deleteUpload(ctx, pending.Key)
+
+	stored := &storedFile{Filename: pending.Filename, Type: fileType, Blob: blob}
+	if err := h.verifyUpload(ctx, pending, stored); err != nil {
+		h.releaseFiles(ctx, stored)
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+// verifyUpload checks the stored copy of a direct upload against what was
+// announced when the URL was presigned. Only the first bytes are read.
+func (h *TaskHandler) verifyUpload(ctx context.Context, pending *dto.PendingUpload, stored *storedFile) error {
+	if stored.Size > h.limits.MaxFileSize {
+		return &requestError{"Invalid file", http.StatusBadRequest, validation.ErrFileTooLarge}
+	}
+	if stored.Size != pending.Size {
+		return &requestError{"Uploaded size does not match the announced size", http.StatusBadRequest, nil}
+	}
+
+	body, _, err := h.files.Get(ctx, stored.Key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+
+	fileType, err := validation.DetectBytes(head[:n])
+	if err != nil {
+		return &requestError{"Invalid file", http.StatusBadRequest, err}
+	}
+	if fileType != stored.Type {
+		return &requestError{"Invalid file", http.StatusBadRequest, validation.ErrExtensionMismatch}
+	}
+
+	return nil
+}
+
+// deleteUpload removes the object a client uploaded to a presigned URL.
+func (h *TaskHandler) deleteUpload(ctx context.Context, key string) {
+	if err := h.files.Delete(context.WithoutCancel(ctx), key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		h.logger.Warn("Failed to delete direct upload", zap.String("key", key), zap.Error(err))
+	}
+}
+
+func (h *TaskHandler) handleUploadError(w http.ResponseWriter, err error, traceID string) {
+	switch {
+	case errors.Is(err, dto.ErrTaskNotFound):
+		h.handleError(w, "Task not found", err, traceID, http.StatusNotFound)
+	case errors.Is(err, dto.ErrUploadNotReady):
+		h.handleError(w, "Task is not awaiting an upload", err, traceID, http.StatusConflict)
+	default:
+		h.handleError(w, "Failed to commit upload", err, traceID, http.StatusInternalServerError)
+	}
+}
+
+// parseRunAt reads the run_at parameter of a form or metadata, an RFC 3339
+// time; empty means right away.
+func parseRunAt(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func validPriority(priority models.Priority) bool {
+	switch priority {
+	case "", models.PriorityInteractive, models.PriorityNormal, models.PriorityBulk:
+		return true
+	default:
+		return false
+	}
+}
+
+func validDuplicatePolicy(policy models.DuplicatePolicy) bool {
+	switch policy {
+	case "", models.DuplicatePolicyAllow, models.DuplicatePolicyReject, models.DuplicatePolicyReuse:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/models"
+)
+
+func TestTaskHandler_PresignUpload(t *testing.T) {
+	files := newTestStorage(t)
+	handler := newTestTaskHandler(t, &mockTaskService{}, files)
+
+	body := `{"filename": "photo.JPG", "size": 1024, "output_format": "png"}`
+	req := httptest.NewRequest("POST", "/uploads/presign", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	handler.PresignUpload(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp dto.PresignUploadResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Method != http.MethodPut || resp.Task.Status != string(models.StatusAwaitingUpload) {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+
+	u, err := url.Parse(resp.UploadURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := strings.TrimPrefix(u.Path, "/files/")
+	if !strings.HasPrefix(key, "uploads/") || !strings.HasSuffix(key, ".jpg") {
+		t.Errorf("Unexpected upload key %s", key)
+	}
+	if err := files.VerifyPresigned(http.MethodPut, key, u.Query()); err != nil {
+		t.Errorf("Expected a valid PUT URL: %v", err)
+	}
+}
+
+func TestTaskHandler_PresignUpload_Invalid(t *testing.T) {
+	handler := newTestTaskHandler(t, &mockTaskService{}, nil)
+
+	bodies := []string{
+		`not json`,
+		`{"filename": "movie.exe", "size": 10}`,
+		`{"filename": "photo.jpg", "size": 0}`,
+		`{"filename": "photo.jpg", "size": 209715200}`,
+		`{"filename": "photo.jpg", "size": 10, "duplicate_policy": "merge"}`,
+	}
+	for _, body := range bodies {
+		req := httptest.NewRequest("POST", "/uploads/presign", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		handler.PresignUpload(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, rec.Code)
+		}
+	}
+}
+
+func TestTaskHandler_CommitUpload(t *testing.T) {
+	jpeg := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{0}, 60)...)
+	png := []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}
+
+	tests := []struct {
+		name       string
+		content    []byte
+		size       int64
+		wantStatus int
+		committed  bool
+	}{
+		{"valid", jpeg, int64(len(jpeg)), http.StatusAccepted, true},
+		{"size mismatch", jpeg, 10, http.StatusBadRequest, false},
+		{"wrong content", png, int64(len(png)), http.StatusBadRequest, false},
+		{"not uploaded", nil, 10, http.StatusConflict, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := newTestStorage(t)
+			taskID := uuid.New().String()
+			key := "uploads/" + taskID + ".jpg"
+			if tt.content != nil {
+				if err := files.Put(context.Background(), key, bytes.NewReader(tt.content), int64(len(tt.content))); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var committedPath string
+			mockService := &mockTaskService{
+				pendingFunc: func(ctx context.Context, id string) (*dto.PendingUpload, error) {
+					return &dto.PendingUpload{TaskID: id, Key: key, Filename: "photo.jpg", Size: tt.size}, nil
+				},
+				commitFunc: func(ctx context.Context, id, filePath, sourceHash string) (*dto.TaskResponse, error) {
+					committedPath = filePath
+					return &dto.TaskResponse{ID: id, Status: string(models.StatusPending)}, nil
+				},
+			}
+			handler := newTestTaskHandler(t, mockService, files)
+
+			req := httptest.NewRequest("POST", "/tasks/"+taskID+"/commit", nil)
+			req.SetPathValue("id", taskID)
+			rec := httptest.NewRecorder()
+
+			handler.CommitUpload(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if (committedPath != "") != tt.committed {
+				t.Errorf("Expected committed=%t", tt.committed)
+			}
+			if _, err := files.Stat(context.Background(), key); err == nil {
+				t.Error("Expected the uploaded object to be deleted")
+			}
+			if !tt.committed {
+				return
+			}
+
+			if !strings.HasPrefix(committedPath, "blobs/") || !strings.HasSuffix(committedPath, ".jpg") {
+				t.Errorf("Expected the task to read a blob, got %s", committedPath)
+			}
+
+			// The presigned URL is still valid; a later upload must not
+			// reach the committed source.
+			if err := files.Put(context.Background(), key, bytes.NewReader(png), int64(len(png))); err != nil {
+				t.Fatal(err)
+			}
+			body, _, err := files.Get(context.Background(), committedPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer body.Close()
+			got, _ := io.ReadAll(body)
+			if !bytes.Equal(got, tt.content) {
+				t.Error("Committed source changed after a later upload")
+			}
+		})
+	}
+}
+
+func TestTaskHandler_CommitUpload_NotAwaiting(t *testing.T) {
+	mockService := &mockTaskService{
+		pendingFunc: func(ctx context.Context, id string) (*dto.PendingUpload, error) {
+			return nil, dto.ErrUploadNotReady
+		},
+	}
+	handler := newTestTaskHandler(t, mockService, nil)
+	taskID := uuid.New().String()
+
+	req := httptest.NewRequest("POST", "/tasks/"+taskID+"/commit", nil)
+	req.SetPathValue("id", taskID)
+	rec := httptest.NewRecorder()
+
+	handler.CommitUpload(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", rec.Code)
+	}
+}
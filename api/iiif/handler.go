@@ -0,0 +1,354 @@
+package iiif
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/middleware"
+	"mediaConverter/api/rendercache"
+	"mediaConverter/worker/converter"
+	"mediaConverter/worker/storage"
+)
+
+const (
+	contextURL  = "http://iiif.io/api/image/3/context.json"
+	profileLink = `<http://iiif.io/api/image/3/level2.json>;rel="profile"`
+	tileSize    = 512
+)
+
+type SourceResolver interface {
+	GetSourceFiles(ctx context.Context, taskIDs []string) ([]dto.SourceFile, error)
+}
+
+type Handler struct {
+	sources   SourceResolver
+	files     storage.Backend
+	cache     *rendercache.Cache
+	converter *converter.Converter
+	logger    *zap.Logger
+}
+
+func NewHandler(sources SourceResolver, files storage.Backend, cache *rendercache.Cache, logger *zap.Logger) *Handler {
+	return &Handler{
+		sources:   sources,
+		files:     files,
+		cache:     cache,
+		converter: converter.NewConverter(logger),
+		logger:    logger,
+	}
+}
+
+type infoResponse struct {
+	Context        string   `json:"@context"`
+	ID             string   `json:"id"`
+	Type           string   `json:"type"`
+	Protocol       string   `json:"protocol"`
+	Profile        string   `json:"profile"`
+	Width          int      `json:"width"`
+	Height         int      `json:"height"`
+	MaxWidth       int      `json:"maxWidth"`
+	MaxHeight      int      `json:"maxHeight"`
+	MaxArea        int      `json:"maxArea"`
+	Tiles          []tiles  `json:"tiles"`
+	ExtraQualities []string `json:"extraQualities"`
+	ExtraFormats   []string `json:"extraFormats"`
+	ExtraFeatures  []string `json:"extraFeatures"`
+}
+
+type tiles struct {
+	Width        int   `json:"width"`
+	ScaleFactors []int `json:"scaleFactors"`
+}
+
+// Redirect sends clients requesting the bare image URI to its info.json.
+//
+//	@Summary		IIIF image base URI
+//	@Tags			iiif
+//	@Param			id	path	string	true	"Task ID"
+//	@Success		303
+//	@Router			/iiif/{id} [get]
+func (h *Handler) Redirect(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, r.URL.Path+"/info.json", http.StatusSeeOther)
+}
+
+// Info returns the IIIF Image API 3.0 image information document.
+//
+//	@Summary		IIIF image information
+//	@Description	Image information for the source file of a task, as defined by the IIIF Image API 3.0.
+//	@Tags			iiif
+//	@Produce		json
+//	@Param			id	path		string	true	"Task ID"
+//	@Success		200	{object}	infoResponse
+//	@Failure		404	{object}	dto.ErrorResponse
+//	@Router			/iiif/{id}/info.json [get]
+func (h *Handler) Info(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+	h.setCommonHeaders(w)
+
+	taskID := r.PathValue("id")
+	source, err := h.resolve(r.Context(), taskID)
+	if err != nil {
+		h.handleResolveError(w, err, traceID)
+		return
+	}
+
+	info := infoResponse{
+		Context:        contextURL,
+		ID:             baseURL(r) + "/iiif/" + taskID,
+		Type:           "ImageService3",
+		Protocol:       "http://iiif.io/api/image",
+		Profile:        "level2",
+		Width:          source.width,
+		Height:         source.height,
+		MaxWidth:       MaxDimension,
+		MaxHeight:      MaxDimension,
+		MaxArea:        MaxArea,
+		Tiles:          []tiles{{Width: tileSize, ScaleFactors: scaleFactors(source.width, source.height)}},
+		ExtraQualities: []string{QualityColor, QualityGray, QualityBitonal},
+		ExtraFormats:   []string{"gif"},
+		ExtraFeatures:  []string{"mirroring", "rotationArbitrary", "sizeUpscaling", "regionSquare"},
+	}
+
+	contentType := "application/json"
+	if strings.Contains(r.Header.Get("Accept"), "application/ld+json") {
+		contentType = `application/ld+json;profile="` + contextURL + `"`
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(info)
+}
+
+// Image renders a region of a task's source image.
+//
+//	@Summary		IIIF image request
+//	@Description	Render {region}/{size}/{rotation}/{quality}.{format} of the task's source image as defined by the IIIF Image API 3.0. Results are cached on disk.
+//	@Tags			iiif
+//	@Produce		jpeg,png,gif
+//	@Param			id			path	string	true	"Task ID"
+//	@Param			region		path	string	true	"full, square, x,y,w,h or pct:x,y,w,h"
+//	@Param			size		path	string	true	"max, w,, ,h, pct:n, w,h or !w,h, optionally prefixed with ^"
+//	@Param			rotation	path	string	true	"Degrees clockwise, optionally prefixed with ! to mirror"
+//	@Param			file		path	string	true	"{quality}.{format}: default, color, gray or bitonal; jpg, png or gif"
+//	@Success		200
+//	@Failure		400	{object}	dto.ErrorResponse
+//	@Failure		404	{object}	dto.ErrorResponse
+//	@Router			/iiif/{id}/{region}/{size}/{rotation}/{file} [get]
+func (h *Handler) Image(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+	h.setCommonHeaders(w)
+
+	taskID := r.PathValue("id")
+	source, err := h.resolve(r.Context(), taskID)
+	if err != nil {
+		h.handleResolveError(w, err, traceID)
+		return
+	}
+
+	req, err := ParseImageRequest(r.PathValue("region"), r.PathValue("size"), r.PathValue("rotation"), r.PathValue("file"), source.width, source.height)
+	if err != nil {
+		h.handleError(w, err.Error(), err, traceID, http.StatusBadRequest)
+		return
+	}
+
+	key := rendercache.Key("iiif", taskID, source.key,
+		req.Region.String(), fmt.Sprintf("%dx%d", req.Width, req.Height),
+		fmt.Sprintf("%t:%g", req.Mirror, req.Rotation), req.Quality, req.Format)
+
+	file, err := h.cache.Open(key)
+	if os.IsNotExist(err) {
+		err = h.cache.Put(key, func(out io.Writer) error {
+			return h.render(r.Context(), source.key, req, out)
+		})
+		if err != nil {
+			h.handleError(w, "Failed to render image", err, traceID, http.StatusInternalServerError)
+			return
+		}
+		file, err = h.cache.Open(key)
+	}
+	if err != nil {
+		h.handleError(w, "Failed to read rendered image", err, traceID, http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		h.handleError(w, "Failed to read rendered image", err, traceID, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType(req.Format))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(w, r, "", stat.ModTime(), file)
+}
+
+// render is only reached on a cache miss, so the source is fetched from
+// storage here rather than for every tile.
+func (h *Handler) render(ctx context.Context, key string, req *ImageRequest, out io.Writer) error {
+	path, cleanup, err := storage.FetchTemp(ctx, h.files, key)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	src, err := h.converter.Open(path)
+	if err != nil {
+		return err
+	}
+
+	var img image.Image = src
+	if req.Region != src.Bounds() {
+		img = imaging.Crop(img, req.Region)
+	}
+	if req.Width != req.Region.Dx() || req.Height != req.Region.Dy() {
+		img = imaging.Resize(img, req.Width, req.Height, imaging.Lanczos)
+	}
+	if req.Mirror {
+		img = imaging.FlipH(img)
+	}
+	if req.Rotation != 0 {
+		img = converter.Rotate(img, req.Rotation)
+	}
+
+	switch req.Quality {
+	case QualityGray:
+		img = imaging.Grayscale(img)
+	case QualityBitonal:
+		img = converter.Bitonal(img)
+	}
+
+	return h.converter.Encode(out, img, req.Format, 0)
+}
+
+// source is a task's source image: its storage key and dimensions.
+type source struct {
+	key    string
+	width  int
+	height int
+}
+
+// errUnreadableSource marks a source whose image header cannot be decoded.
+var errUnreadableSource = errors.New("source is not a readable image")
+
+func (h *Handler) resolve(ctx context.Context, taskID string) (*source, error) {
+	if _, err := uuid.Parse(taskID); err != nil {
+		return nil, dto.ErrTaskNotFound
+	}
+
+	sources, err := h.sources.GetSourceFiles(ctx, []string{taskID})
+	if err != nil {
+		return nil, err
+	}
+
+	key := sources[0].Path
+	width, height, err := h.sourceSize(ctx, taskID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &source{key: key, width: width, height: height}, nil
+}
+
+// sourceSize returns the dimensions of the image stored at key. They are
+// kept in the render cache next to the tiles, so only the first request for
+// a task reads the source, and then only as far as its header.
+func (h *Handler) sourceSize(ctx context.Context, taskID, key string) (int, int, error) {
+	cacheKey := rendercache.Key("iiif", taskID, key, "size")
+
+	if file, err := h.cache.Open(cacheKey); err == nil {
+		defer file.Close()
+		var width, height int
+		if _, err := fmt.Fscanf(file, "%d %d", &width, &height); err == nil {
+			return width, height, nil
+		}
+	}
+
+	body, _, err := h.files.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return 0, 0, fmt.Errorf("%w: %w", dto.ErrTaskNotFound, err)
+		}
+		return 0, 0, err
+	}
+	defer body.Close()
+
+	cfg, _, err := image.DecodeConfig(body)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %w", errUnreadableSource, err)
+	}
+
+	err = h.cache.Put(cacheKey, func(out io.Writer) error {
+		_, err := fmt.Fprintf(out, "%d %d", cfg.Width, cfg.Height)
+		return err
+	})
+	if err != nil {
+		h.logger.Warn("Failed to cache source size", zap.String("task_id", taskID), zap.Error(err))
+	}
+
+	return cfg.Width, cfg.Height, nil
+}
+
+// scaleFactors lists the power-of-two reductions at which the whole image
+// still spans more than one tile.
+func scaleFactors(width, height int) []int {
+	factors := []int{1}
+	for f := 2; max(width, height)/(f/2) > tileSize; f *= 2 {
+		factors = append(factors, f)
+	}
+	return factors
+}
+
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+func (h *Handler) setCommonHeaders(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Link", profileLink)
+}
+
+func (h *Handler) handleResolveError(w http.ResponseWriter, err error, traceID string) {
+	if errors.Is(err, dto.ErrTaskNotFound) {
+		h.handleError(w, "Image not found", err, traceID, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errUnreadableSource) {
+		h.handleError(w, "Source is not a readable image", err, traceID, http.StatusNotFound)
+		return
+	}
+	h.handleError(w, "Failed to resolve image", err, traceID, http.StatusInternalServerError)
+}
+
+func (h *Handler) handleError(w http.ResponseWriter, message string, err error, traceID string, status int) {
+	h.logger.Error(message,
+		zap.String("trace_id", traceID),
+		zap.Error(err),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(dto.ErrorResponse{
+		Error:   message,
+		TraceID: traceID,
+	})
+}
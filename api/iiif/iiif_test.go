@@ -0,0 +1,344 @@
+package iiif
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap/zaptest"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/rendercache"
+	"mediaConverter/worker/storage"
+)
+
+func TestParseImageRequest(t *testing.T) {
+	tests := []struct {
+		name          string
+		region        string
+		size          string
+		rotation      string
+		qualityFormat string
+		wantRegion    image.Rectangle
+		wantWidth     int
+		wantHeight    int
+		wantMirror    bool
+		wantRotation  float64
+	}{
+		{"full max", "full", "max", "0", "default.jpg", image.Rect(0, 0, 400, 300), 400, 300, false, 0},
+		{"square", "square", "max", "0", "default.jpg", image.Rect(50, 0, 350, 300), 300, 300, false, 0},
+		{"pixel region clipped", "300,200,500,500", "max", "0", "default.png", image.Rect(300, 200, 400, 300), 100, 100, false, 0},
+		{"pct region", "pct:50,50,50,50", "max", "0", "gray.png", image.Rect(200, 150, 400, 300), 200, 150, false, 0},
+		{"width only", "full", "200,", "0", "default.jpg", image.Rect(0, 0, 400, 300), 200, 150, false, 0},
+		{"height only", "full", ",150", "0", "default.jpg", image.Rect(0, 0, 400, 300), 200, 150, false, 0},
+		{"pct size", "full", "pct:25", "0", "default.jpg", image.Rect(0, 0, 400, 300), 100, 75, false, 0},
+		{"best fit", "full", "!100,100", "0", "default.jpg", image.Rect(0, 0, 400, 300), 100, 75, false, 0},
+		{"best fit no upscale", "full", "!800,800", "0", "default.jpg", image.Rect(0, 0, 400, 300), 400, 300, false, 0},
+		{"best fit upscale", "full", "^!800,800", "0", "default.jpg", image.Rect(0, 0, 400, 300), 800, 600, false, 0},
+		{"upscale", "full", "^800,", "0", "default.jpg", image.Rect(0, 0, 400, 300), 800, 600, false, 0},
+		{"mirror rotate", "full", "max", "!90", "bitonal.gif", image.Rect(0, 0, 400, 300), 400, 300, true, 90},
+		{"full turn", "full", "max", "360", "default.jpg", image.Rect(0, 0, 400, 300), 400, 300, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := ParseImageRequest(tt.region, tt.size, tt.rotation, tt.qualityFormat, 400, 300)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if req.Region != tt.wantRegion {
+				t.Errorf("expected region %v, got %v", tt.wantRegion, req.Region)
+			}
+			if req.Width != tt.wantWidth || req.Height != tt.wantHeight {
+				t.Errorf("expected size %dx%d, got %dx%d", tt.wantWidth, tt.wantHeight, req.Width, req.Height)
+			}
+			if req.Mirror != tt.wantMirror || req.Rotation != tt.wantRotation {
+				t.Errorf("expected rotation %v/%v, got %v/%v", tt.wantMirror, tt.wantRotation, req.Mirror, req.Rotation)
+			}
+		})
+	}
+}
+
+func TestParseImageRequestInvalid(t *testing.T) {
+	tests := []struct {
+		name          string
+		region        string
+		size          string
+		rotation      string
+		qualityFormat string
+	}{
+		{"bad region", "1,2,3", "max", "0", "default.jpg"},
+		{"region outside image", "500,500,10,10", "max", "0", "default.jpg"},
+		{"zero width region", "0,0,0,10", "max", "0", "default.jpg"},
+		{"bad size", "full", "abc", "0", "default.jpg"},
+		{"empty size", "full", ",", "0", "default.jpg"},
+		{"upscale without caret", "full", "800,", "0", "default.jpg"},
+		{"too large", "full", "^20000,", "0", "default.jpg"},
+		{"too large an area", "full", "^4000,", "0", "default.jpg"},
+		{"negative rotation", "full", "max", "-90", "default.jpg"},
+		{"rotation over 360", "full", "max", "361", "default.jpg"},
+		{"bad quality", "full", "max", "0", "sepia.jpg"},
+		{"bad format", "full", "max", "0", "default.webp"},
+		{"missing format", "full", "max", "0", "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseImageRequest(tt.region, tt.size, tt.rotation, tt.qualityFormat, 400, 300)
+			if !errors.Is(err, ErrInvalidRequest) {
+				t.Errorf("expected ErrInvalidRequest, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseImageRequestMaxCapped(t *testing.T) {
+	for _, size := range []string{"^max", "max"} {
+		// A large region without upscaling is capped just like an upscaled
+		// small one.
+		sourceWidth, sourceHeight := 400, 300
+		if size == "max" {
+			sourceWidth, sourceHeight = 8000, 6000
+		}
+
+		req, err := ParseImageRequest("full", size, "0", "default.jpg", sourceWidth, sourceHeight)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", size, err)
+		}
+		if req.Width*req.Height > MaxArea || req.Width > MaxDimension || req.Height > MaxDimension {
+			t.Errorf("%s: expected at most %d pixels, got %dx%d", size, MaxArea, req.Width, req.Height)
+		}
+		if req.Width*req.Height < MaxArea*99/100 {
+			t.Errorf("%s: expected close to %d pixels, got %dx%d", size, MaxArea, req.Width, req.Height)
+		}
+		if math.Abs(float64(req.Width)/float64(req.Height)-4.0/3) > 0.01 {
+			t.Errorf("%s: expected the aspect ratio kept, got %dx%d", size, req.Width, req.Height)
+		}
+	}
+}
+
+type stubResolver struct {
+	path string
+}
+
+func (s *stubResolver) GetSourceFiles(ctx context.Context, taskIDs []string) ([]dto.SourceFile, error) {
+	if s.path == "" {
+		return nil, dto.ErrTaskNotFound
+	}
+	return []dto.SourceFile{{Path: filepath.Base(s.path), Filename: "source.png"}}, nil
+}
+
+func newTestHandler(t *testing.T, sourcePath string) *Handler {
+	t.Helper()
+
+	cache, err := rendercache.New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	if sourcePath != "" {
+		root = filepath.Dir(sourcePath)
+	}
+	files, err := storage.NewLocal(root, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHandler(&stubResolver{path: sourcePath}, files, cache, zaptest.NewLogger(t))
+}
+
+func createTestImage(t *testing.T, width, height int) string {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "source.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInfo(t *testing.T) {
+	handler := newTestHandler(t, createTestImage(t, 200, 100))
+	taskID := uuid.New().String()
+
+	req := httptest.NewRequest(http.MethodGet, "/iiif/"+taskID+"/info.json", nil)
+	req.SetPathValue("id", taskID)
+	w := httptest.NewRecorder()
+
+	handler.Info(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Error("expected CORS header")
+	}
+
+	var info infoResponse
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != "http://example.com/iiif/"+taskID {
+		t.Errorf("unexpected id %s", info.ID)
+	}
+	if info.Width != 200 || info.Height != 100 {
+		t.Errorf("expected 200x100, got %dx%d", info.Width, info.Height)
+	}
+	if info.MaxArea != MaxArea || info.MaxWidth != MaxDimension || info.MaxHeight != MaxDimension {
+		t.Errorf("expected the size limits advertised, got %d/%d/%d", info.MaxWidth, info.MaxHeight, info.MaxArea)
+	}
+	if info.Type != "ImageService3" || info.Profile != "level2" {
+		t.Errorf("unexpected type/profile %s/%s", info.Type, info.Profile)
+	}
+}
+
+func TestImage(t *testing.T) {
+	handler := newTestHandler(t, createTestImage(t, 200, 100))
+	taskID := uuid.New().String()
+
+	request := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/iiif/"+taskID+"/0,0,100,100/50,/90/default.png", nil)
+		req.SetPathValue("id", taskID)
+		req.SetPathValue("region", "0,0,100,100")
+		req.SetPathValue("size", "50,")
+		req.SetPathValue("rotation", "90")
+		req.SetPathValue("file", "default.png")
+		w := httptest.NewRecorder()
+		handler.Image(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		w := request()
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+			t.Errorf("expected image/png, got %s", ct)
+		}
+
+		img, err := png.Decode(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != 50 || img.Bounds().Dy() != 50 {
+			t.Errorf("expected 50x50, got %v", img.Bounds())
+		}
+	}
+}
+
+func TestImageErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		taskID     string
+		size       string
+		wantStatus int
+	}{
+		{"invalid task id", "source", "not-a-uuid", "max", http.StatusNotFound},
+		{"unknown task", "", uuid.New().String(), "max", http.StatusNotFound},
+		{"invalid size", "source", uuid.New().String(), "bogus", http.StatusBadRequest},
+	}
+
+	source := createTestImage(t, 20, 20)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.source != "" {
+				path = source
+			}
+			handler := newTestHandler(t, path)
+
+			req := httptest.NewRequest(http.MethodGet, "/iiif/x/full/max/0/default.jpg", nil)
+			req.SetPathValue("id", tt.taskID)
+			req.SetPathValue("region", "full")
+			req.SetPathValue("size", tt.size)
+			req.SetPathValue("rotation", "0")
+			req.SetPathValue("file", "default.jpg")
+			w := httptest.NewRecorder()
+
+			handler.Image(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+// countingBackend counts the reads of a backend. It hides storage.Local's
+// LocalPath, so sources are fetched as they would be from S3.
+type countingBackend struct {
+	storage.Backend
+	gets int
+}
+
+func (c *countingBackend) Get(ctx context.Context, key string) (io.ReadCloser, *storage.ObjectInfo, error) {
+	c.gets++
+	return c.Backend.Get(ctx, key)
+}
+
+func TestCachedTileSkipsSource(t *testing.T) {
+	handler := newTestHandler(t, createTestImage(t, 200, 100))
+	files := &countingBackend{Backend: handler.files}
+	handler.files = files
+	taskID := uuid.New().String()
+
+	info := func() {
+		req := httptest.NewRequest(http.MethodGet, "/iiif/"+taskID+"/info.json", nil)
+		req.SetPathValue("id", taskID)
+		w := httptest.NewRecorder()
+		handler.Info(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	tile := func() {
+		req := httptest.NewRequest(http.MethodGet, "/iiif/"+taskID+"/full/100,/0/default.jpg", nil)
+		req.SetPathValue("id", taskID)
+		req.SetPathValue("region", "full")
+		req.SetPathValue("size", "100,")
+		req.SetPathValue("rotation", "0")
+		req.SetPathValue("file", "default.jpg")
+		w := httptest.NewRecorder()
+		handler.Image(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	info()
+	tile()
+	if files.gets != 2 {
+		t.Fatalf("expected one read for the size and one to render, got %d", files.gets)
+	}
+
+	info()
+	tile()
+	if files.gets != 2 {
+		t.Errorf("expected cached size and tile to skip the source, got %d reads", files.gets)
+	}
+}
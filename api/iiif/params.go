@@ -0,0 +1,252 @@
+package iiif
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxDimension caps the width and height of any rendered image.
+	MaxDimension = 10000
+	// MaxArea caps the pixel count of any rendered image, so that a single
+	// request cannot make the service decode and hold hundreds of megabytes.
+	MaxArea = 8_000_000
+
+	QualityDefault = "default"
+	QualityColor   = "color"
+	QualityGray    = "gray"
+	QualityBitonal = "bitonal"
+)
+
+var ErrInvalidRequest = errors.New("invalid IIIF request")
+
+var formats = map[string]string{
+	"jpg": "image/jpeg",
+	"png": "image/png",
+	"gif": "image/gif",
+}
+
+// ImageRequest is a parsed and resolved IIIF Image API request: the region is
+// in source pixels and the size is the final scaled size before rotation.
+type ImageRequest struct {
+	Region   image.Rectangle
+	Width    int
+	Height   int
+	Mirror   bool
+	Rotation float64
+	Quality  string
+	Format   string
+}
+
+// ParseImageRequest resolves the region, size, rotation and quality.format
+// path segments against the source dimensions.
+func ParseImageRequest(region, size, rotation, qualityFormat string, sourceWidth, sourceHeight int) (*ImageRequest, error) {
+	req := &ImageRequest{}
+
+	var err error
+	if req.Region, err = parseRegion(region, sourceWidth, sourceHeight); err != nil {
+		return nil, err
+	}
+	if req.Width, req.Height, err = parseSize(size, req.Region.Dx(), req.Region.Dy()); err != nil {
+		return nil, err
+	}
+	if req.Mirror, req.Rotation, err = parseRotation(rotation); err != nil {
+		return nil, err
+	}
+	if req.Quality, req.Format, err = parseQualityFormat(qualityFormat); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func ContentType(format string) string {
+	return formats[format]
+}
+
+func parseRegion(region string, width, height int) (image.Rectangle, error) {
+	full := image.Rect(0, 0, width, height)
+
+	switch {
+	case region == "full":
+		return full, nil
+	case region == "square":
+		side := min(width, height)
+		x := (width - side) / 2
+		y := (height - side) / 2
+		return image.Rect(x, y, x+side, y+side), nil
+	case strings.HasPrefix(region, "pct:"):
+		v, err := parseFloats(strings.TrimPrefix(region, "pct:"), 4)
+		if err != nil || v[2] <= 0 || v[3] <= 0 {
+			return image.Rectangle{}, invalid("region", region)
+		}
+		x := int(math.Round(v[0] * float64(width) / 100))
+		y := int(math.Round(v[1] * float64(height) / 100))
+		w := int(math.Round(v[2] * float64(width) / 100))
+		h := int(math.Round(v[3] * float64(height) / 100))
+		return clipRegion(image.Rect(x, y, x+w, y+h), full, region)
+	default:
+		v, err := parseInts(region, 4)
+		if err != nil || v[2] <= 0 || v[3] <= 0 {
+			return image.Rectangle{}, invalid("region", region)
+		}
+		return clipRegion(image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3]), full, region)
+	}
+}
+
+// clipRegion crops a region reaching past the image edges; a region entirely
+// outside the image is an error.
+func clipRegion(r, full image.Rectangle, raw string) (image.Rectangle, error) {
+	clipped := r.Intersect(full)
+	if clipped.Empty() {
+		return image.Rectangle{}, invalid("region", raw)
+	}
+	return clipped, nil
+}
+
+func parseSize(size string, regionWidth, regionHeight int) (int, int, error) {
+	upscale := strings.HasPrefix(size, "^")
+	spec := strings.TrimPrefix(size, "^")
+
+	var w, h int
+	switch {
+	case spec == "max":
+		// max is the largest size the service renders: the region itself,
+		// or as large as MaxDimension and MaxArea allow when upscaling.
+		w, h = regionWidth, regionHeight
+		scale := math.Min(float64(MaxDimension)/float64(regionWidth), float64(MaxDimension)/float64(regionHeight))
+		scale = math.Min(scale, math.Sqrt(float64(MaxArea)/(float64(regionWidth)*float64(regionHeight))))
+		if scale < 1 || upscale {
+			// Rounded down, so the result stays within the limits.
+			w, h = max(int(float64(regionWidth)*scale+1e-9), 1), max(int(float64(regionHeight)*scale+1e-9), 1)
+		}
+	case strings.HasPrefix(spec, "pct:"):
+		pct, err := strconv.ParseFloat(strings.TrimPrefix(spec, "pct:"), 64)
+		if err != nil || pct <= 0 {
+			return 0, 0, invalid("size", size)
+		}
+		w, h = scaled(regionWidth, pct/100), scaled(regionHeight, pct/100)
+	case strings.HasPrefix(spec, "!"):
+		v, err := parseInts(strings.TrimPrefix(spec, "!"), 2)
+		if err != nil || v[0] <= 0 || v[1] <= 0 {
+			return 0, 0, invalid("size", size)
+		}
+		scale := math.Min(float64(v[0])/float64(regionWidth), float64(v[1])/float64(regionHeight))
+		if !upscale {
+			// Best fit is also bounded by the region itself.
+			scale = math.Min(scale, 1)
+		}
+		w, h = scaled(regionWidth, scale), scaled(regionHeight, scale)
+	default:
+		parts := strings.Split(spec, ",")
+		if len(parts) != 2 || (parts[0] == "" && parts[1] == "") {
+			return 0, 0, invalid("size", size)
+		}
+
+		var err error
+		if parts[0] != "" {
+			if w, err = strconv.Atoi(parts[0]); err != nil || w <= 0 {
+				return 0, 0, invalid("size", size)
+			}
+		}
+		if parts[1] != "" {
+			if h, err = strconv.Atoi(parts[1]); err != nil || h <= 0 {
+				return 0, 0, invalid("size", size)
+			}
+		}
+		if w == 0 {
+			w = scaled(regionWidth, float64(h)/float64(regionHeight))
+		}
+		if h == 0 {
+			h = scaled(regionHeight, float64(w)/float64(regionWidth))
+		}
+	}
+
+	if !upscale && (w > regionWidth || h > regionHeight) {
+		return 0, 0, fmt.Errorf("%w: size %q upscales the region, use ^%s", ErrInvalidRequest, size, size)
+	}
+	if w > MaxDimension || h > MaxDimension {
+		return 0, 0, fmt.Errorf("%w: size %q exceeds %d pixels", ErrInvalidRequest, size, MaxDimension)
+	}
+	if w*h > MaxArea {
+		return 0, 0, fmt.Errorf("%w: size %q exceeds an area of %d pixels", ErrInvalidRequest, size, MaxArea)
+	}
+
+	return w, h, nil
+}
+
+func parseRotation(rotation string) (bool, float64, error) {
+	mirror := strings.HasPrefix(rotation, "!")
+
+	degrees, err := strconv.ParseFloat(strings.TrimPrefix(rotation, "!"), 64)
+	if err != nil || degrees < 0 || degrees > 360 {
+		return false, 0, invalid("rotation", rotation)
+	}
+
+	return mirror, math.Mod(degrees, 360), nil
+}
+
+func parseQualityFormat(qualityFormat string) (string, string, error) {
+	quality, format, ok := strings.Cut(qualityFormat, ".")
+	if !ok {
+		return "", "", invalid("quality.format", qualityFormat)
+	}
+
+	switch quality {
+	case QualityDefault, QualityColor, QualityGray, QualityBitonal:
+	default:
+		return "", "", invalid("quality", quality)
+	}
+
+	if _, ok := formats[format]; !ok {
+		return "", "", invalid("format", format)
+	}
+
+	return quality, format, nil
+}
+
+func scaled(n int, scale float64) int {
+	return max(int(math.Round(float64(n)*scale)), 1)
+}
+
+func parseInts(s string, n int) ([]int, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, ErrInvalidRequest
+	}
+
+	values := make([]int, n)
+	for i, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil || v < 0 {
+			return nil, ErrInvalidRequest
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func parseFloats(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, ErrInvalidRequest
+	}
+
+	values := make([]float64, n)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return nil, ErrInvalidRequest
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func invalid(param, value string) error {
+	return fmt.Errorf("%w: bad %s %q", ErrInvalidRequest, param, value)
+}
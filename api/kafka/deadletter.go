@@ -0,0 +1,192 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// readTimeout bounds how long a read waits for messages the broker reported
+// as present.
+const readTimeout = 10 * time.Second
+
+// DeadLetter is a message as stored on a dead-letter topic.
+type DeadLetter struct {
+	Partition int32
+	Offset    int64
+	Timestamp time.Time
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+}
+
+// DeadLetterReader browses a dead-letter topic without consuming it: reads
+// neither join a consumer group nor commit offsets.
+type DeadLetterReader interface {
+	// List returns up to limit of the latest messages, newest first.
+	List(ctx context.Context, limit int) ([]*DeadLetter, error)
+	Get(ctx context.Context, partition int32, offset int64) (*DeadLetter, error)
+	Close() error
+}
+
+type deadLetterReader struct {
+	client   sarama.Client
+	consumer sarama.Consumer
+	topic    string
+}
+
+func NewDeadLetterReader(brokers []string, topic string) (DeadLetterReader, error) {
+	config := sarama.NewConfig()
+	config.Consumer.Return.Errors = true
+
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &deadLetterReader{client: client, consumer: consumer, topic: topic}, nil
+}
+
+func (r *deadLetterReader) List(ctx context.Context, limit int) ([]*DeadLetter, error) {
+	partitions, err := r.client.Partitions(r.topic)
+	if errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+		// Nothing has been dead-lettered yet.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var letters []*DeadLetter
+	for _, partition := range partitions {
+		oldest, newest, err := r.bounds(partition)
+		if err != nil {
+			return nil, err
+		}
+
+		// Every partition may hold the newest messages overall, so each
+		// contributes its last limit ones.
+		start := max(oldest, newest-int64(limit))
+		if start >= newest {
+			continue
+		}
+
+		read, err := r.read(ctx, partition, start, newest)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, read...)
+	}
+
+	slices.SortFunc(letters, func(a, b *DeadLetter) int {
+		return b.Timestamp.Compare(a.Timestamp)
+	})
+	if len(letters) > limit {
+		letters = letters[:limit]
+	}
+	return letters, nil
+}
+
+func (r *deadLetterReader) Get(ctx context.Context, partition int32, offset int64) (*DeadLetter, error) {
+	oldest, newest, err := r.bounds(partition)
+	if errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+		return nil, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if offset < oldest || offset >= newest {
+		return nil, ErrDeadLetterNotFound
+	}
+
+	read, err := r.read(ctx, partition, offset, offset+1)
+	if err != nil {
+		return nil, err
+	}
+	// Offsets of aborted or compacted records are skipped by the broker.
+	if len(read) == 0 || read[0].Offset != offset {
+		return nil, ErrDeadLetterNotFound
+	}
+	return read[0], nil
+}
+
+// bounds returns the offset of the oldest message of partition and the one
+// the next message will get.
+func (r *deadLetterReader) bounds(partition int32) (int64, int64, error) {
+	oldest, err := r.client.GetOffset(r.topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, 0, err
+	}
+	newest, err := r.client.GetOffset(r.topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, 0, err
+	}
+	return oldest, newest, nil
+}
+
+// read returns the messages of partition from start up to, but excluding,
+// end.
+func (r *deadLetterReader) read(ctx context.Context, partition int32, start, end int64) ([]*DeadLetter, error) {
+	pc, err := r.consumer.ConsumePartition(r.topic, partition, start)
+	if err != nil {
+		return nil, err
+	}
+	defer pc.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	var letters []*DeadLetter
+	for {
+		select {
+		case msg := <-pc.Messages():
+			if msg.Offset >= end {
+				return letters, nil
+			}
+			letters = append(letters, deadLetter(msg))
+			if msg.Offset == end-1 {
+				return letters, nil
+			}
+		case err := <-pc.Errors():
+			return nil, err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func deadLetter(msg *sarama.ConsumerMessage) *DeadLetter {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		if h != nil {
+			headers[string(h.Key)] = string(h.Value)
+		}
+	}
+	return &DeadLetter{
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Timestamp: msg.Timestamp,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Headers:   headers,
+	}
+}
+
+func (r *deadLetterReader) Close() error {
+	if err := r.consumer.Close(); err != nil {
+		r.client.Close()
+		return err
+	}
+	return r.client.Close()
+}
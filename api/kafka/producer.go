@@ -7,6 +7,10 @@ import (
 	"github.com/IBM/sarama"
 )
 
+// TasksTopic carries the normal-priority tasks consumed by the worker; the
+// topics of the other priorities are named after it.
+const TasksTopic = "media_tasks"
+
 type Producer interface {
 	SendTaskMessage(ctx context.Context, topic string, message *TaskMessage) error
 	Close() error
@@ -20,6 +24,12 @@ type TaskMessage struct {
 	TargetWidth  *int   `json:"target_width"`
 	TargetHeight *int   `json:"target_height"`
 	Crop         bool   `json:"crop"`
+
+	DuplicatePolicy string `json:"duplicate_policy,omitempty"`
+	Priority        string `json:"priority,omitempty"`
+
+	Type    string          `json:"type,omitempty"`
+	Options json.RawMessage `json:"options,omitempty"`
 }
 
 type producer struct {
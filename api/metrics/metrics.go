@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ResultCacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_result_cache_hits_total",
+		Help: "Tasks completed from an existing result with the same source and parameters.",
+	}, []string{"task_type"})
+
+	ResultCacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_result_cache_misses_total",
+		Help: "Cacheable tasks that had no matching result and were sent for conversion.",
+	}, []string{"task_type"})
+
+	OutboxPending = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "api_outbox_pending",
+		Help: "Task messages stored in the outbox and not yet published to Kafka.",
+	})
+
+	OutboxLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "api_outbox_lag_seconds",
+		Help: "Age of the oldest unpublished task message in the outbox.",
+	})
+
+	OutboxPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "api_outbox_published_total",
+		Help: "Task messages published from the outbox.",
+	})
+
+	OutboxPublishFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "api_outbox_publish_failures_total",
+		Help: "Failed attempts to publish a task message from the outbox.",
+	})
+
+	SchedulerLeader = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "api_scheduler_leader",
+		Help: "1 if this replica holds the scheduler lock and queues due scheduled tasks.",
+	})
+
+	ScheduledTasksStarted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "api_scheduled_tasks_started_total",
+		Help: "Scheduled tasks queued once their run_at passed.",
+	})
+)
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// Job groups the tasks created by one batch upload.
+type Job struct {
+	ID        string
+	TraceID   string
+	CreatedAt time.Time
+}
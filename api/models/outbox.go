@@ -0,0 +1,24 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxMessage is a task message stored with the task change that produced
+// it, waiting to be published to Kafka.
+type OutboxMessage struct {
+	ID        int64
+	TaskID    string
+	Topic     string
+	Payload   json.RawMessage
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// OutboxStats describes the messages not yet published.
+type OutboxStats struct {
+	Pending int
+	// Oldest is when the oldest of them was stored; zero if there are none.
+	Oldest time.Time
+}
@@ -1,30 +1,91 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
 type TaskStatus string
 
 const (
-	StatusPending   TaskStatus = "pending"
-	StatusProcessing TaskStatus = "processing"
-	StatusCompleted TaskStatus = "completed"
-	StatusFailed    TaskStatus = "failed"
+	StatusAwaitingUpload TaskStatus = "awaiting_upload"
+	StatusScheduled      TaskStatus = "scheduled"
+	StatusPending        TaskStatus = "pending"
+	StatusProcessing     TaskStatus = "processing"
+	StatusCompleted      TaskStatus = "completed"
+	StatusFailed         TaskStatus = "failed"
+	StatusCancelled      TaskStatus = "cancelled"
+)
+
+type TaskType string
+
+const (
+	TaskTypeConvert      TaskType = "convert"
+	TaskTypeCompare      TaskType = "compare"
+	TaskTypeContactSheet TaskType = "contact_sheet"
+	TaskTypeTiles        TaskType = "tiles"
+)
+
+type DuplicatePolicy string
+
+const (
+	DuplicatePolicyAllow  DuplicatePolicy = "allow"
+	DuplicatePolicyReject DuplicatePolicy = "reject"
+	DuplicatePolicyReuse  DuplicatePolicy = "reuse"
+)
+
+// Priority picks the queue lane of a task; workers favour the more urgent
+// lanes without starving the others.
+type Priority string
+
+const (
+	PriorityInteractive Priority = "interactive"
+	PriorityNormal      Priority = "normal"
+	PriorityBulk        Priority = "bulk"
+)
+
+type HashType string
+
+const (
+	HashAverage    HashType = "ahash"
+	HashDifference HashType = "dhash"
+	HashPerceptual HashType = "phash"
 )
 
 type Task struct {
 	ID               string
 	TraceID          string
+	Type             TaskType
 	OriginalFilename string
 	FilePath         string
 	OutputFormat     string
 	TargetWidth      *int
 	TargetHeight     *int
 	Crop             bool
-	Status           TaskStatus
-	ErrorMessage     string
-	CreatedAt        time.Time
-	UpdatedAt        time.Time
-	CompletedAt      *time.Time
+	DuplicatePolicy  DuplicatePolicy
+	DuplicateOf      *string
+	Priority         Priority
+	AHash            *int64
+	DHash            *int64
+	PHash            *int64
+	Options          json.RawMessage
+	Result           json.RawMessage
+	SourceHash       *string
+	CacheKey         *string
+	UploadSize       *int64
+	JobID            *string
+	RetryOf          *string
+	Attempt          int
+	// RunAt is when a scheduled task is queued.
+	RunAt        *time.Time
+	Status       TaskStatus
+	ErrorMessage string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	CompletedAt  *time.Time
+}
+
+type SimilarTask struct {
+	Task     *Task
+	Distance int
 }
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// TusUpload is a resumable upload. Received chunks are stored as separate
+// objects, listed in order in Chunks, until the upload is complete.
+type TusUpload struct {
+	ID        string
+	TraceID   string
+	Length    int64
+	Offset    int64
+	Metadata  map[string]string
+	Chunks    []string
+	TaskID    *string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,140 @@
+// Package outbox publishes the task messages that the API stores in the
+// task_outbox table alongside the tasks themselves.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mediaConverter/api/kafka"
+	"mediaConverter/api/metrics"
+	"mediaConverter/api/models"
+)
+
+const (
+	// retention is how long published messages are kept for inspection.
+	retention     = 24 * time.Hour
+	purgeInterval = time.Hour
+)
+
+type Store interface {
+	RelayOutbox(ctx context.Context, limit int, publish func(*models.OutboxMessage) error) (int, error)
+	OutboxStats(ctx context.Context) (*models.OutboxStats, error)
+	PurgeOutbox(ctx context.Context, before time.Time) (int, error)
+}
+
+// Relay moves messages from the outbox to Kafka. Every API replica runs one;
+// rows are locked while they are published, so each message is normally
+// sent once, and at least once if a replica dies mid-batch.
+type Relay struct {
+	store     Store
+	producer  kafka.Producer
+	interval  time.Duration
+	batchSize int
+	logger    *zap.Logger
+	wake      chan struct{}
+}
+
+func NewRelay(store Store, producer kafka.Producer, interval time.Duration, batchSize int, logger *zap.Logger) *Relay {
+	return &Relay{
+		store:     store,
+		producer:  producer,
+		interval:  interval,
+		batchSize: batchSize,
+		logger:    logger,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Wake makes Run relay right away instead of at its next poll.
+func (r *Relay) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run relays messages every interval, and whenever woken, until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	lastPurge := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+
+		r.relay(ctx)
+		r.observe(ctx)
+
+		if time.Since(lastPurge) >= purgeInterval {
+			lastPurge = time.Now()
+			purged, err := r.store.PurgeOutbox(ctx, lastPurge.Add(-retention))
+			if err != nil {
+				r.logger.Error("Failed to purge outbox", zap.Error(err))
+			} else if purged > 0 {
+				r.logger.Info("Purged outbox", zap.Int("count", purged))
+			}
+		}
+	}
+}
+
+// relay publishes batches until the outbox is drained or publishing fails.
+func (r *Relay) relay(ctx context.Context) {
+	for ctx.Err() == nil {
+		failed := false
+		sent, err := r.store.RelayOutbox(ctx, r.batchSize, func(msg *models.OutboxMessage) error {
+			if err := r.publish(ctx, msg); err != nil {
+				failed = true
+				metrics.OutboxPublishFailures.Inc()
+				r.logger.Warn("Failed to publish task message",
+					zap.Int64("outbox_id", msg.ID),
+					zap.String("task_id", msg.TaskID),
+					zap.Int("attempts", msg.Attempts+1),
+					zap.Error(err),
+				)
+				return err
+			}
+			return nil
+		})
+		metrics.OutboxPublished.Add(float64(sent))
+		if err != nil {
+			r.logger.Error("Failed to relay outbox", zap.Error(err))
+			return
+		}
+		if failed || sent < r.batchSize {
+			return
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, msg *models.OutboxMessage) error {
+	var task kafka.TaskMessage
+	if err := json.Unmarshal(msg.Payload, &task); err != nil {
+		return fmt.Errorf("decode outbox payload: %w", err)
+	}
+	return r.producer.SendTaskMessage(ctx, msg.Topic, &task)
+}
+
+func (r *Relay) observe(ctx context.Context) {
+	stats, err := r.store.OutboxStats(ctx)
+	if err != nil {
+		r.logger.Warn("Failed to read outbox stats", zap.Error(err))
+		return
+	}
+
+	metrics.OutboxPending.Set(float64(stats.Pending))
+	lag := 0.0
+	if !stats.Oldest.IsZero() {
+		lag = time.Since(stats.Oldest).Seconds()
+	}
+	metrics.OutboxLag.Set(lag)
+}
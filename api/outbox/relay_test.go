@@ -0,0 +1,149 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+
+	"mediaConverter/api/kafka"
+	"mediaConverter/api/models"
+)
+
+type fakeStore struct {
+	pending []*models.OutboxMessage
+	sent    []*models.OutboxMessage
+	batches int
+	// relayed, if set, is signalled after every batch.
+	relayed chan struct{}
+}
+
+func (f *fakeStore) RelayOutbox(ctx context.Context, limit int, publish func(*models.OutboxMessage) error) (int, error) {
+	f.batches++
+	sent := 0
+	for len(f.pending) > 0 && sent < limit {
+		msg := f.pending[0]
+		if err := publish(msg); err != nil {
+			msg.Attempts++
+			return sent, nil
+		}
+		f.pending = f.pending[1:]
+		f.sent = append(f.sent, msg)
+		sent++
+	}
+	if f.relayed != nil {
+		select {
+		case f.relayed <- struct{}{}:
+		default:
+		}
+	}
+	return sent, nil
+}
+
+func (f *fakeStore) OutboxStats(ctx context.Context) (*models.OutboxStats, error) {
+	return &models.OutboxStats{Pending: len(f.pending)}, nil
+}
+
+func (f *fakeStore) PurgeOutbox(ctx context.Context, before time.Time) (int, error) {
+	return 0, nil
+}
+
+type fakeProducer struct {
+	fail     bool
+	messages []*kafka.TaskMessage
+	topics   []string
+}
+
+func (f *fakeProducer) SendTaskMessage(ctx context.Context, topic string, message *kafka.TaskMessage) error {
+	if f.fail {
+		return errors.New("broker unavailable")
+	}
+	f.topics = append(f.topics, topic)
+	f.messages = append(f.messages, message)
+	return nil
+}
+
+func (f *fakeProducer) Close() error { return nil }
+
+func outboxMessages(ids ...string) []*models.OutboxMessage {
+	var messages []*models.OutboxMessage
+	for i, id := range ids {
+		messages = append(messages, &models.OutboxMessage{
+			ID:      int64(i + 1),
+			TaskID:  id,
+			Topic:   kafka.TasksTopic,
+			Payload: []byte(`{"task_id":"` + id + `","output_format":"png"}`),
+		})
+	}
+	return messages
+}
+
+func TestRelayDrainsOutboxInBatches(t *testing.T) {
+	store := &fakeStore{pending: outboxMessages("a", "b", "c", "d", "e")}
+	producer := &fakeProducer{}
+	relay := NewRelay(store, producer, time.Second, 2, zaptest.NewLogger(t))
+
+	relay.relay(context.Background())
+
+	if len(store.pending) != 0 || len(producer.messages) != 5 {
+		t.Fatalf("Expected all 5 messages published, %d left, %d published", len(store.pending), len(producer.messages))
+	}
+	if store.batches != 3 {
+		t.Errorf("Expected 3 batches, got %d", store.batches)
+	}
+	for i, msg := range producer.messages {
+		if msg.TaskID != store.sent[i].TaskID || msg.OutputFormat != "png" || producer.topics[i] != kafka.TasksTopic {
+			t.Errorf("Unexpected message %d: %+v to %s", i, msg, producer.topics[i])
+		}
+	}
+}
+
+func TestRelayKeepsMessagesWhenPublishingFails(t *testing.T) {
+	store := &fakeStore{pending: outboxMessages("a", "b")}
+	producer := &fakeProducer{fail: true}
+	relay := NewRelay(store, producer, time.Second, 10, zaptest.NewLogger(t))
+
+	relay.relay(context.Background())
+
+	if len(store.pending) != 2 {
+		t.Fatalf("Expected both messages to stay in the outbox, %d left", len(store.pending))
+	}
+	if store.batches != 1 || store.pending[0].Attempts != 1 {
+		t.Errorf("Expected one failed attempt, got %d batches and %d attempts", store.batches, store.pending[0].Attempts)
+	}
+
+	producer.fail = false
+	relay.relay(context.Background())
+
+	if len(store.pending) != 0 || len(producer.messages) != 2 {
+		t.Errorf("Expected the messages to be published once the broker is back, %d left", len(store.pending))
+	}
+}
+
+func TestRelayRunWakesUp(t *testing.T) {
+	store := &fakeStore{pending: outboxMessages("a"), relayed: make(chan struct{}, 1)}
+	producer := &fakeProducer{}
+	relay := NewRelay(store, producer, time.Hour, 10, zaptest.NewLogger(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		relay.Run(ctx)
+	}()
+
+	relay.Wake()
+	select {
+	case <-store.relayed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Relay did not run after Wake")
+	}
+	cancel()
+	<-done
+
+	if len(producer.messages) != 1 {
+		t.Errorf("Expected 1 message published, got %d", len(producer.messages))
+	}
+}
@@ -0,0 +1,194 @@
+package rendercache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Cache stores rendered images on disk under a key derived from everything
+// that determines the output, so identical requests are rendered once. When
+// maxBytes is positive the least recently used entries are evicted to keep
+// the cache within that size. The index is kept in memory, so dir must
+// belong to this process alone; replicas sharing it would each enforce the
+// limit on their own and evict each other's files.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type entry struct {
+	key  string
+	size int64
+}
+
+func New(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Key hashes the parts into a file-system safe cache key.
+func Key(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Open returns the cached entry, or an error satisfying os.IsNotExist on a
+// miss.
+func (c *Cache) Open(key string) (*os.File, error) {
+	file, err := os.Open(c.path(key))
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+	}
+	c.mu.Unlock()
+
+	return file, nil
+}
+
+// Put stores the output of render under key. The entry is written to a
+// temporary file first so concurrent readers never see a partial image.
+func (c *Cache) Put(key string, render func(w io.Writer) error) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create cache shard: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := render(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	stat, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("commit cache entry: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(key, stat.Size())
+	c.evict()
+
+	return nil
+}
+
+// Size returns the total size of the cached entries in bytes.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *Cache) add(key string, size int64) {
+	if el, ok := c.entries[key]; ok {
+		c.size -= el.Value.(*entry).size
+		c.order.Remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, size: size})
+	c.size += size
+}
+
+// evict removes least recently used entries until the cache fits. The newest
+// entry is always kept, even if it alone exceeds the limit.
+func (c *Cache) evict() {
+	if c.maxBytes <= 0 {
+		return
+	}
+
+	for c.size > c.maxBytes && c.order.Len() > 1 {
+		el := c.order.Back()
+		e := el.Value.(*entry)
+		c.order.Remove(el)
+		delete(c.entries, e.key)
+		c.size -= e.size
+		os.Remove(c.path(e.key))
+	}
+}
+
+// load indexes entries left by a previous run, treating the most recently
+// modified ones as the most recently used.
+func (c *Cache) load() error {
+	type found struct {
+		key  string
+		info fs.FileInfo
+	}
+	var files []found
+
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".tmp-") {
+			os.Remove(path)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, found{key: d.Name(), info: info})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("index cache dir: %w", err)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].info.ModTime().Before(files[j].info.ModTime())
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range files {
+		c.add(f.key, f.info.Size())
+	}
+	c.evict()
+
+	return nil
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
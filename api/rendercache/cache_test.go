@@ -0,0 +1,81 @@
+package rendercache
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func put(t *testing.T, c *Cache, key, data string) {
+	t.Helper()
+	err := c.Put(key, func(w io.Writer) error {
+		_, err := io.WriteString(w, data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c, err := New(t.TempDir(), 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b, d := Key("a"), Key("b"), Key("d")
+	put(t, c, a, strings.Repeat("a", 10))
+	put(t, c, b, strings.Repeat("b", 10))
+
+	// Touch a so b becomes the eviction candidate.
+	f, err := c.Open(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	put(t, c, d, strings.Repeat("d", 10))
+
+	if _, err := c.Open(b); !os.IsNotExist(err) {
+		t.Errorf("expected b to be evicted, got %v", err)
+	}
+	for _, key := range []string{a, d} {
+		f, err := c.Open(key)
+		if err != nil {
+			t.Errorf("expected entry to be cached: %v", err)
+			continue
+		}
+		f.Close()
+	}
+	if c.Size() != 20 {
+		t.Errorf("expected size 20, got %d", c.Size())
+	}
+}
+
+func TestCacheReloadsExistingEntries(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	put(t, c, Key("a"), "hello")
+
+	reopened, err := New(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Size() != 5 {
+		t.Errorf("expected size 5, got %d", reopened.Size())
+	}
+
+	f, err := reopened.Open(Key("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+	if string(data) != "hello" {
+		t.Errorf("unexpected content %q", data)
+	}
+}
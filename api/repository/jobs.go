@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"mediaConverter/api/models"
+)
+
+func (r *PostgresRepo) CreateJob(ctx context.Context, job *models.Job) error {
+	query := `
+		INSERT INTO jobs (trace_id)
+		VALUES ($1)
+		RETURNING id, created_at
+	`
+
+	return r.q.QueryRow(ctx, query, job.TraceID).Scan(&job.ID, &job.CreatedAt)
+}
+
+func (r *PostgresRepo) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	query := `SELECT id, trace_id, created_at FROM jobs WHERE id = $1`
+
+	var job models.Job
+	err := r.q.QueryRow(ctx, query, id).Scan(&job.ID, &job.TraceID, &job.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrJobNotFound
+		}
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// CountJobTasks returns how many tasks of the job are in each status.
+func (r *PostgresRepo) CountJobTasks(ctx context.Context, jobID string) (map[models.TaskStatus]int, error) {
+	query := `SELECT status, COUNT(*) FROM tasks WHERE job_id = $1 GROUP BY status`
+
+	rows, err := r.q.Query(ctx, query, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[models.TaskStatus]int)
+	for rows.Next() {
+		var status models.TaskStatus
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (r *PostgresRepo) ListJobTasks(ctx context.Context, jobID string) ([]*models.Task, error) {
+	query := `SELECT ` + selectTaskColumns("") + ` FROM tasks WHERE job_id = $1 ORDER BY created_at, id`
+
+	rows, err := r.q.Query(ctx, query, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []*models.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"mediaConverter/api/models"
+)
+
+// EnqueueTask stores msg for the outbox relay to publish. Called in the
+// transaction that makes the task pending, so that either both happen or
+// neither does.
+func (r *PostgresRepo) EnqueueTask(ctx context.Context, msg *models.OutboxMessage) error {
+	query := `
+		INSERT INTO task_outbox (task_id, topic, payload)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	return r.q.QueryRow(ctx, query, msg.TaskID, msg.Topic, msg.Payload).Scan(&msg.ID, &msg.CreatedAt)
+}
+
+// RelayOutbox locks up to limit unpublished messages, oldest first, and
+// hands them to publish. Messages being relayed elsewhere are skipped, so
+// several relays can run at once. Published messages are marked sent; at the
+// first failure the error is recorded on the message and relaying stops.
+// It returns how many messages were published.
+func (r *PostgresRepo) RelayOutbox(ctx context.Context, limit int, publish func(*models.OutboxMessage) error) (int, error) {
+	sent := 0
+	err := pgx.BeginFunc(ctx, r.db.Pool, func(tx pgx.Tx) error {
+		query := `
+			SELECT id, task_id, topic, payload, attempts, created_at
+			FROM task_outbox
+			WHERE sent_at IS NULL
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		`
+
+		rows, err := tx.Query(ctx, query, limit)
+		if err != nil {
+			return err
+		}
+		messages, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.OutboxMessage, error) {
+			var msg models.OutboxMessage
+			err := row.Scan(&msg.ID, &msg.TaskID, &msg.Topic, &msg.Payload, &msg.Attempts, &msg.CreatedAt)
+			return &msg, err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range messages {
+			if err := publish(msg); err != nil {
+				_, updateErr := tx.Exec(ctx,
+					`UPDATE task_outbox SET attempts = attempts + 1, last_error = $2 WHERE id = $1`,
+					msg.ID, err.Error())
+				return updateErr
+			}
+
+			if _, err := tx.Exec(ctx, `UPDATE task_outbox SET sent_at = NOW() WHERE id = $1`, msg.ID); err != nil {
+				return err
+			}
+			sent++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return sent, nil
+}
+
+func (r *PostgresRepo) OutboxStats(ctx context.Context) (*models.OutboxStats, error) {
+	query := `SELECT COUNT(*), MIN(created_at) FROM task_outbox WHERE sent_at IS NULL`
+
+	var stats models.OutboxStats
+	var oldest *time.Time
+	if err := r.q.QueryRow(ctx, query).Scan(&stats.Pending, &oldest); err != nil {
+		return nil, err
+	}
+	if oldest != nil {
+		stats.Oldest = *oldest
+	}
+
+	return &stats, nil
+}
+
+// PurgeOutbox deletes messages published before the given time.
+func (r *PostgresRepo) PurgeOutbox(ctx context.Context, before time.Time) (int, error) {
+	result, err := r.q.Exec(ctx, `DELETE FROM task_outbox WHERE sent_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(result.RowsAffected()), nil
+}
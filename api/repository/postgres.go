@@ -3,42 +3,113 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 
 	"mediaConverter/api/database"
 	"mediaConverter/api/models"
 )
 
+var taskColumns = []string{
+	"id", "trace_id", "task_type", "original_filename", "file_path", "output_format", "target_width", "target_height", "crop",
+	"duplicate_policy", "duplicate_of", "priority", "ahash", "dhash", "phash", "options", "result", "source_hash", "cache_key",
+	"upload_size", "job_id", "retry_of", "attempt", "run_at", "status", "error_message", "created_at", "updated_at", "completed_at",
+}
+
+var hashColumns = map[models.HashType]string{
+	models.HashAverage:    "ahash",
+	models.HashDifference: "dhash",
+	models.HashPerceptual: "phash",
+}
+
+const uniqueViolation = "23505"
+
+// querier runs queries on the pool, or inside a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type PostgresRepo struct {
 	db *database.DB
+	q  querier
 }
 
 func NewPostgresRepo(db *database.DB) Repository {
-	return &PostgresRepo{db: db}
+	return &PostgresRepo{db: db, q: db.Pool}
+}
+
+// InTx runs fn with a repository whose queries share one transaction, which
+// is committed if fn succeeds and rolled back otherwise. Inside fn, InTx
+// joins the transaction already open.
+func (r *PostgresRepo) InTx(ctx context.Context, fn func(Repository) error) error {
+	if _, ok := r.q.(pgx.Tx); ok {
+		return fn(r)
+	}
+
+	return pgx.BeginFunc(ctx, r.db.Pool, func(tx pgx.Tx) error {
+		return fn(&PostgresRepo{db: r.db, q: tx})
+	})
 }
 
 func (r *PostgresRepo) CreateTask(ctx context.Context, task *models.Task) error {
 	query := `
-		INSERT INTO tasks (trace_id, original_filename, file_path, output_format, target_width, target_height, crop, status, error_message)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO tasks (trace_id, task_type, original_filename, file_path, output_format, target_width, target_height, crop,
+		                   duplicate_policy, duplicate_of, priority, options, result, source_hash, cache_key,
+		                   upload_size, job_id, retry_of, attempt, run_at, status, error_message, completed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23)
 		RETURNING id, created_at, updated_at
 	`
 
+	if task.Type == "" {
+		task.Type = models.TaskTypeConvert
+	}
+	if task.DuplicatePolicy == "" {
+		task.DuplicatePolicy = models.DuplicatePolicyAllow
+	}
+	if task.Priority == "" {
+		task.Priority = models.PriorityNormal
+	}
+	if task.Attempt == 0 {
+		task.Attempt = 1
+	}
+
 	var createdTask models.Task
-	err := r.db.Pool.QueryRow(ctx, query,
+	err := r.q.QueryRow(ctx, query,
 		task.TraceID,
+		task.Type,
 		task.OriginalFilename,
 		task.FilePath,
 		task.OutputFormat,
 		task.TargetWidth,
 		task.TargetHeight,
 		task.Crop,
+		task.DuplicatePolicy,
+		task.DuplicateOf,
+		task.Priority,
+		task.Options,
+		task.Result,
+		task.SourceHash,
+		task.CacheKey,
+		task.UploadSize,
+		task.JobID,
+		task.RetryOf,
+		task.Attempt,
+		task.RunAt,
 		task.Status,
 		task.ErrorMessage,
+		task.CompletedAt,
 	).Scan(&createdTask.ID, &createdTask.CreatedAt, &createdTask.UpdatedAt)
 
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrTaskAlreadyExists
+		}
 		return err
 	}
 
@@ -50,32 +121,23 @@ func (r *PostgresRepo) CreateTask(ctx context.Context, task *models.Task) error
 }
 
 func (r *PostgresRepo) GetTask(ctx context.Context, id string) (*models.Task, error) {
-	query := `
-		SELECT id, trace_id, original_filename, file_path, output_format, target_width, target_height, crop,
-		       status, error_message, created_at, updated_at, completed_at
-		FROM tasks
-		WHERE id = $1
-	`
+	query := `SELECT ` + selectTaskColumns("") + ` FROM tasks WHERE id = $1`
 
-	row := r.db.Pool.QueryRow(ctx, query, id)
+	task, err := scanTask(r.q.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTaskNotFound
+		}
+		return nil, err
+	}
 
-	var task models.Task
-	err := row.Scan(
-		&task.ID,
-		&task.TraceID,
-		&task.OriginalFilename,
-		&task.FilePath,
-		&task.OutputFormat,
-		&task.TargetWidth,
-		&task.TargetHeight,
-		&task.Crop,
-		&task.Status,
-		&task.ErrorMessage,
-		&task.CreatedAt,
-		&task.UpdatedAt,
-		&task.CompletedAt,
-	)
+	return task, nil
+}
+
+func (r *PostgresRepo) GetTaskByTraceID(ctx context.Context, traceID string) (*models.Task, error) {
+	query := `SELECT ` + selectTaskColumns("") + ` FROM tasks WHERE trace_id = $1`
 
+	task, err := scanTask(r.q.QueryRow(ctx, query, traceID))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrTaskNotFound
@@ -83,31 +145,21 @@ func (r *PostgresRepo) GetTask(ctx context.Context, id string) (*models.Task, er
 		return nil, err
 	}
 
-	return &task, nil
+	return task, nil
 }
 
-func (r *PostgresRepo) GetTaskByTraceID(ctx context.Context, traceID string) (*models.Task, error) {
+// FindCachedResult returns the earliest completed task with the given cache
+// key, or ErrTaskNotFound.
+func (r *PostgresRepo) FindCachedResult(ctx context.Context, cacheKey string) (*models.Task, error) {
 	query := `
-		SELECT id, trace_id, original_filename, file_path, status, error_message, created_at, updated_at, completed_at
+		SELECT ` + selectTaskColumns("") + `
 		FROM tasks
-		WHERE trace_id = $1
+		WHERE cache_key = $1 AND status = 'completed'
+		ORDER BY completed_at
+		LIMIT 1
 	`
 
-	row := r.db.Pool.QueryRow(ctx, query, traceID)
-
-	var task models.Task
-	err := row.Scan(
-		&task.ID,
-		&task.TraceID,
-		&task.OriginalFilename,
-		&task.FilePath,
-		&task.Status,
-		&task.ErrorMessage,
-		&task.CreatedAt,
-		&task.UpdatedAt,
-		&task.CompletedAt,
-	)
-
+	task, err := scanTask(r.q.QueryRow(ctx, query, cacheKey))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrTaskNotFound
@@ -115,7 +167,7 @@ func (r *PostgresRepo) GetTaskByTraceID(ctx context.Context, traceID string) (*m
 		return nil, err
 	}
 
-	return &task, nil
+	return task, nil
 }
 
 func (r *PostgresRepo) UpdateTaskStatus(ctx context.Context, id string, status models.TaskStatus, errorMessage string) error {
@@ -130,7 +182,7 @@ func (r *PostgresRepo) UpdateTaskStatus(ctx context.Context, id string, status m
 
 	query += ` WHERE id = $3`
 
-	result, err := r.db.Pool.Exec(ctx, query, status, errorMessage, id)
+	result, err := r.q.Exec(ctx, query, status, errorMessage, id)
 	if err != nil {
 		return err
 	}
@@ -141,3 +193,285 @@ func (r *PostgresRepo) UpdateTaskStatus(ctx context.Context, id string, status m
 
 	return nil
 }
+
+// CommitUpload points a task whose source was uploaded directly to storage
+// at the verified copy of it and moves the task into the queue, or into the
+// schedule if its run_at is still ahead. It fails with ErrTaskNotAwaiting if
+// the task was committed already.
+func (r *PostgresRepo) CommitUpload(ctx context.Context, id, filePath, sourceHash string) error {
+	query := `
+		UPDATE tasks
+		SET status = CASE WHEN run_at > NOW() THEN 'scheduled' ELSE 'pending' END,
+		    file_path = $2, source_hash = $3, updated_at = NOW()
+		WHERE id = $1 AND status = 'awaiting_upload'
+	`
+
+	result, err := r.q.Exec(ctx, query, id, filePath, sourceHash)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrTaskNotAwaiting
+	}
+
+	return nil
+}
+
+// RequeueTask puts a pending or failed task back into the queue with the
+// conversion parameters and result cache key of task. It fails with ErrTaskNotRequeueable if the
+// task is in any other state.
+func (r *PostgresRepo) RequeueTask(ctx context.Context, task *models.Task) error {
+	query := `
+		UPDATE tasks
+		SET output_format = $2, target_width = $3, target_height = $4, crop = $5, cache_key = $6,
+		    status = 'pending', error_message = '', completed_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status IN ('pending', 'failed')
+	`
+
+	result, err := r.q.Exec(ctx, query, task.ID, task.OutputFormat, task.TargetWidth, task.TargetHeight, task.Crop, task.CacheKey)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrTaskNotRequeueable
+	}
+
+	return nil
+}
+
+// CancelTask sets an unfinished task to cancelled, drops its unpublished
+// outbox messages and returns the status it had. It fails with
+// ErrTaskNotCancellable if the task has already finished.
+func (r *PostgresRepo) CancelTask(ctx context.Context, id string) (models.TaskStatus, error) {
+	query := `
+		UPDATE tasks t
+		SET status = 'cancelled', lease_owner = NULL, lease_expires_at = NULL,
+		    updated_at = NOW(), completed_at = NOW()
+		FROM (SELECT id, status FROM tasks WHERE id = $1 FOR UPDATE) previous
+		WHERE t.id = previous.id
+		  AND previous.status IN ('awaiting_upload', 'scheduled', 'pending', 'processing')
+		RETURNING previous.status
+	`
+
+	var status models.TaskStatus
+	err := r.q.QueryRow(ctx, query, id).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrTaskNotCancellable
+	}
+	if err != nil {
+		return "", err
+	}
+
+	_, err = r.q.Exec(ctx, `DELETE FROM task_outbox WHERE task_id = $1 AND sent_at IS NULL`, id)
+	return status, err
+}
+
+// StartDueTasks sets up to limit scheduled tasks whose run_at has passed to
+// pending, earliest first, and returns them. Tasks being started elsewhere
+// are skipped; call it in the transaction that enqueues the tasks.
+func (r *PostgresRepo) StartDueTasks(ctx context.Context, limit int) ([]*models.Task, error) {
+	query := `
+		UPDATE tasks
+		SET status = 'pending', updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM tasks
+			WHERE status = 'scheduled' AND run_at <= NOW()
+			ORDER BY run_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + selectTaskColumns("")
+
+	rows, err := r.q.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var tasks []*models.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+// ListScheduledTasks returns up to limit scheduled tasks, earliest run_at
+// first.
+func (r *PostgresRepo) ListScheduledTasks(ctx context.Context, limit int) ([]*models.Task, error) {
+	query := `
+		SELECT ` + selectTaskColumns("") + `
+		FROM tasks
+		WHERE status = 'scheduled'
+		ORDER BY run_at, created_at
+		LIMIT $1
+	`
+
+	rows, err := r.q.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var tasks []*models.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+// AddTaskEvent records an action taken on a task in its event log.
+func (r *PostgresRepo) AddTaskEvent(ctx context.Context, taskID, event, actor, message string) error {
+	query := `INSERT INTO task_events (task_id, event, actor, message) VALUES ($1, $2, $3, $4)`
+
+	_, err := r.q.Exec(ctx, query, taskID, event, actor, message)
+	return err
+}
+
+func (r *PostgresRepo) FindSimilarTasks(ctx context.Context, id string, hash models.HashType, maxDistance, limit int) ([]models.SimilarTask, error) {
+	column, ok := hashColumns[hash]
+	if !ok {
+		return nil, fmt.Errorf("unknown hash type %q", hash)
+	}
+
+	distance := fmt.Sprintf("bit_count((c.%[1]s # t.%[1]s)::bit(64))", column)
+	query := `
+		SELECT ` + selectTaskColumns("c") + `, ` + distance + `
+		FROM tasks t
+		JOIN tasks c ON c.id <> t.id AND c.created_at < t.created_at
+		WHERE t.id = $1
+		  AND t.` + column + ` IS NOT NULL AND c.` + column + ` IS NOT NULL
+		  AND ` + distance + ` <= $2
+		ORDER BY ` + distance + `, c.created_at DESC
+		LIMIT $3
+	`
+
+	rows, err := r.q.Query(ctx, query, id, maxDistance, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var similar []models.SimilarTask
+	for rows.Next() {
+		var distance int
+		task, err := scanTask(rows, &distance)
+		if err != nil {
+			return nil, err
+		}
+		similar = append(similar, models.SimilarTask{Task: task, Distance: distance})
+	}
+
+	return similar, rows.Err()
+}
+
+// AcquireBlob records one more reference to the blob, registering it on
+// first use.
+func (r *PostgresRepo) AcquireBlob(ctx context.Context, hash, path string, size int64) error {
+	query := `
+		INSERT INTO blobs (hash, path, size, ref_count)
+		VALUES ($1, $2, $3, 1)
+		ON CONFLICT (hash) DO UPDATE SET ref_count = blobs.ref_count + 1, updated_at = NOW()
+	`
+
+	_, err := r.q.Exec(ctx, query, hash, path, size)
+	return err
+}
+
+// ReleaseBlob drops one reference to the blob. The row is locked while its
+// count is checked; on the last reference remove is called under the lock
+// and the row is deleted only if remove succeeds, so a concurrent
+// AcquireBlob waits until the file is gone and then registers the blob anew.
+func (r *PostgresRepo) ReleaseBlob(ctx context.Context, hash string, remove func() error) error {
+	return r.InTx(ctx, func(repo Repository) error {
+		q := repo.(*PostgresRepo).q
+
+		var refCount int
+		err := q.QueryRow(ctx, `SELECT ref_count FROM blobs WHERE hash = $1 FOR UPDATE`, hash).Scan(&refCount)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+
+		if refCount > 1 {
+			_, err := q.Exec(ctx, `UPDATE blobs SET ref_count = ref_count - 1, updated_at = NOW() WHERE hash = $1`, hash)
+			return err
+		}
+
+		if err := remove(); err != nil {
+			return err
+		}
+		_, err = q.Exec(ctx, `DELETE FROM blobs WHERE hash = $1`, hash)
+		return err
+	})
+}
+
+func selectTaskColumns(alias string) string {
+	if alias == "" {
+		return strings.Join(taskColumns, ", ")
+	}
+
+	columns := make([]string, len(taskColumns))
+	for i, column := range taskColumns {
+		columns[i] = alias + "." + column
+	}
+	return strings.Join(columns, ", ")
+}
+
+// scanTask reads a row selected with selectTaskColumns; extra holds
+// destinations for any columns selected after the task ones.
+func scanTask(row pgx.Row, extra ...any) (*models.Task, error) {
+	var task models.Task
+	dest := []any{
+		&task.ID,
+		&task.TraceID,
+		&task.Type,
+		&task.OriginalFilename,
+		&task.FilePath,
+		&task.OutputFormat,
+		&task.TargetWidth,
+		&task.TargetHeight,
+		&task.Crop,
+		&task.DuplicatePolicy,
+		&task.DuplicateOf,
+		&task.Priority,
+		&task.AHash,
+		&task.DHash,
+		&task.PHash,
+		&task.Options,
+		&task.Result,
+		&task.SourceHash,
+		&task.CacheKey,
+		&task.UploadSize,
+		&task.JobID,
+		&task.RetryOf,
+		&task.Attempt,
+		&task.RunAt,
+		&task.Status,
+		&task.ErrorMessage,
+		&task.CreatedAt,
+		&task.UpdatedAt,
+		&task.CompletedAt,
+	}
+
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	return &task, nil
+}
@@ -3,18 +3,53 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"mediaConverter/api/models"
 )
 
 var (
-	ErrTaskNotFound      = errors.New("task not found")
-	ErrTaskAlreadyExists = errors.New("task already exists")
+	ErrTaskNotFound       = errors.New("task not found")
+	ErrTaskAlreadyExists  = errors.New("task already exists")
+	ErrTaskNotAwaiting    = errors.New("task is not awaiting an upload")
+	ErrUploadNotFound     = errors.New("upload not found")
+	ErrOffsetConflict     = errors.New("upload offset has changed")
+	ErrUploadCompleting   = errors.New("upload is already being completed")
+	ErrJobNotFound        = errors.New("job not found")
+	ErrTaskNotRequeueable = errors.New("task is neither pending nor failed")
+	ErrTaskNotCancellable = errors.New("task is already finished")
 )
 
 type Repository interface {
+	InTx(ctx context.Context, fn func(Repository) error) error
 	CreateTask(ctx context.Context, task *models.Task) error
 	GetTask(ctx context.Context, id string) (*models.Task, error)
 	GetTaskByTraceID(ctx context.Context, traceID string) (*models.Task, error)
+	FindCachedResult(ctx context.Context, cacheKey string) (*models.Task, error)
 	UpdateTaskStatus(ctx context.Context, id string, status models.TaskStatus, errorMessage string) error
+	CommitUpload(ctx context.Context, id, filePath, sourceHash string) error
+	RequeueTask(ctx context.Context, task *models.Task) error
+	CancelTask(ctx context.Context, id string) (models.TaskStatus, error)
+	StartDueTasks(ctx context.Context, limit int) ([]*models.Task, error)
+	ListScheduledTasks(ctx context.Context, limit int) ([]*models.Task, error)
+	AddTaskEvent(ctx context.Context, taskID, event, actor, message string) error
+	FindSimilarTasks(ctx context.Context, id string, hash models.HashType, maxDistance, limit int) ([]models.SimilarTask, error)
+	AcquireBlob(ctx context.Context, hash, path string, size int64) error
+	ReleaseBlob(ctx context.Context, hash string, remove func() error) error
+	CreateTusUpload(ctx context.Context, upload *models.TusUpload) error
+	GetTusUpload(ctx context.Context, id string) (*models.TusUpload, error)
+	AppendTusChunk(ctx context.Context, id string, offset, newOffset int64, key string) error
+	ClaimTusCompletion(ctx context.Context, id string, staleBefore time.Time) error
+	ReleaseTusCompletion(ctx context.Context, id string) error
+	SetTusUploadTask(ctx context.Context, id, taskID string) error
+	DeleteTusUpload(ctx context.Context, id string) error
+	ListExpiredTusUploads(ctx context.Context, before time.Time, limit int) ([]*models.TusUpload, error)
+	CreateJob(ctx context.Context, job *models.Job) error
+	GetJob(ctx context.Context, id string) (*models.Job, error)
+	CountJobTasks(ctx context.Context, jobID string) (map[models.TaskStatus]int, error)
+	ListJobTasks(ctx context.Context, jobID string) ([]*models.Task, error)
+	EnqueueTask(ctx context.Context, msg *models.OutboxMessage) error
+	RelayOutbox(ctx context.Context, limit int, publish func(*models.OutboxMessage) error) (int, error)
+	OutboxStats(ctx context.Context) (*models.OutboxStats, error)
+	PurgeOutbox(ctx context.Context, before time.Time) (int, error)
 }
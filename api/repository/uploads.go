@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"mediaConverter/api/models"
+)
+
+const tusUploadColumns = `id, trace_id, upload_length, upload_offset, metadata, chunks, task_id, expires_at, created_at, updated_at`
+
+func (r *PostgresRepo) CreateTusUpload(ctx context.Context, upload *models.TusUpload) error {
+	query := `
+		INSERT INTO tus_uploads (trace_id, upload_length, metadata, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+	`
+
+	if upload.Metadata == nil {
+		upload.Metadata = map[string]string{}
+	}
+
+	return r.q.QueryRow(ctx, query,
+		upload.TraceID,
+		upload.Length,
+		upload.Metadata,
+		upload.ExpiresAt,
+	).Scan(&upload.ID, &upload.CreatedAt, &upload.UpdatedAt)
+}
+
+func (r *PostgresRepo) GetTusUpload(ctx context.Context, id string) (*models.TusUpload, error) {
+	query := `SELECT ` + tusUploadColumns + ` FROM tus_uploads WHERE id = $1`
+
+	upload, err := scanTusUpload(r.q.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// AppendTusChunk records a stored chunk and advances the offset, provided no
+// other request has moved it since offset was read. Otherwise it returns
+// ErrOffsetConflict and the caller's chunk is not part of the upload.
+func (r *PostgresRepo) AppendTusChunk(ctx context.Context, id string, offset, newOffset int64, key string) error {
+	query := `
+		UPDATE tus_uploads
+		SET upload_offset = $3, chunks = array_append(chunks, $4), updated_at = NOW()
+		WHERE id = $1 AND upload_offset = $2
+	`
+
+	result, err := r.q.Exec(ctx, query, id, offset, newOffset, key)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrOffsetConflict
+	}
+
+	return nil
+}
+
+// ClaimTusCompletion marks an upload as being completed, so that racing or
+// retried final PATCHes create a single task. A claim older than staleBefore
+// belongs to a request that died and can be taken over.
+func (r *PostgresRepo) ClaimTusCompletion(ctx context.Context, id string, staleBefore time.Time) error {
+	query := `
+		UPDATE tus_uploads
+		SET completing_since = NOW(), updated_at = NOW()
+		WHERE id = $1 AND task_id IS NULL AND (completing_since IS NULL OR completing_since < $2)
+	`
+
+	result, err := r.q.Exec(ctx, query, id, staleBefore)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrUploadCompleting
+	}
+
+	return nil
+}
+
+// ReleaseTusCompletion drops the claim of a completion that failed, so the
+// client can retry it.
+func (r *PostgresRepo) ReleaseTusCompletion(ctx context.Context, id string) error {
+	_, err := r.q.Exec(ctx, `UPDATE tus_uploads SET completing_since = NULL, updated_at = NOW() WHERE id = $1 AND task_id IS NULL`, id)
+	return err
+}
+
+// SetTusUploadTask links a completed upload to the task created from it. The
+// chunks are dropped from the row, since their content now lives in a blob.
+func (r *PostgresRepo) SetTusUploadTask(ctx context.Context, id, taskID string) error {
+	query := `
+		UPDATE tus_uploads
+		SET task_id = $2, chunks = '{}', completing_since = NULL, updated_at = NOW()
+		WHERE id = $1 AND task_id IS NULL
+	`
+
+	result, err := r.q.Exec(ctx, query, id, taskID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrUploadNotFound
+	}
+
+	return nil
+}
+
+func (r *PostgresRepo) DeleteTusUpload(ctx context.Context, id string) error {
+	result, err := r.q.Exec(ctx, `DELETE FROM tus_uploads WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrUploadNotFound
+	}
+
+	return nil
+}
+
+func (r *PostgresRepo) ListExpiredTusUploads(ctx context.Context, before time.Time, limit int) ([]*models.TusUpload, error) {
+	query := `
+		SELECT ` + tusUploadColumns + `
+		FROM tus_uploads
+		WHERE expires_at < $1
+		ORDER BY expires_at
+		LIMIT $2
+	`
+
+	rows, err := r.q.Query(ctx, query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uploads []*models.TusUpload
+	for rows.Next() {
+		upload, err := scanTusUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, rows.Err()
+}
+
+func scanTusUpload(row pgx.Row) (*models.TusUpload, error) {
+	var upload models.TusUpload
+	err := row.Scan(
+		&upload.ID,
+		&upload.TraceID,
+		&upload.Length,
+		&upload.Offset,
+		&upload.Metadata,
+		&upload.Chunks,
+		&upload.TaskID,
+		&upload.ExpiresAt,
+		&upload.CreatedAt,
+		&upload.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &upload, nil
+}
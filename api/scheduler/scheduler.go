@@ -0,0 +1,116 @@
+// Package scheduler queues scheduled tasks once their run_at has passed.
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mediaConverter/api/metrics"
+)
+
+// LockKey is the Postgres advisory lock held by the scheduler leader.
+const LockKey int64 = 0x6d63_7363_6865_6400
+
+const (
+	batchSize      = 100
+	releaseTimeout = 5 * time.Second
+)
+
+// Lock elects the leader among API replicas.
+type Lock interface {
+	// TryAcquire reports whether the lock is held, taking it if it is free.
+	TryAcquire(ctx context.Context) (bool, error)
+	Release(ctx context.Context)
+}
+
+type Tasks interface {
+	// StartDueTasks queues up to limit due tasks and returns how many it
+	// queued.
+	StartDueTasks(ctx context.Context, limit int) (int, error)
+}
+
+// Scheduler runs on every API replica, but only the one holding the lock
+// queues tasks; the others take over if it stops or loses its connection.
+type Scheduler struct {
+	lock     Lock
+	tasks    Tasks
+	interval time.Duration
+	logger   *zap.Logger
+	leader   bool
+}
+
+func NewScheduler(lock Lock, tasks Tasks, interval time.Duration, logger *zap.Logger) *Scheduler {
+	return &Scheduler{
+		lock:     lock,
+		tasks:    tasks,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run queues due tasks every interval while leading, until ctx is done, and
+// then gives up the lock.
+func (s *Scheduler) Run(ctx context.Context) {
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+		defer cancel()
+		s.lock.Release(releaseCtx)
+		s.setLeader(false)
+	}()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	leader, err := s.lock.TryAcquire(ctx)
+	if err != nil {
+		s.logger.Warn("Failed to acquire scheduler lock", zap.Error(err))
+	}
+	s.setLeader(leader)
+	if !leader {
+		return
+	}
+
+	for ctx.Err() == nil {
+		started, err := s.tasks.StartDueTasks(ctx, batchSize)
+		if err != nil {
+			s.logger.Error("Failed to start scheduled tasks", zap.Error(err))
+			return
+		}
+		metrics.ScheduledTasksStarted.Add(float64(started))
+		if started > 0 {
+			s.logger.Info("Started scheduled tasks", zap.Int("count", started))
+		}
+		if started < batchSize {
+			return
+		}
+	}
+}
+
+func (s *Scheduler) setLeader(leader bool) {
+	if leader == s.leader {
+		return
+	}
+	s.leader = leader
+
+	if leader {
+		s.logger.Info("Became scheduler leader")
+		metrics.SchedulerLeader.Set(1)
+	} else {
+		s.logger.Info("Gave up scheduler leadership")
+		metrics.SchedulerLeader.Set(0)
+	}
+}
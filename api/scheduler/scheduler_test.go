@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+type fakeLock struct {
+	free     bool
+	err      error
+	released bool
+}
+
+func (f *fakeLock) TryAcquire(ctx context.Context) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	return f.free, nil
+}
+
+func (f *fakeLock) Release(ctx context.Context) {
+	f.released = true
+}
+
+type fakeTasks struct {
+	due   int
+	calls int
+}
+
+func (f *fakeTasks) StartDueTasks(ctx context.Context, limit int) (int, error) {
+	f.calls++
+	n := min(f.due, limit)
+	f.due -= n
+	return n, nil
+}
+
+func TestSchedulerStartsDueTasksWhenLeading(t *testing.T) {
+	tasks := &fakeTasks{due: batchSize + 5}
+	s := NewScheduler(&fakeLock{free: true}, tasks, 0, zaptest.NewLogger(t))
+
+	s.tick(context.Background())
+
+	if tasks.due != 0 || tasks.calls != 2 {
+		t.Errorf("expected every due task started in 2 batches, got %d left after %d calls", tasks.due, tasks.calls)
+	}
+	if !s.leader {
+		t.Error("expected the scheduler to lead")
+	}
+}
+
+func TestSchedulerFollowerStartsNothing(t *testing.T) {
+	for name, lock := range map[string]*fakeLock{
+		"held elsewhere": {free: false},
+		"lock error":     {err: errors.New("connection refused")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tasks := &fakeTasks{due: 3}
+			s := NewScheduler(lock, tasks, 0, zaptest.NewLogger(t))
+			s.leader = true
+
+			s.tick(context.Background())
+
+			if tasks.calls != 0 {
+				t.Errorf("expected a follower to start nothing, got %d calls", tasks.calls)
+			}
+			if s.leader {
+				t.Error("expected leadership to be given up")
+			}
+		})
+	}
+}
+
+func TestSchedulerReleasesLockOnStop(t *testing.T) {
+	lock := &fakeLock{free: true}
+	s := NewScheduler(lock, &fakeTasks{}, 1, zaptest.NewLogger(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Run(ctx)
+
+	if !lock.released || s.leader {
+		t.Errorf("expected the lock released on stop, released=%v leader=%v", lock.released, s.leader)
+	}
+}
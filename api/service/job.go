@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/models"
+	"mediaConverter/api/repository"
+)
+
+// unfinishedStatuses are the statuses a task leaves before its job is done.
+var unfinishedStatuses = []models.TaskStatus{
+	models.StatusAwaitingUpload,
+	models.StatusScheduled,
+	models.StatusPending,
+	models.StatusProcessing,
+}
+
+// CreateJob creates a batch with a task for each of reqs. The job, its tasks
+// and their outbox messages share one transaction, so a failure leaves none
+// of them behind.
+func (s *TaskService) CreateJob(ctx context.Context, traceID string, reqs []*dto.CreateTaskRequest) (*dto.JobResponse, error) {
+	job := &models.Job{TraceID: traceID}
+	tasks := make([]*models.Task, 0, len(reqs))
+
+	err := s.repo.InTx(ctx, func(repo repository.Repository) error {
+		if err := repo.CreateJob(ctx, job); err != nil {
+			return err
+		}
+		for _, req := range reqs {
+			task := newTask(traceID, req)
+			task.JobID = &job.ID
+			if err := s.insertTask(ctx, repo, task); err != nil {
+				return err
+			}
+			tasks = append(tasks, task)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.created(ctx, tasks...)
+
+	counts := make(map[models.TaskStatus]int)
+	for _, task := range tasks {
+		counts[task.Status]++
+	}
+	return jobResponse(job, counts), nil
+}
+
+func (s *TaskService) GetJob(ctx context.Context, jobID string) (*dto.JobResponse, error) {
+	job, err := s.repo.GetJob(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, repository.ErrJobNotFound) {
+			return nil, dto.ErrJobNotFound
+		}
+		return nil, err
+	}
+
+	counts, err := s.repo.CountJobTasks(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	return jobResponse(job, counts), nil
+}
+
+// GetJobOutputs lists the results of a finished job. Failed tasks have no
+// output and are left out.
+func (s *TaskService) GetJobOutputs(ctx context.Context, jobID string) ([]dto.JobOutput, error) {
+	job, err := s.GetJob(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if !job.Done {
+		return nil, dto.ErrJobNotFinished
+	}
+
+	tasks, err := s.repo.ListJobTasks(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]dto.JobOutput, 0, len(tasks))
+	for _, task := range tasks {
+		resp := s.toResponse(task)
+		if resp.OutputFilename == "" {
+			continue
+		}
+		outputs = append(outputs, dto.JobOutput{
+			TaskID:           task.ID,
+			OriginalFilename: task.OriginalFilename,
+			OutputFilename:   resp.OutputFilename,
+		})
+	}
+
+	return outputs, nil
+}
+
+func jobResponse(job *models.Job, counts map[models.TaskStatus]int) *dto.JobResponse {
+	resp := &dto.JobResponse{
+		ID:        job.ID,
+		TraceID:   job.TraceID,
+		Counts:    make(map[string]int, len(counts)),
+		CreatedAt: job.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+
+	for status, count := range counts {
+		resp.Counts[string(status)] = count
+		resp.Total += count
+	}
+
+	unfinished := 0
+	for _, status := range unfinishedStatuses {
+		unfinished += counts[status]
+	}
+	resp.Done = resp.Total > 0 && unfinished == 0
+	if resp.Done {
+		resp.DownloadURL = "/jobs/" + job.ID + "/download"
+	}
+
+	return resp
+}
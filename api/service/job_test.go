@@ -0,0 +1,33 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"mediaConverter/api/models"
+)
+
+func TestJobResponse(t *testing.T) {
+	job := &models.Job{ID: "job-1", CreatedAt: time.Now()}
+
+	running := jobResponse(job, map[models.TaskStatus]int{
+		models.StatusCompleted:  3,
+		models.StatusProcessing: 1,
+		models.StatusFailed:     1,
+	})
+	if running.Total != 5 || running.Done || running.DownloadURL != "" {
+		t.Errorf("Unexpected progress %+v", running)
+	}
+
+	done := jobResponse(job, map[models.TaskStatus]int{
+		models.StatusCompleted: 4,
+		models.StatusFailed:    1,
+	})
+	if !done.Done || done.Counts["failed"] != 1 || done.DownloadURL != "/jobs/job-1/download" {
+		t.Errorf("Unexpected progress %+v", done)
+	}
+
+	if empty := jobResponse(job, nil); empty.Done {
+		t.Error("Expected a job without tasks not to be done")
+	}
+}
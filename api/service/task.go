@@ -2,71 +2,651 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"mediaConverter/api/cache"
 	"mediaConverter/api/dto"
 	"mediaConverter/api/kafka"
+	"mediaConverter/api/metrics"
 	"mediaConverter/api/models"
 	"mediaConverter/api/repository"
+	workerkafka "mediaConverter/worker/kafka"
 )
 
+const similarTasksLimit = 50
+
+// Task events recorded by the API.
+const (
+	eventCancelled = "cancelled"
+	eventRetried   = "retried"
+	eventActorAPI  = "api"
+)
+
+// Relay publishes the task messages stored in the outbox.
+type Relay interface {
+	// Wake asks the relay to publish new messages now rather than at its
+	// next poll.
+	Wake()
+}
+
 type TaskService struct {
-	repo     repository.Repository
-	cache    *cache.StatusCache
-	producer kafka.Producer
-	topic    string
+	repo  repository.Repository
+	cache *cache.StatusCache
+	relay Relay
+	topic string
 }
 
-func NewTaskService(repo repository.Repository, cache *cache.StatusCache, producer kafka.Producer) *TaskService {
+func NewTaskService(repo repository.Repository, cache *cache.StatusCache, relay Relay) *TaskService {
 	return &TaskService{
-		repo:     repo,
-		cache:    cache,
-		producer: producer,
-		topic:    "media_tasks",
+		repo:  repo,
+		cache: cache,
+		relay: relay,
+		topic: kafka.TasksTopic,
 	}
 }
 
 func (s *TaskService) CreateTask(ctx context.Context, traceID string, req *dto.CreateTaskRequest) (*dto.TaskResponse, error) {
+	task := newTask(traceID, req)
+
+	err := s.repo.InTx(ctx, func(repo repository.Repository) error {
+		return s.insertTask(ctx, repo, task)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.created(ctx, task)
+
+	return s.toResponse(task), nil
+}
+
+// newTask builds the task requested by req, scheduled if its run_at is still
+// ahead.
+func newTask(traceID string, req *dto.CreateTaskRequest) *models.Task {
 	task := &models.Task{
 		TraceID:          traceID,
+		Type:             models.TaskType(req.Type),
 		OriginalFilename: req.OriginalFilename,
 		FilePath:         req.FilePath,
 		OutputFormat:     req.OutputFormat,
 		TargetWidth:      req.TargetWidth,
 		TargetHeight:     req.TargetHeight,
 		Crop:             req.Crop,
+		DuplicatePolicy:  models.DuplicatePolicy(req.DuplicatePolicy),
+		Priority:         models.Priority(req.Priority),
+		Options:          req.Options,
 		Status:           models.StatusPending,
 	}
 
+	if req.SourceHash != "" {
+		task.SourceHash = &req.SourceHash
+	}
+	if req.JobID != "" {
+		task.JobID = &req.JobID
+	}
+	if isFuture(req.RunAt) {
+		runAt := req.RunAt.UTC()
+		task.RunAt = &runAt
+		task.Status = models.StatusScheduled
+	}
+
+	if key := resultCacheKey(req); key != "" {
+		task.CacheKey = &key
+	}
+
+	return task
+}
+
+// insertTask stores task through repo and, if it is pending, its message in
+// the outbox. A task whose result is cached is stored as completed instead.
+func (s *TaskService) insertTask(ctx context.Context, repo repository.Repository, task *models.Task) error {
+	// A scheduled task skips the result cache, so that its output does not
+	// appear before run_at.
+	if task.CacheKey != nil && task.Status == models.StatusPending {
+		cached, err := repo.FindCachedResult(ctx, *task.CacheKey)
+		if err == nil {
+			completeFromCache(task, cached)
+			if err := repo.CreateTask(ctx, task); err != nil {
+				return err
+			}
+			metrics.ResultCacheHits.WithLabelValues(string(task.Type)).Inc()
+			return nil
+		}
+		if !errors.Is(err, repository.ErrTaskNotFound) {
+			return err
+		}
+		metrics.ResultCacheMisses.WithLabelValues(string(task.Type)).Inc()
+	}
+
+	if err := repo.CreateTask(ctx, task); err != nil {
+		return err
+	}
+	if task.Status != models.StatusPending {
+		return nil
+	}
+	return s.enqueue(ctx, repo, task)
+}
+
+// created wakes the relay for the queued ones among tasks once their
+// transaction has committed, and caches their status.
+func (s *TaskService) created(ctx context.Context, tasks ...*models.Task) {
+	for _, task := range tasks {
+		if task.Status == models.StatusPending {
+			s.relay.Wake()
+			break
+		}
+	}
+	for _, task := range tasks {
+		s.cache.Set(ctx, task.ID, task.Status)
+	}
+}
+
+// CreatePendingUpload stores a task whose source the client uploads directly
+// to storage. It is enqueued by CommitUpload once the upload is verified.
+func (s *TaskService) CreatePendingUpload(ctx context.Context, traceID string, req *dto.CreateTaskRequest, size int64) (*dto.TaskResponse, error) {
+	task := &models.Task{
+		TraceID:          traceID,
+		Type:             models.TaskTypeConvert,
+		OriginalFilename: req.OriginalFilename,
+		FilePath:         req.FilePath,
+		OutputFormat:     req.OutputFormat,
+		TargetWidth:      req.TargetWidth,
+		TargetHeight:     req.TargetHeight,
+		Crop:             req.Crop,
+		DuplicatePolicy:  models.DuplicatePolicy(req.DuplicatePolicy),
+		Priority:         models.Priority(req.Priority),
+		UploadSize:       &size,
+		Status:           models.StatusAwaitingUpload,
+	}
+	if isFuture(req.RunAt) {
+		runAt := req.RunAt.UTC()
+		task.RunAt = &runAt
+	}
+
 	if err := s.repo.CreateTask(ctx, task); err != nil {
 		return nil, err
 	}
 
+	s.cache.Set(ctx, task.ID, models.StatusAwaitingUpload)
+
+	return s.toResponse(task), nil
+}
+
+func (s *TaskService) GetPendingUpload(ctx context.Context, taskID string) (*dto.PendingUpload, error) {
+	task, err := s.getTask(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if task.Status != models.StatusAwaitingUpload || task.UploadSize == nil {
+		return nil, dto.ErrUploadNotReady
+	}
+
+	return &dto.PendingUpload{
+		TaskID:   task.ID,
+		Key:      task.FilePath,
+		Filename: task.OriginalFilename,
+		Size:     *task.UploadSize,
+	}, nil
+}
+
+// CommitUpload queues a task created by CreatePendingUpload, or schedules it
+// if its run_at is still ahead, with filePath, the verified copy of the
+// upload, as its source. Only the first commit of a task succeeds.
+func (s *TaskService) CommitUpload(ctx context.Context, taskID, filePath, sourceHash string) (*dto.TaskResponse, error) {
+	var task *models.Task
+	err := s.repo.InTx(ctx, func(repo repository.Repository) error {
+		if err := repo.CommitUpload(ctx, taskID, filePath, sourceHash); err != nil {
+			if errors.Is(err, repository.ErrTaskNotAwaiting) {
+				return dto.ErrUploadNotReady
+			}
+			return err
+		}
+
+		var err error
+		task, err = repo.GetTask(ctx, taskID)
+		if err != nil {
+			return err
+		}
+		if task.Status == models.StatusScheduled {
+			return nil
+		}
+		return s.enqueue(ctx, repo, task)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if task.Status == models.StatusPending {
+		s.relay.Wake()
+	}
+
+	s.cache.Set(ctx, task.ID, task.Status)
+
+	return s.toResponse(task), nil
+}
+
+// StartDueTasks queues up to limit scheduled tasks whose run_at has passed
+// and returns how many it queued.
+func (s *TaskService) StartDueTasks(ctx context.Context, limit int) (int, error) {
+	var tasks []*models.Task
+	err := s.repo.InTx(ctx, func(repo repository.Repository) error {
+		var err error
+		tasks, err = repo.StartDueTasks(ctx, limit)
+		if err != nil {
+			return err
+		}
+		for _, task := range tasks {
+			if err := s.enqueue(ctx, repo, task); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(tasks) > 0 {
+		s.relay.Wake()
+	}
+	for _, task := range tasks {
+		s.cache.Set(ctx, task.ID, models.StatusPending)
+	}
+
+	return len(tasks), nil
+}
+
+// ListScheduledTasks returns up to limit scheduled tasks, the next due first.
+func (s *TaskService) ListScheduledTasks(ctx context.Context, limit int) (*dto.TaskListResponse, error) {
+	tasks, err := s.repo.ListScheduledTasks(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &dto.TaskListResponse{Tasks: make([]*dto.TaskResponse, 0, len(tasks))}
+	for _, task := range tasks {
+		resp.Tasks = append(resp.Tasks, s.toResponse(task))
+	}
+
+	return resp, nil
+}
+
+// ReplayTask queues a pending or failed task again, typically one whose
+// message ended up on the dead-letter topic. Parameters set in req replace
+// the task's own before it is queued.
+func (s *TaskService) ReplayTask(ctx context.Context, taskID string, req *dto.ReplayRequest) (*dto.TaskResponse, error) {
+	task, err := s.getTask(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.OutputFormat != nil {
+		task.OutputFormat = *req.OutputFormat
+	}
+	if req.TargetWidth != nil {
+		task.TargetWidth = req.TargetWidth
+	}
+	if req.TargetHeight != nil {
+		task.TargetHeight = req.TargetHeight
+	}
+	if req.Crop != nil {
+		task.Crop = *req.Crop
+	}
+	// The row answers cache lookups once it completes, so the key has to
+	// follow the replaced parameters.
+	task.CacheKey = taskCacheKey(task)
+
+	err = s.repo.InTx(ctx, func(repo repository.Repository) error {
+		if err := repo.RequeueTask(ctx, task); err != nil {
+			if errors.Is(err, repository.ErrTaskNotRequeueable) {
+				return dto.ErrNotReplayable
+			}
+			return err
+		}
+		return s.enqueue(ctx, repo, task)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.relay.Wake()
+
+	task.Status = models.StatusPending
+	task.ErrorMessage = ""
+	task.CompletedAt = nil
+
 	s.cache.Set(ctx, task.ID, models.StatusPending)
 
+	return s.toResponse(task), nil
+}
+
+// RetryTask queues a new attempt of a failed task, reusing its source and
+// parameters. Parameters set in req replace the task's own. Each task can be
+// retried once; later attempts retry the latest one.
+func (s *TaskService) RetryTask(ctx context.Context, traceID, taskID string, req *dto.RetryRequest) (*dto.TaskResponse, error) {
+	original, err := s.getTask(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if original.Status != models.StatusFailed {
+		return nil, dto.ErrNotRetryable
+	}
+
+	task := &models.Task{
+		TraceID:          traceID,
+		Type:             original.Type,
+		OriginalFilename: original.OriginalFilename,
+		FilePath:         original.FilePath,
+		OutputFormat:     original.OutputFormat,
+		TargetWidth:      original.TargetWidth,
+		TargetHeight:     original.TargetHeight,
+		Crop:             original.Crop,
+		DuplicatePolicy:  original.DuplicatePolicy,
+		Priority:         original.Priority,
+		Options:          original.Options,
+		SourceHash:       original.SourceHash,
+		RetryOf:          &original.ID,
+		Attempt:          original.Attempt + 1,
+		Status:           models.StatusPending,
+	}
+
+	if req.OutputFormat != nil {
+		task.OutputFormat = *req.OutputFormat
+	}
+	if req.TargetWidth != nil {
+		task.TargetWidth = req.TargetWidth
+	}
+	if req.TargetHeight != nil {
+		task.TargetHeight = req.TargetHeight
+	}
+	if req.Crop != nil {
+		task.Crop = *req.Crop
+	}
+
+	task.CacheKey = taskCacheKey(task)
+
+	err = s.repo.InTx(ctx, func(repo repository.Repository) error {
+		if err := repo.CreateTask(ctx, task); err != nil {
+			if errors.Is(err, repository.ErrTaskAlreadyExists) {
+				return dto.ErrAlreadyRetried
+			}
+			return err
+		}
+		if err := repo.AddTaskEvent(ctx, original.ID, eventRetried, eventActorAPI, task.ID); err != nil {
+			return err
+		}
+		return s.enqueue(ctx, repo, task)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.relay.Wake()
+
+	s.cache.Set(ctx, task.ID, models.StatusPending)
+
+	return s.toResponse(task), nil
+}
+
+// CancelTask stops an unfinished task, scheduled ones included. Running
+// workers are told over pub/sub; one that misses the message notices when it
+// next renews its lease. For a task no worker has picked up, the result also
+// lists the stored sources the caller should free.
+func (s *TaskService) CancelTask(ctx context.Context, taskID string) (*dto.CancelledTask, error) {
+	var task *models.Task
+	var previous models.TaskStatus
+	err := s.repo.InTx(ctx, func(repo repository.Repository) error {
+		var err error
+		if previous, err = repo.CancelTask(ctx, taskID); err != nil {
+			if !errors.Is(err, repository.ErrTaskNotCancellable) {
+				return err
+			}
+			if _, err := repo.GetTask(ctx, taskID); errors.Is(err, repository.ErrTaskNotFound) {
+				return dto.ErrTaskNotFound
+			}
+			return dto.ErrNotCancellable
+		}
+		if err := repo.AddTaskEvent(ctx, taskID, eventCancelled, eventActorAPI, ""); err != nil {
+			return err
+		}
+
+		task, err = repo.GetTask(ctx, taskID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(ctx, task.ID, models.StatusCancelled)
+	s.cache.PublishCancellation(ctx, task.ID)
+
+	cancelled := &dto.CancelledTask{Task: s.toResponse(task)}
+	switch previous {
+	case models.StatusAwaitingUpload:
+		cancelled.Upload = task.FilePath
+	case models.StatusScheduled, models.StatusPending:
+		cancelled.Blobs = ownedBlobs(task)
+	}
+	return cancelled, nil
+}
+
+// ownedBlobs lists the blobs task took a reference to when it was created.
+// A retry shares the blobs of the task it retries. Contact sheet sources are
+// not included, since those may belong to other tasks.
+func ownedBlobs(task *models.Task) []string {
+	if task.RetryOf != nil {
+		return nil
+	}
+
+	var keys []string
+	if task.FilePath != "" {
+		keys = append(keys, task.FilePath)
+	}
+	if task.Type == models.TaskTypeCompare {
+		var opts dto.CompareOptions
+		if err := json.Unmarshal(task.Options, &opts); err == nil && opts.CandidatePath != "" {
+			keys = append(keys, opts.CandidatePath)
+		}
+	}
+	return keys
+}
+
+// enqueue stores the message of task in the outbox through repo, which
+// should be the transaction that makes the task pending.
+func (s *TaskService) enqueue(ctx context.Context, repo repository.Repository, task *models.Task) error {
 	msg := &kafka.TaskMessage{
 		TaskID:       task.ID,
-		TraceID:      traceID,
-		FilePath:     req.FilePath,
-		OutputFormat: req.OutputFormat,
-		TargetWidth:  req.TargetWidth,
-		TargetHeight: req.TargetHeight,
-		Crop:         req.Crop,
-	}
-	if err := s.producer.SendTaskMessage(ctx, s.topic, msg); err != nil {
+		TraceID:      task.TraceID,
+		FilePath:     task.FilePath,
+		OutputFormat: task.OutputFormat,
+		TargetWidth:  task.TargetWidth,
+		TargetHeight: task.TargetHeight,
+		Crop:         task.Crop,
+
+		DuplicatePolicy: string(task.DuplicatePolicy),
+		Priority:        string(task.Priority),
+
+		Type:    string(task.Type),
+		Options: task.Options,
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return repo.EnqueueTask(ctx, &models.OutboxMessage{
+		TaskID:  task.ID,
+		Topic:   workerkafka.PriorityTopic(s.topic, string(task.Priority)),
+		Payload: payload,
+	})
+}
+
+// completeFromCache marks task as already completed, pointing its output at
+// the task that produced the cached result.
+func completeFromCache(task, cached *models.Task) {
+	origin := cached.ID
+	if cached.DuplicateOf != nil {
+		origin = *cached.DuplicateOf
+	}
+	now := time.Now()
+
+	task.Status = models.StatusCompleted
+	task.DuplicateOf = &origin
+	task.Result = cached.Result
+	task.CompletedAt = &now
+}
+
+// isFuture reports whether t is set and still ahead.
+func isFuture(t *time.Time) bool {
+	return t != nil && t.After(time.Now())
+}
+
+// resultCacheKey derives the result cache key from the source hash and the
+// normalized conversion parameters. The format enters as the extension of
+// the output file, because a cache hit is served from the file its origin
+// wrote. It is empty for requests whose output
+// does not depend on a single source alone.
+func resultCacheKey(req *dto.CreateTaskRequest) string {
+	if req.SourceHash == "" || req.DuplicatePolicy == string(models.DuplicatePolicyReject) {
+		return ""
+	}
+
+	taskType := models.TaskType(req.Type)
+	if taskType == "" {
+		taskType = models.TaskTypeConvert
+	}
+	if taskType != models.TaskTypeConvert && taskType != models.TaskTypeTiles {
+		return ""
+	}
+
+	dimension := func(v *int) string {
+		if v == nil || *v <= 0 {
+			return ""
+		}
+		return strconv.Itoa(*v)
+	}
+
+	parts := []string{
+		req.SourceHash,
+		string(taskType),
+		outputExtension(req.OutputFormat, req.FilePath),
+		dimension(req.TargetWidth),
+		dimension(req.TargetHeight),
+		strconv.FormatBool(req.Crop),
+		string(req.Options),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// outputExtension returns the extension, without the dot, of the output file
+// the worker writes: the requested format as given, or the extension of the
+// source when none was requested.
+func outputExtension(format, filePath string) string {
+	if format != "" {
+		return format
+	}
+	if ext := strings.TrimPrefix(path.Ext(filePath), "."); ext != "" {
+		return ext
+	}
+	return "jpg"
+}
+
+// taskCacheKey derives the result cache key of a stored task from its
+// current parameters, or returns nil if its result is not cacheable.
+func taskCacheKey(task *models.Task) *string {
+	req := &dto.CreateTaskRequest{
+		Type:            string(task.Type),
+		FilePath:        task.FilePath,
+		OutputFormat:    task.OutputFormat,
+		TargetWidth:     task.TargetWidth,
+		TargetHeight:    task.TargetHeight,
+		Crop:            task.Crop,
+		DuplicatePolicy: string(task.DuplicatePolicy),
+		Options:         task.Options,
+	}
+	if task.SourceHash != nil {
+		req.SourceHash = *task.SourceHash
+	}
+
+	key := resultCacheKey(req)
+	if key == "" {
+		return nil
+	}
+	return &key
+}
+
+func (s *TaskService) GetTaskStatus(ctx context.Context, taskID string) (*dto.TaskResponse, error) {
+	task, err := s.getTask(ctx, taskID)
+	if err != nil {
 		return nil, err
 	}
 
 	return s.toResponse(task), nil
 }
 
-func (s *TaskService) GetTaskStatus(ctx context.Context, taskID string) (*dto.TaskResponse, error) {
+func (s *TaskService) FindSimilarTasks(ctx context.Context, taskID string, hash models.HashType, maxDistance int) (*dto.SimilarTasksResponse, error) {
+	task, err := s.getTask(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if task.AHash == nil || task.DHash == nil || task.PHash == nil {
+		return nil, dto.ErrHashesNotReady
+	}
+
+	similar, err := s.repo.FindSimilarTasks(ctx, taskID, hash, maxDistance, similarTasksLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &dto.SimilarTasksResponse{
+		TaskID:      taskID,
+		Hash:        string(hash),
+		MaxDistance: maxDistance,
+		Tasks:       make([]dto.SimilarTask, 0, len(similar)),
+	}
+	for _, st := range similar {
+		resp.Tasks = append(resp.Tasks, dto.SimilarTask{
+			TaskResponse: *s.toResponse(st.Task),
+			Distance:     st.Distance,
+		})
+	}
+
+	return resp, nil
+}
+
+// GetSourceFiles returns the stored source files of the given tasks, in the
+// same order.
+func (s *TaskService) GetSourceFiles(ctx context.Context, taskIDs []string) ([]dto.SourceFile, error) {
+	sources := make([]dto.SourceFile, 0, len(taskIDs))
+	for _, id := range taskIDs {
+		task, err := s.getTask(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, dto.SourceFile{Path: task.FilePath, Filename: task.OriginalFilename})
+	}
+
+	return sources, nil
+}
+
+func (s *TaskService) getTask(ctx context.Context, taskID string) (*models.Task, error) {
 	task, err := s.repo.GetTask(ctx, taskID)
 	if err != nil {
+		if errors.Is(err, repository.ErrTaskNotFound) {
+			return nil, dto.ErrTaskNotFound
+		}
 		return nil, err
 	}
 
-	return s.toResponse(task), nil
+	return task, nil
 }
 
 func (s *TaskService) toResponse(task *models.Task) *dto.TaskResponse {
@@ -78,24 +658,53 @@ func (s *TaskService) toResponse(task *models.Task) *dto.TaskResponse {
 
 	var outputFilename string
 	if task.Status == models.StatusCompleted {
-		ext := task.OutputFormat
-		if ext == "" {
-			ext = "jpg"
+		outputID := task.ID
+		if task.DuplicateOf != nil {
+			outputID = *task.DuplicateOf
 		}
-		outputFilename = task.ID + "." + ext
+		outputFilename = outputID + "." + outputExtension(task.OutputFormat, task.FilePath)
+	}
+
+	var duplicateOf string
+	if task.DuplicateOf != nil {
+		duplicateOf = *task.DuplicateOf
+	}
+
+	var jobID string
+	if task.JobID != nil {
+		jobID = *task.JobID
+	}
+
+	var retryOf string
+	if task.RetryOf != nil {
+		retryOf = *task.RetryOf
+	}
+
+	var runAt *string
+	if task.RunAt != nil {
+		formatted := task.RunAt.Format("2006-01-02T15:04:05Z")
+		runAt = &formatted
 	}
 
 	return &dto.TaskResponse{
 		ID:               task.ID,
 		TraceID:          task.TraceID,
+		Type:             string(task.Type),
 		OriginalFilename: task.OriginalFilename,
 		OutputFilename:   outputFilename,
 		OutputFormat:     task.OutputFormat,
 		TargetWidth:      task.TargetWidth,
 		TargetHeight:     task.TargetHeight,
 		Crop:             task.Crop,
+		DuplicateOf:      duplicateOf,
+		Priority:         string(task.Priority),
+		JobID:            jobID,
+		RunAt:            runAt,
+		RetryOf:          retryOf,
+		Attempt:          task.Attempt,
 		Status:           string(task.Status),
 		ErrorMessage:     task.ErrorMessage,
+		Result:           task.Result,
 		CreatedAt:        task.CreatedAt.Format("2006-01-02T15:04:05Z"),
 		CompletedAt:      completedAt,
 	}
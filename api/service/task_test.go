@@ -0,0 +1,158 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/models"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestResultCacheKey(t *testing.T) {
+	base := dto.CreateTaskRequest{
+		SourceHash:   "abc",
+		FilePath:     "blobs/ab/abc.jpg",
+		OutputFormat: "jpg",
+		TargetWidth:  intPtr(100),
+	}
+	key := resultCacheKey(&base)
+	if key == "" {
+		t.Fatal("expected a cache key for a convert task")
+	}
+
+	equivalent := base
+	equivalent.Type = "convert"
+	equivalent.OutputFormat = ""
+	equivalent.TargetHeight = intPtr(0)
+	if got := resultCacheKey(&equivalent); got != key {
+		t.Errorf("expected normalized parameters to share a key")
+	}
+
+	different := []func(r *dto.CreateTaskRequest){
+		func(r *dto.CreateTaskRequest) { r.SourceHash = "def" },
+		func(r *dto.CreateTaskRequest) { r.OutputFormat = "png" },
+		func(r *dto.CreateTaskRequest) { r.OutputFormat = "jpeg" },
+		func(r *dto.CreateTaskRequest) { r.TargetWidth = intPtr(200) },
+		func(r *dto.CreateTaskRequest) { r.Crop = true },
+		func(r *dto.CreateTaskRequest) {
+			r.Type = "tiles"
+			r.Options = json.RawMessage(`{"tile_size":254}`)
+		},
+	}
+	for i, change := range different {
+		req := base
+		change(&req)
+		if got := resultCacheKey(&req); got == key || got == "" {
+			t.Errorf("case %d: expected a different key, got %q", i, got)
+		}
+	}
+}
+
+func TestResultCacheKeyNotCacheable(t *testing.T) {
+	tests := map[string]dto.CreateTaskRequest{
+		"no hash":       {OutputFormat: "jpg"},
+		"reject policy": {SourceHash: "abc", DuplicatePolicy: "reject"},
+		"compare":       {SourceHash: "abc", Type: "compare"},
+		"contact sheet": {SourceHash: "abc", Type: "contact_sheet"},
+	}
+
+	for name, req := range tests {
+		if key := resultCacheKey(&req); key != "" {
+			t.Errorf("%s: expected no cache key, got %q", name, key)
+		}
+	}
+}
+
+func TestTaskCacheKey(t *testing.T) {
+	hash := "abc"
+	task := &models.Task{Type: models.TaskTypeConvert, SourceHash: &hash, OutputFormat: "jpg"}
+
+	key := taskCacheKey(task)
+	if key == nil {
+		t.Fatal("expected a cache key for a hashed convert task")
+	}
+
+	task.OutputFormat = "png"
+	task.TargetWidth = intPtr(100)
+	if replayed := taskCacheKey(task); replayed == nil || *replayed == *key {
+		t.Errorf("expected replaced parameters to change the key")
+	}
+
+	task.SourceHash = nil
+	if got := taskCacheKey(task); got != nil {
+		t.Errorf("expected no cache key without a source hash, got %q", *got)
+	}
+}
+
+// A cache hit is served from the file its origin wrote, so requests whose
+// outputs are named differently must not share a key.
+func TestResultCacheKeyOutputFile(t *testing.T) {
+	tests := []struct {
+		name          string
+		filePath      string
+		origin, reuse string
+	}{
+		{"jpeg origin", "blobs/ab/abc.jpg", "jpeg", "jpg"},
+		{"png source without format", "blobs/ab/abc.png", "", "jpg"},
+	}
+
+	for _, tt := range tests {
+		origin := &models.Task{ID: "origin", Type: models.TaskTypeConvert, FilePath: tt.filePath, OutputFormat: tt.origin}
+		request := &dto.CreateTaskRequest{SourceHash: "abc", FilePath: tt.filePath, OutputFormat: tt.reuse}
+		origin.SourceHash = &request.SourceHash
+
+		if *taskCacheKey(origin) == resultCacheKey(request) {
+			t.Errorf("%s: expected a %q request to miss", tt.name, tt.reuse)
+		}
+	}
+}
+
+func TestToResponseOutputFilename(t *testing.T) {
+	s := &TaskService{}
+	origin := "origin"
+
+	tests := []struct {
+		task *models.Task
+		want string
+	}{
+		{&models.Task{ID: "id", FilePath: "blobs/ab/abc.png"}, "id.png"},
+		{&models.Task{ID: "id", FilePath: "blobs/ab/abc.png", OutputFormat: "jpeg"}, "id.jpeg"},
+		{&models.Task{ID: "id", FilePath: "blobs/ab/abc.jpg", DuplicateOf: &origin}, "origin.jpg"},
+	}
+
+	for _, tt := range tests {
+		tt.task.Status = models.StatusCompleted
+		if got := s.toResponse(tt.task).OutputFilename; got != tt.want {
+			t.Errorf("expected %s, got %s", tt.want, got)
+		}
+	}
+}
+
+func TestOwnedBlobs(t *testing.T) {
+	retryOf := "previous"
+	compareOptions, _ := json.Marshal(dto.CompareOptions{CandidatePath: "blobs/cd/cd.png"})
+
+	tests := []struct {
+		name string
+		task *models.Task
+		want string
+	}{
+		{"upload", &models.Task{Type: models.TaskTypeConvert, FilePath: "blobs/ab/ab.jpg"}, "blobs/ab/ab.jpg"},
+		{"retry", &models.Task{Type: models.TaskTypeConvert, FilePath: "blobs/ab/ab.jpg", RetryOf: &retryOf}, ""},
+		{"compare", &models.Task{Type: models.TaskTypeCompare, FilePath: "blobs/ab/ab.jpg", Options: compareOptions}, "blobs/ab/ab.jpg,blobs/cd/cd.png"},
+		{"contact sheet", &models.Task{Type: models.TaskTypeContactSheet}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(ownedBlobs(tt.task), ","); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
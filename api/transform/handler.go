@@ -0,0 +1,195 @@
+package transform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/middleware"
+	"mediaConverter/api/rendercache"
+	"mediaConverter/worker/converter"
+	"mediaConverter/worker/storage"
+)
+
+type SourceResolver interface {
+	GetSourceFiles(ctx context.Context, taskIDs []string) ([]dto.SourceFile, error)
+}
+
+type Handler struct {
+	sources   SourceResolver
+	files     storage.Backend
+	cache     *rendercache.Cache
+	converter *converter.Converter
+	key       []byte
+	logger    *zap.Logger
+}
+
+func NewHandler(sources SourceResolver, files storage.Backend, cache *rendercache.Cache, signingKey []byte, logger *zap.Logger) *Handler {
+	return &Handler{
+		sources:   sources,
+		files:     files,
+		cache:     cache,
+		converter: converter.NewConverter(logger),
+		key:       signingKey,
+		logger:    logger,
+	}
+}
+
+// Image renders a transformation of a task's source image on request.
+//
+//	@Summary		Transform an image on the fly
+//	@Description	Synchronously render a resized, re-encoded or rotated copy of a task's source image. The URL must be signed with the server's IMG_SIGNING_KEY; results are cached on disk.
+//	@Tags			transform
+//	@Produce		jpeg,png,gif
+//	@Param			signature	path	string	true	"Unpadded base64url HMAC-SHA256 of /{ops}/{taskID}"
+//	@Param			ops			path	string	true	"Comma-separated operations, e.g. w:300,h:200,fit:cover,f:png,q:80,rot:90,gray:1"
+//	@Param			taskID		path	string	true	"Task ID"
+//	@Success		200
+//	@Failure		400	{object}	dto.ErrorResponse
+//	@Failure		403	{object}	dto.ErrorResponse
+//	@Failure		404	{object}	dto.ErrorResponse
+//	@Router			/img/{signature}/{ops}/{taskID} [get]
+func (h *Handler) Image(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+
+	rawOps := r.PathValue("ops")
+	taskID := r.PathValue("taskID")
+
+	if !Verify(h.key, r.PathValue("signature"), rawOps, taskID) {
+		h.handleError(w, "Invalid signature", nil, traceID, http.StatusForbidden)
+		return
+	}
+
+	ops, err := ParseOps(rawOps)
+	if err != nil {
+		h.handleError(w, err.Error(), err, traceID, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := uuid.Parse(taskID); err != nil {
+		h.handleError(w, "Image not found", err, traceID, http.StatusNotFound)
+		return
+	}
+
+	sources, err := h.sources.GetSourceFiles(r.Context(), []string{taskID})
+	if err != nil {
+		if errors.Is(err, dto.ErrTaskNotFound) {
+			h.handleError(w, "Image not found", err, traceID, http.StatusNotFound)
+			return
+		}
+		h.handleError(w, "Failed to resolve image", err, traceID, http.StatusInternalServerError)
+		return
+	}
+	source := sources[0]
+
+	format := ops.Format
+	if format == "" {
+		format = sourceFormat(source.Path)
+	}
+
+	key := rendercache.Key("img", taskID, source.Path, ops.String(), format)
+
+	file, err := h.cache.Open(key)
+	if os.IsNotExist(err) {
+		err = h.cache.Put(key, func(out io.Writer) error {
+			return h.render(r.Context(), source.Path, ops, format, out)
+		})
+		if err != nil {
+			h.handleError(w, "Failed to render image", err, traceID, http.StatusInternalServerError)
+			return
+		}
+		file, err = h.cache.Open(key)
+	}
+	if err != nil {
+		h.handleError(w, "Failed to read rendered image", err, traceID, http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		h.handleError(w, "Failed to read rendered image", err, traceID, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(w, r, "", stat.ModTime(), file)
+}
+
+// render is only reached on a cache miss, so the source is fetched from
+// storage here rather than for every request.
+func (h *Handler) render(ctx context.Context, key string, ops *Ops, format string, out io.Writer) error {
+	path, cleanup, err := storage.FetchTemp(ctx, h.files, key)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	src, err := h.converter.Open(path)
+	if err != nil {
+		return err
+	}
+
+	var img image.Image = src
+	switch {
+	case ops.Width > 0 && ops.Height > 0:
+		switch ops.Fit {
+		case FitCover:
+			img = imaging.Fill(img, ops.Width, ops.Height, imaging.Center, imaging.Lanczos)
+		case FitFill:
+			img = imaging.Resize(img, ops.Width, ops.Height, imaging.Lanczos)
+		default:
+			img = imaging.Fit(img, ops.Width, ops.Height, imaging.Lanczos)
+		}
+	case ops.Width > 0 || ops.Height > 0:
+		img = imaging.Resize(img, ops.Width, ops.Height, imaging.Lanczos)
+	}
+
+	if ops.Rotation != 0 {
+		img = converter.Rotate(img, float64(ops.Rotation))
+	}
+	if ops.Gray {
+		img = imaging.Grayscale(img)
+	}
+
+	return h.converter.Encode(out, img, format, ops.Quality)
+}
+
+// sourceFormat keeps the source's encoding when no format is requested,
+// falling back to JPEG for formats the encoder does not write.
+func sourceFormat(path string) string {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if ext == "jpeg" {
+		ext = "jpg"
+	}
+	if _, ok := contentTypes[ext]; ok {
+		return ext
+	}
+	return "jpg"
+}
+
+func (h *Handler) handleError(w http.ResponseWriter, message string, err error, traceID string, status int) {
+	h.logger.Error(message,
+		zap.String("trace_id", traceID),
+		zap.Error(err),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(dto.ErrorResponse{
+		Error:   message,
+		TraceID: traceID,
+	})
+}
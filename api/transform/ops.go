@@ -0,0 +1,135 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxDimension caps the requested width and height.
+	MaxDimension = 8192
+
+	FitContain = "contain"
+	FitCover   = "cover"
+	FitFill    = "fill"
+)
+
+var ErrInvalidOps = errors.New("invalid transformation")
+
+var contentTypes = map[string]string{
+	"jpg": "image/jpeg",
+	"png": "image/png",
+	"gif": "image/gif",
+}
+
+// Ops is a parsed transformation such as "w:300,h:200,fit:cover,f:png".
+// Zero values mean "keep the source's": no resize, no rotation, the source
+// format and the default quality.
+type Ops struct {
+	Width    int
+	Height   int
+	Fit      string
+	Format   string
+	Quality  int
+	Rotation int
+	Gray     bool
+}
+
+// ParseOps parses a comma-separated list of key:value operations:
+//
+//	w:<px>      target width
+//	h:<px>      target height
+//	fit:<mode>  contain (default), cover or fill when both w and h are set
+//	f:<format>  jpg, png or gif
+//	q:<1-100>   JPEG quality
+//	rot:<deg>   clockwise rotation, a multiple of 90
+//	gray:1      convert to grayscale
+func ParseOps(s string) (*Ops, error) {
+	ops := &Ops{Fit: FitContain}
+	seen := make(map[string]bool)
+
+	for _, op := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(op, ":")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%w: malformed op %q", ErrInvalidOps, op)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("%w: duplicate op %q", ErrInvalidOps, key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "w":
+			ops.Width, err = parseInt(key, value, 1, MaxDimension)
+		case "h":
+			ops.Height, err = parseInt(key, value, 1, MaxDimension)
+		case "fit":
+			if value != FitContain && value != FitCover && value != FitFill {
+				err = fmt.Errorf("%w: fit must be contain, cover or fill", ErrInvalidOps)
+			}
+			ops.Fit = value
+		case "f":
+			if _, ok := contentTypes[value]; !ok {
+				err = fmt.Errorf("%w: format must be jpg, png or gif", ErrInvalidOps)
+			}
+			ops.Format = value
+		case "q":
+			ops.Quality, err = parseInt(key, value, 1, 100)
+		case "rot":
+			ops.Rotation, err = parseInt(key, value, 0, 270)
+			if err == nil && ops.Rotation%90 != 0 {
+				err = fmt.Errorf("%w: rot must be 0, 90, 180 or 270", ErrInvalidOps)
+			}
+		case "gray":
+			if value != "0" && value != "1" {
+				err = fmt.Errorf("%w: gray must be 0 or 1", ErrInvalidOps)
+			}
+			ops.Gray = value == "1"
+		default:
+			err = fmt.Errorf("%w: unknown op %q", ErrInvalidOps, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ops, nil
+}
+
+// String returns the canonical form of the operations, so equivalent requests
+// share a cache entry regardless of op order.
+func (o *Ops) String() string {
+	parts := []string{"fit:" + o.Fit}
+	if o.Width > 0 {
+		parts = append(parts, "w:"+strconv.Itoa(o.Width))
+	}
+	if o.Height > 0 {
+		parts = append(parts, "h:"+strconv.Itoa(o.Height))
+	}
+	if o.Format != "" {
+		parts = append(parts, "f:"+o.Format)
+	}
+	if o.Quality > 0 {
+		parts = append(parts, "q:"+strconv.Itoa(o.Quality))
+	}
+	if o.Rotation > 0 {
+		parts = append(parts, "rot:"+strconv.Itoa(o.Rotation))
+	}
+	if o.Gray {
+		parts = append(parts, "gray:1")
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func parseInt(key, value string, lo, hi int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < lo || n > hi {
+		return 0, fmt.Errorf("%w: %s must be between %d and %d", ErrInvalidOps, key, lo, hi)
+	}
+	return n, nil
+}
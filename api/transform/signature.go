@@ -0,0 +1,27 @@
+package transform
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// Sign returns the URL signature for a transformation of a task's source:
+// unpadded base64url HMAC-SHA256 of "/<ops>/<taskID>".
+func Sign(key []byte, ops, taskID string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("/" + ops + "/" + taskID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature matches ops and taskID in constant time.
+func Verify(key []byte, signature, ops, taskID string) bool {
+	got, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("/" + ops + "/" + taskID))
+	return hmac.Equal(got, mac.Sum(nil))
+}
@@ -0,0 +1,205 @@
+package transform
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap/zaptest"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/rendercache"
+	"mediaConverter/worker/storage"
+)
+
+var testKey = []byte("secret")
+
+func TestParseOps(t *testing.T) {
+	ops, err := ParseOps("h:200,w:300,fit:cover,f:png,q:80,rot:90,gray:1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := Ops{Width: 300, Height: 200, Fit: FitCover, Format: "png", Quality: 80, Rotation: 90, Gray: true}
+	if *ops != want {
+		t.Errorf("expected %+v, got %+v", want, *ops)
+	}
+
+	reordered, _ := ParseOps("gray:1,rot:90,q:80,f:png,fit:cover,w:300,h:200")
+	if ops.String() != reordered.String() {
+		t.Errorf("expected canonical forms to match: %s vs %s", ops, reordered)
+	}
+}
+
+func TestParseOpsInvalid(t *testing.T) {
+	for _, s := range []string{"", "w", "w:", "w:0", "w:99999", "w:1,w:2", "fit:stretch", "f:webp", "q:101", "rot:45", "gray:yes", "blur:3"} {
+		if _, err := ParseOps(s); !errors.Is(err, ErrInvalidOps) {
+			t.Errorf("ParseOps(%q): expected ErrInvalidOps, got %v", s, err)
+		}
+	}
+}
+
+func TestSignature(t *testing.T) {
+	taskID := uuid.New().String()
+	sig := Sign(testKey, "w:100", taskID)
+
+	if !Verify(testKey, sig, "w:100", taskID) {
+		t.Error("expected signature to verify")
+	}
+	if Verify(testKey, sig, "w:1000", taskID) {
+		t.Error("expected signature over different ops to fail")
+	}
+	if Verify([]byte("other"), sig, "w:100", taskID) {
+		t.Error("expected signature with different key to fail")
+	}
+	if Verify(testKey, "!!!", "w:100", taskID) {
+		t.Error("expected malformed signature to fail")
+	}
+}
+
+type stubResolver struct {
+	path string
+}
+
+func (s *stubResolver) GetSourceFiles(ctx context.Context, taskIDs []string) ([]dto.SourceFile, error) {
+	if s.path == "" {
+		return nil, dto.ErrTaskNotFound
+	}
+	return []dto.SourceFile{{Path: filepath.Base(s.path), Filename: filepath.Base(s.path)}}, nil
+}
+
+func newTestHandler(t *testing.T, cache *rendercache.Cache, sourcePath string) *Handler {
+	t.Helper()
+
+	root := t.TempDir()
+	if sourcePath != "" {
+		root = filepath.Dir(sourcePath)
+	}
+	files, err := storage.NewLocal(root, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHandler(&stubResolver{path: sourcePath}, files, cache, testKey, zaptest.NewLogger(t))
+}
+
+func createTestImage(t *testing.T, width, height int) string {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "source.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newRequest(signature, ops, taskID string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/img/"+signature+"/"+ops+"/"+taskID, nil)
+	req.SetPathValue("signature", signature)
+	req.SetPathValue("ops", ops)
+	req.SetPathValue("taskID", taskID)
+	return req
+}
+
+func TestImage(t *testing.T) {
+	cache, err := rendercache.New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newTestHandler(t, cache, createTestImage(t, 200, 100))
+
+	tests := []struct {
+		name       string
+		ops        string
+		wantWidth  int
+		wantHeight int
+	}{
+		{"contain", "w:50,h:50", 50, 25},
+		{"cover", "w:50,h:50,fit:cover", 50, 50},
+		{"fill", "w:50,h:50,fit:fill", 50, 50},
+		{"width only", "w:100", 100, 50},
+		{"rotate", "w:100,rot:90", 50, 100},
+	}
+
+	taskID := uuid.New().String()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.Image(w, newRequest(Sign(testKey, tt.ops, taskID), tt.ops, taskID))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+				t.Errorf("expected source format png, got %s", ct)
+			}
+
+			img, err := png.Decode(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds().Dx() != tt.wantWidth || img.Bounds().Dy() != tt.wantHeight {
+				t.Errorf("expected %dx%d, got %v", tt.wantWidth, tt.wantHeight, img.Bounds())
+			}
+		})
+	}
+
+	if cache.Size() == 0 {
+		t.Error("expected rendered images to be cached")
+	}
+}
+
+func TestImageErrors(t *testing.T) {
+	cache, err := rendercache.New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := createTestImage(t, 20, 20)
+	taskID := uuid.New().String()
+
+	tests := []struct {
+		name       string
+		source     string
+		signature  string
+		ops        string
+		taskID     string
+		wantStatus int
+	}{
+		{"bad signature", source, "AAAA", "w:10", taskID, http.StatusForbidden},
+		{"invalid ops", source, Sign(testKey, "w:0", taskID), "w:0", taskID, http.StatusBadRequest},
+		{"invalid task id", source, Sign(testKey, "w:10", "nope"), "w:10", "nope", http.StatusNotFound},
+		{"unknown task", "", Sign(testKey, "w:10", taskID), "w:10", taskID, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newTestHandler(t, cache, tt.source)
+
+			w := httptest.NewRecorder()
+			handler.Image(w, newRequest(tt.signature, tt.ops, tt.taskID))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
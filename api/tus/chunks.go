@@ -0,0 +1,55 @@
+package tus
+
+import (
+	"context"
+	"io"
+
+	"mediaConverter/worker/storage"
+)
+
+// chunkReader reads stored chunks back to back, opening each only when the
+// previous one is exhausted.
+type chunkReader struct {
+	ctx     context.Context
+	files   storage.Backend
+	keys    []string
+	current io.ReadCloser
+}
+
+func newChunkReader(ctx context.Context, files storage.Backend, keys []string) *chunkReader {
+	return &chunkReader{ctx: ctx, files: files, keys: keys}
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if len(c.keys) == 0 {
+				return 0, io.EOF
+			}
+			body, _, err := c.files.Get(c.ctx, c.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			c.current = body
+			c.keys = c.keys[1:]
+		}
+
+		n, err := c.current.Read(p)
+		if err == io.EOF {
+			c.current.Close()
+			c.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.current != nil {
+		return c.current.Close()
+	}
+	return nil
+}
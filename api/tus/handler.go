@@ -0,0 +1,572 @@
+package tus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"mediaConverter/api/dto"
+	"mediaConverter/api/middleware"
+	"mediaConverter/api/models"
+	"mediaConverter/api/repository"
+	"mediaConverter/worker/storage"
+)
+
+const (
+	Version    = "1.0.0"
+	Extensions = "creation,expiration,checksum,termination"
+
+	// Expiration is how long an upload can be resumed after it was created.
+	Expiration = 24 * time.Hour
+
+	// StatusChecksumMismatch is the tus checksum extension's status code.
+	StatusChecksumMismatch = 460
+
+	offsetContentType = "application/offset+octet-stream"
+	purgeBatch        = 100
+
+	// completionTimeout is how long a completion may run before another
+	// request can take it over.
+	completionTimeout = 10 * time.Minute
+)
+
+var (
+	// ErrInvalidUpload marks a completed upload the Completer rejected.
+	ErrInvalidUpload = errors.New("invalid upload")
+
+	errExpired    = errors.New("upload expired")
+	errCompleting = errors.New("upload is being completed")
+)
+
+// Store persists upload state, so any API replica can resume an upload.
+type Store interface {
+	CreateTusUpload(ctx context.Context, upload *models.TusUpload) error
+	GetTusUpload(ctx context.Context, id string) (*models.TusUpload, error)
+	AppendTusChunk(ctx context.Context, id string, offset, newOffset int64, key string) error
+	// ClaimTusCompletion reserves the completion of an upload for the
+	// caller. It fails with repository.ErrUploadCompleting if the upload has
+	// a task or another claim made after staleBefore.
+	ClaimTusCompletion(ctx context.Context, id string, staleBefore time.Time) error
+	ReleaseTusCompletion(ctx context.Context, id string) error
+	SetTusUploadTask(ctx context.Context, id, taskID string) error
+	DeleteTusUpload(ctx context.Context, id string) error
+	ListExpiredTusUploads(ctx context.Context, before time.Time, limit int) ([]*models.TusUpload, error)
+}
+
+// Completer turns finished uploads into tasks.
+type Completer interface {
+	// CheckMetadata validates Upload-Metadata when an upload is created.
+	CheckMetadata(metadata map[string]string) error
+	// CompleteUpload validates the uploaded content and creates a task from
+	// it, returning the task ID. Rejections wrap ErrInvalidUpload.
+	CompleteUpload(ctx context.Context, upload *models.TusUpload, content io.Reader) (string, error)
+}
+
+// Handler implements the tus 1.0 resumable upload protocol. Every PATCH
+// stores its bytes as a separate object; the chunks are concatenated and
+// handed to the Completer once the upload reaches Upload-Length.
+type Handler struct {
+	store     Store
+	files     storage.Backend
+	completer Completer
+	maxSize   int64
+	logger    *zap.Logger
+	now       func() time.Time
+}
+
+func NewHandler(store Store, files storage.Backend, completer Completer, maxSize int64, logger *zap.Logger) *Handler {
+	return &Handler{
+		store:     store,
+		files:     files,
+		completer: completer,
+		maxSize:   maxSize,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+// Options reports the protocol version and extensions.
+//
+//	@Summary		tus capabilities
+//	@Tags			tus
+//	@Success		204
+//	@Router			/tus/ [options]
+func (h *Handler) Options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", Version)
+	w.Header().Set("Tus-Version", Version)
+	w.Header().Set("Tus-Extension", Extensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.maxSize, 10))
+	w.Header().Set("Tus-Checksum-Algorithm", supportedChecksums())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Create starts a resumable upload.
+//
+//	@Summary		Create a resumable upload
+//	@Description	tus creation extension. Upload-Metadata must include filename and may carry the /upload parameters (output_format, target_width, target_height, crop, duplicate_policy, priority, run_at).
+//	@Tags			tus
+//	@Param			Tus-Resumable	header	string	true	"1.0.0"
+//	@Param			Upload-Length	header	int		true	"Total size in bytes"
+//	@Param			Upload-Metadata	header	string	true	"tus metadata"
+//	@Success		201
+//	@Failure		400	{object}	dto.ErrorResponse
+//	@Failure		412	{object}	dto.ErrorResponse
+//	@Failure		413	{object}	dto.ErrorResponse
+//	@Router			/tus/ [post]
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+	if !h.checkVersion(w, r, traceID) {
+		return
+	}
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		h.handleError(w, "Upload-Defer-Length is not supported", nil, traceID, http.StatusBadRequest)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		h.handleError(w, "Invalid Upload-Length", err, traceID, http.StatusBadRequest)
+		return
+	}
+	if length > h.maxSize {
+		h.handleError(w, "Upload exceeds Tus-Max-Size", nil, traceID, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := ParseMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		h.handleError(w, err.Error(), err, traceID, http.StatusBadRequest)
+		return
+	}
+	if err := h.completer.CheckMetadata(metadata); err != nil {
+		h.handleError(w, err.Error(), err, traceID, http.StatusBadRequest)
+		return
+	}
+
+	upload := &models.TusUpload{
+		TraceID:   traceID,
+		Length:    length,
+		Metadata:  metadata,
+		ExpiresAt: h.now().Add(Expiration).UTC(),
+	}
+	if err := h.store.CreateTusUpload(r.Context(), upload); err != nil {
+		h.handleError(w, "Failed to create upload", err, traceID, http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("Resumable upload created",
+		zap.String("trace_id", traceID),
+		zap.String("upload_id", upload.ID),
+		zap.Int64("length", length),
+	)
+
+	w.Header().Set("Location", "/tus/"+upload.ID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Head reports how much of an upload the server has.
+//
+//	@Summary		Get the offset of a resumable upload
+//	@Tags			tus
+//	@Param			id				path	string	true	"Upload ID"
+//	@Param			Tus-Resumable	header	string	true	"1.0.0"
+//	@Success		200
+//	@Failure		404
+//	@Failure		410
+//	@Router			/tus/{id} [head]
+func (h *Handler) Head(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+	if !h.checkVersion(w, r, traceID) {
+		return
+	}
+
+	upload, err := h.lookup(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.handleLookupError(w, err, traceID)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	if len(upload.Metadata) > 0 {
+		w.Header().Set("Upload-Metadata", EncodeMetadata(upload.Metadata))
+	}
+	if upload.TaskID != nil {
+		w.Header().Set("Upload-Task-ID", *upload.TaskID)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Patch appends a chunk at Upload-Offset.
+//
+//	@Summary		Upload a chunk
+//	@Description	Appends the body at Upload-Offset. An optional Upload-Checksum ("<algorithm> <base64 digest>") is verified before the chunk is kept. The response to the final chunk carries the created task in Upload-Task-ID.
+//	@Tags			tus
+//	@Accept			application/offset+octet-stream
+//	@Param			id				path	string	true	"Upload ID"
+//	@Param			Tus-Resumable	header	string	true	"1.0.0"
+//	@Param			Upload-Offset	header	int		true	"Offset the chunk starts at"
+//	@Param			Upload-Checksum	header	string	false	"Checksum of the chunk"
+//	@Success		204
+//	@Failure		400	{object}	dto.ErrorResponse
+//	@Failure		404	{object}	dto.ErrorResponse
+//	@Failure		409	{object}	dto.ErrorResponse
+//	@Failure		410	{object}	dto.ErrorResponse
+//	@Failure		415	{object}	dto.ErrorResponse
+//	@Failure		460	{object}	dto.ErrorResponse
+//	@Router			/tus/{id} [patch]
+func (h *Handler) Patch(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+	if !h.checkVersion(w, r, traceID) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != offsetContentType {
+		h.handleError(w, "Content-Type must be "+offsetContentType, nil, traceID, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	upload, err := h.lookup(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.handleLookupError(w, err, traceID)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		h.handleError(w, "Invalid Upload-Offset", err, traceID, http.StatusBadRequest)
+		return
+	}
+	if offset != upload.Offset {
+		h.handleError(w, "Upload-Offset does not match the upload", nil, traceID, http.StatusConflict)
+		return
+	}
+
+	var received int64
+	if upload.TaskID == nil && offset < upload.Length {
+		received, err = h.appendChunk(r, upload)
+		if err != nil {
+			h.handleChunkError(w, err, traceID)
+			return
+		}
+	}
+
+	if upload.TaskID == nil && upload.Offset == upload.Length {
+		taskID, err := h.complete(r.Context(), upload)
+		if err != nil {
+			if errors.Is(err, ErrInvalidUpload) {
+				h.handleError(w, err.Error(), err, traceID, http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, errCompleting) {
+				h.handleError(w, "Upload is being completed by another request", err, traceID, http.StatusConflict)
+				return
+			}
+			// The chunks are kept; an empty PATCH at the final offset retries.
+			h.handleError(w, "Failed to complete upload", err, traceID, http.StatusInternalServerError)
+			return
+		}
+		upload.TaskID = &taskID
+	}
+
+	h.logger.Debug("Chunk received",
+		zap.String("trace_id", traceID),
+		zap.String("upload_id", upload.ID),
+		zap.Int64("offset", upload.Offset),
+		zap.Int64("received", received),
+	)
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	if upload.TaskID != nil {
+		w.Header().Set("Upload-Task-ID", *upload.TaskID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Delete terminates an upload and discards what was received.
+//
+//	@Summary		Terminate a resumable upload
+//	@Tags			tus
+//	@Param			id				path	string	true	"Upload ID"
+//	@Param			Tus-Resumable	header	string	true	"1.0.0"
+//	@Success		204
+//	@Failure		404	{object}	dto.ErrorResponse
+//	@Router			/tus/{id} [delete]
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceID(r.Context())
+	if !h.checkVersion(w, r, traceID) {
+		return
+	}
+
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		h.handleLookupError(w, repository.ErrUploadNotFound, traceID)
+		return
+	}
+
+	// Expired uploads can still be terminated before they are purged.
+	upload, err := h.store.GetTusUpload(r.Context(), id)
+	if err != nil {
+		h.handleLookupError(w, err, traceID)
+		return
+	}
+
+	if err := h.discard(r.Context(), upload); err != nil {
+		h.handleError(w, "Failed to terminate upload", err, traceID, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PurgeExpired discards uploads past their expiry and returns how many were
+// removed.
+func (h *Handler) PurgeExpired(ctx context.Context) (int, error) {
+	purged := 0
+	for {
+		uploads, err := h.store.ListExpiredTusUploads(ctx, h.now(), purgeBatch)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, upload := range uploads {
+			if err := h.discard(ctx, upload); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+
+		if len(uploads) < purgeBatch {
+			return purged, nil
+		}
+	}
+}
+
+func (h *Handler) lookup(ctx context.Context, id string) (*models.TusUpload, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, repository.ErrUploadNotFound
+	}
+
+	upload, err := h.store.GetTusUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.now().After(upload.ExpiresAt) {
+		return nil, errExpired
+	}
+	return upload, nil
+}
+
+type chunkError struct {
+	message string
+	status  int
+	err     error
+}
+
+func (e *chunkError) Error() string {
+	if e.err != nil {
+		return e.message + ": " + e.err.Error()
+	}
+	return e.message
+}
+
+func (e *chunkError) Unwrap() error {
+	return e.err
+}
+
+// appendChunk stores the request body as the next chunk of upload and
+// advances upload.Offset. Without a checksum, the bytes received before a
+// client disconnects are kept, so the client resumes from there.
+func (h *Handler) appendChunk(r *http.Request, upload *models.TusUpload) (int64, error) {
+	// Storing what was received must not fail because the client went away.
+	ctx := context.WithoutCancel(r.Context())
+
+	var sum hash.Hash
+	var digest []byte
+	if header := r.Header.Get("Upload-Checksum"); header != "" {
+		var err error
+		if sum, digest, err = parseChecksum(header); err != nil {
+			return 0, &chunkError{err.Error(), http.StatusBadRequest, err}
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "tus-chunk-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var dst io.Writer = tmp
+	if sum != nil {
+		dst = io.MultiWriter(tmp, sum)
+	}
+
+	remaining := upload.Length - upload.Offset
+	n, readErr := io.Copy(dst, io.LimitReader(r.Body, remaining+1))
+	switch {
+	case n > remaining:
+		return 0, &chunkError{"Chunk exceeds Upload-Length", http.StatusRequestEntityTooLarge, nil}
+	case readErr != nil && (sum != nil || n == 0):
+		// A checksum covers the whole chunk, so a partial one is dropped.
+		return 0, &chunkError{"Failed to read chunk", http.StatusBadRequest, readErr}
+	case readErr != nil:
+		h.logger.Warn("Chunk interrupted, keeping received bytes",
+			zap.String("upload_id", upload.ID),
+			zap.Int64("received", n),
+			zap.Error(readErr),
+		)
+	case sum != nil && !bytes.Equal(sum.Sum(nil), digest):
+		return 0, &chunkError{"Checksum mismatch", StatusChecksumMismatch, nil}
+	case n == 0:
+		return 0, nil
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	key := chunkKey(upload.ID, upload.Offset)
+	if err := h.files.Put(ctx, key, tmp, n); err != nil {
+		return 0, err
+	}
+
+	if err := h.store.AppendTusChunk(ctx, upload.ID, upload.Offset, upload.Offset+n, key); err != nil {
+		h.deleteChunks(ctx, []string{key})
+		if errors.Is(err, repository.ErrOffsetConflict) {
+			return 0, &chunkError{"Upload-Offset does not match the upload", http.StatusConflict, err}
+		}
+		return 0, err
+	}
+
+	upload.Offset += n
+	upload.Chunks = append(upload.Chunks, key)
+	return n, nil
+}
+
+// complete hands the concatenated chunks to the Completer and links the
+// resulting task to the upload. The completion is claimed first, so of
+// racing or retried final PATCHes only one creates a task; the others get
+// the task once it exists.
+func (h *Handler) complete(ctx context.Context, upload *models.TusUpload) (string, error) {
+	if err := h.store.ClaimTusCompletion(ctx, upload.ID, h.now().Add(-completionTimeout)); err != nil {
+		if !errors.Is(err, repository.ErrUploadCompleting) {
+			return "", err
+		}
+		current, err := h.store.GetTusUpload(ctx, upload.ID)
+		if err != nil {
+			return "", err
+		}
+		if current.TaskID == nil {
+			return "", errCompleting
+		}
+		return *current.TaskID, nil
+	}
+
+	content := newChunkReader(ctx, h.files, upload.Chunks)
+	defer content.Close()
+
+	taskID, err := h.completer.CompleteUpload(ctx, upload, content)
+	if err != nil {
+		if errors.Is(err, ErrInvalidUpload) {
+			if err := h.discard(ctx, upload); err != nil {
+				h.logger.Warn("Failed to discard rejected upload", zap.String("upload_id", upload.ID), zap.Error(err))
+			}
+		} else if err := h.store.ReleaseTusCompletion(context.WithoutCancel(ctx), upload.ID); err != nil {
+			h.logger.Warn("Failed to release upload completion", zap.String("upload_id", upload.ID), zap.Error(err))
+		}
+		return "", err
+	}
+
+	if err := h.store.SetTusUploadTask(ctx, upload.ID, taskID); err != nil {
+		return "", err
+	}
+	h.deleteChunks(ctx, upload.Chunks)
+
+	return taskID, nil
+}
+
+// discard removes an upload and its chunks.
+func (h *Handler) discard(ctx context.Context, upload *models.TusUpload) error {
+	h.deleteChunks(ctx, upload.Chunks)
+	if err := h.store.DeleteTusUpload(ctx, upload.ID); err != nil && !errors.Is(err, repository.ErrUploadNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (h *Handler) deleteChunks(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := h.files.Delete(ctx, key); err != nil {
+			h.logger.Warn("Failed to delete upload chunk", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+func chunkKey(uploadID string, offset int64) string {
+	// The random suffix keeps chunks of racing requests at the same offset
+	// apart; only the one recorded by AppendTusChunk is used.
+	return fmt.Sprintf("tus/%s/%020d-%s", uploadID, offset, uuid.New().String()[:8])
+}
+
+// checkVersion enforces Tus-Resumable, which every request but OPTIONS must
+// carry.
+func (h *Handler) checkVersion(w http.ResponseWriter, r *http.Request, traceID string) bool {
+	w.Header().Set("Tus-Resumable", Version)
+	if r.Header.Get("Tus-Resumable") != Version {
+		w.Header().Set("Tus-Version", Version)
+		h.handleError(w, "Unsupported Tus-Resumable version", nil, traceID, http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) handleLookupError(w http.ResponseWriter, err error, traceID string) {
+	switch {
+	case errors.Is(err, repository.ErrUploadNotFound):
+		h.handleError(w, "Upload not found", err, traceID, http.StatusNotFound)
+	case errors.Is(err, errExpired):
+		h.handleError(w, "Upload expired", err, traceID, http.StatusGone)
+	default:
+		h.handleError(w, "Failed to read upload", err, traceID, http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) handleChunkError(w http.ResponseWriter, err error, traceID string) {
+	var chunkErr *chunkError
+	if errors.As(err, &chunkErr) {
+		h.handleError(w, chunkErr.message, chunkErr.err, traceID, chunkErr.status)
+		return
+	}
+	h.handleError(w, "Failed to store chunk", err, traceID, http.StatusInternalServerError)
+}
+
+func (h *Handler) handleError(w http.ResponseWriter, message string, err error, traceID string, status int) {
+	h.logger.Error(message,
+		zap.String("trace_id", traceID),
+		zap.Error(err),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(dto.ErrorResponse{
+		Error:   message,
+		TraceID: traceID,
+	})
+}
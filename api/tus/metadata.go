@@ -0,0 +1,97 @@
+package tus
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidMetadata = errors.New("invalid Upload-Metadata")
+
+// checksumAlgorithms are the Upload-Checksum algorithms accepted on PATCH;
+// the checksum extension requires sha1.
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"md5":    md5.New,
+}
+
+// ParseMetadata decodes an Upload-Metadata header: comma-separated pairs of a
+// key and an optional base64 value.
+func ParseMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" || strings.ContainsAny(key, " ,") {
+			return nil, fmt.Errorf("%w: empty or malformed key", ErrInvalidMetadata)
+		}
+		if _, dup := metadata[key]; dup {
+			return nil, fmt.Errorf("%w: duplicate key %q", ErrInvalidMetadata, key)
+		}
+
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: value of %q is not base64", ErrInvalidMetadata, key)
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
+
+// EncodeMetadata is the inverse of ParseMetadata, with keys sorted.
+func EncodeMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k
+		if v := metadata[k]; v != "" {
+			pairs[i] += " " + base64.StdEncoding.EncodeToString([]byte(v))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+// parseChecksum splits an Upload-Checksum header into a hash and the
+// expected digest.
+func parseChecksum(header string) (hash.Hash, []byte, error) {
+	algorithm, encoded, ok := strings.Cut(header, " ")
+	if !ok {
+		return nil, nil, errors.New("malformed Upload-Checksum")
+	}
+
+	newHash, ok := checksumAlgorithms[algorithm]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+
+	digest, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, errors.New("checksum is not base64")
+	}
+	return newHash(), digest, nil
+}
+
+func supportedChecksums() string {
+	names := make([]string, 0, len(checksumAlgorithms))
+	for name := range checksumAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
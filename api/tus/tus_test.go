@@ -0,0 +1,495 @@
+package tus
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap/zaptest"
+
+	"mediaConverter/api/models"
+	"mediaConverter/api/repository"
+	"mediaConverter/worker/storage"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	uploads map[string]*models.TusUpload
+	claimed map[string]time.Time
+}
+
+func (m *memoryStore) CreateTusUpload(ctx context.Context, upload *models.TusUpload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	upload.ID = uuid.New().String()
+	stored := *upload
+	m.uploads[upload.ID] = &stored
+	return nil
+}
+
+func (m *memoryStore) GetTusUpload(ctx context.Context, id string) (*models.TusUpload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	upload, ok := m.uploads[id]
+	if !ok {
+		return nil, repository.ErrUploadNotFound
+	}
+	copied := *upload
+	copied.Chunks = append([]string(nil), upload.Chunks...)
+	return &copied, nil
+}
+
+func (m *memoryStore) AppendTusChunk(ctx context.Context, id string, offset, newOffset int64, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	upload, ok := m.uploads[id]
+	if !ok || upload.Offset != offset {
+		return repository.ErrOffsetConflict
+	}
+	upload.Offset = newOffset
+	upload.Chunks = append(upload.Chunks, key)
+	return nil
+}
+
+func (m *memoryStore) ClaimTusCompletion(ctx context.Context, id string, staleBefore time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	since, claimed := m.claimed[id]
+	if m.uploads[id].TaskID != nil || claimed && !since.Before(staleBefore) {
+		return repository.ErrUploadCompleting
+	}
+	m.claimed[id] = time.Now()
+	return nil
+}
+
+func (m *memoryStore) ReleaseTusCompletion(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.claimed, id)
+	return nil
+}
+
+func (m *memoryStore) SetTusUploadTask(ctx context.Context, id, taskID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.claimed, id)
+	m.uploads[id].TaskID = &taskID
+	m.uploads[id].Chunks = nil
+	return nil
+}
+
+func (m *memoryStore) DeleteTusUpload(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.uploads, id)
+	return nil
+}
+
+func (m *memoryStore) ListExpiredTusUploads(ctx context.Context, before time.Time, limit int) ([]*models.TusUpload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var expired []*models.TusUpload
+	for _, upload := range m.uploads {
+		if upload.ExpiresAt.Before(before) && len(expired) < limit {
+			copied := *upload
+			expired = append(expired, &copied)
+		}
+	}
+	return expired, nil
+}
+
+type recordingCompleter struct {
+	content []byte
+	reject  bool
+	// fail, when set, is returned instead of creating a task.
+	fail error
+	// gate, when set, holds CompleteUpload until it is closed.
+	gate  chan struct{}
+	calls int
+}
+
+func (c *recordingCompleter) CheckMetadata(metadata map[string]string) error {
+	if metadata["filename"] == "" {
+		return fmt.Errorf("%w: filename is required", ErrInvalidUpload)
+	}
+	return nil
+}
+
+func (c *recordingCompleter) CompleteUpload(ctx context.Context, upload *models.TusUpload, content io.Reader) (string, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return "", err
+	}
+	if c.gate != nil {
+		<-c.gate
+	}
+	if c.reject {
+		return "", fmt.Errorf("%w: bad content", ErrInvalidUpload)
+	}
+	if c.fail != nil {
+		return "", c.fail
+	}
+	c.calls++
+	c.content = data
+	return "task-" + upload.ID, nil
+}
+
+type testServer struct {
+	handler   *Handler
+	store     *memoryStore
+	files     *storage.Local
+	completer *recordingCompleter
+	mux       *http.ServeMux
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	files, err := storage.NewLocal(t.TempDir(), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{
+		store:     &memoryStore{uploads: make(map[string]*models.TusUpload), claimed: make(map[string]time.Time)},
+		files:     files,
+		completer: &recordingCompleter{},
+		mux:       http.NewServeMux(),
+	}
+	s.handler = NewHandler(s.store, files, s.completer, 1024, zaptest.NewLogger(t))
+
+	s.mux.HandleFunc("OPTIONS /tus/{$}", s.handler.Options)
+	s.mux.HandleFunc("POST /tus/{$}", s.handler.Create)
+	s.mux.HandleFunc("HEAD /tus/{id}", s.handler.Head)
+	s.mux.HandleFunc("PATCH /tus/{id}", s.handler.Patch)
+	s.mux.HandleFunc("DELETE /tus/{id}", s.handler.Delete)
+	return s
+}
+
+func (s *testServer) do(method, path string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Tus-Resumable", Version)
+	for k, v := range headers {
+		if v == "" {
+			req.Header.Del(k)
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *testServer) create(t *testing.T, length int) string {
+	t.Helper()
+
+	rec := s.do("POST", "/tus/", nil, map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": EncodeMetadata(map[string]string{"filename": "photo.jpg", "output_format": "png"}),
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	return rec.Header().Get("Location")
+}
+
+func (s *testServer) patch(location string, offset int, chunk []byte, headers map[string]string) *httptest.ResponseRecorder {
+	h := map[string]string{
+		"Content-Type":  offsetContentType,
+		"Upload-Offset": strconv.Itoa(offset),
+	}
+	for k, v := range headers {
+		h[k] = v
+	}
+	return s.do("PATCH", location, chunk, h)
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	metadata, err := ParseMetadata("filename d29ybGRfZG9taW5hdGlvbl9wbGFuLnBkZg==,is_confidential")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata["filename"] != "world_domination_plan.pdf" || metadata["is_confidential"] != "" {
+		t.Errorf("unexpected metadata %v", metadata)
+	}
+
+	again, err := ParseMetadata(EncodeMetadata(metadata))
+	if err != nil || len(again) != 2 || again["filename"] != metadata["filename"] {
+		t.Errorf("expected metadata to survive encoding, got %v, %v", again, err)
+	}
+
+	for _, header := range []string{"filename !!!", "a 1,a 2", ",x"} {
+		if _, err := ParseMetadata(header); !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("ParseMetadata(%q): expected ErrInvalidMetadata, got %v", header, err)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.do("OPTIONS", "/tus/", nil, map[string]string{"Tus-Resumable": ""})
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if rec.Header().Get("Tus-Version") != Version || rec.Header().Get("Tus-Max-Size") != "1024" {
+		t.Errorf("unexpected headers %v", rec.Header())
+	}
+	if !strings.Contains(rec.Header().Get("Tus-Checksum-Algorithm"), "sha1") {
+		t.Errorf("expected sha1 to be supported, got %s", rec.Header().Get("Tus-Checksum-Algorithm"))
+	}
+}
+
+func TestResumableUpload(t *testing.T) {
+	s := newTestServer(t)
+	content := []byte("0123456789abcdefghij")
+	location := s.create(t, len(content))
+
+	rec := s.patch(location, 0, content[:8], nil)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Upload-Offset") != "8" {
+		t.Fatalf("first chunk: got %d, offset %s", rec.Code, rec.Header().Get("Upload-Offset"))
+	}
+
+	// A client that lost the response asks for the offset and resumes.
+	rec = s.do("HEAD", location, nil, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Upload-Offset") != "8" || rec.Header().Get("Upload-Length") != "20" {
+		t.Fatalf("head: got %d, %v", rec.Code, rec.Header())
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Error("expected HEAD responses not to be cached")
+	}
+
+	rec = s.patch(location, 0, content[:8], nil)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected a stale offset to conflict, got %d", rec.Code)
+	}
+
+	rec = s.patch(location, 8, content[8:], nil)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Upload-Offset") != "20" {
+		t.Fatalf("last chunk: got %d, offset %s", rec.Code, rec.Header().Get("Upload-Offset"))
+	}
+	if rec.Header().Get("Upload-Task-ID") == "" {
+		t.Error("expected the final chunk to report the created task")
+	}
+	if !bytes.Equal(s.completer.content, content) {
+		t.Errorf("expected the completer to receive %q, got %q", content, s.completer.content)
+	}
+
+	chunks, err := s.files.List(context.Background(), "tus/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 0 {
+		t.Errorf("expected chunks to be removed after completion, got %v", chunks)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	s := newTestServer(t)
+	location := s.create(t, 10)
+
+	sum := sha1.Sum([]byte("hello"))
+	valid := "sha1 " + base64.StdEncoding.EncodeToString(sum[:])
+
+	rec := s.patch(location, 0, []byte("hellO"), map[string]string{"Upload-Checksum": valid})
+	if rec.Code != StatusChecksumMismatch {
+		t.Errorf("expected 460, got %d", rec.Code)
+	}
+
+	rec = s.patch(location, 0, []byte("hello"), map[string]string{"Upload-Checksum": "crc32 AAAA"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected an unsupported algorithm to be rejected, got %d", rec.Code)
+	}
+
+	rec = s.patch(location, 0, []byte("hello"), map[string]string{"Upload-Checksum": valid})
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Upload-Offset") != "5" {
+		t.Errorf("expected a valid checksum to be accepted, got %d", rec.Code)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	s := newTestServer(t)
+	location := s.create(t, 10)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       []byte
+		headers    map[string]string
+		wantStatus int
+	}{
+		{"missing version", "HEAD", location, nil, map[string]string{"Tus-Resumable": ""}, http.StatusPreconditionFailed},
+		{"too large", "POST", "/tus/", nil, map[string]string{"Upload-Length": "2048", "Upload-Metadata": "filename YS5qcGc="}, http.StatusRequestEntityTooLarge},
+		{"no length", "POST", "/tus/", nil, map[string]string{"Upload-Metadata": "filename YS5qcGc="}, http.StatusBadRequest},
+		{"deferred length", "POST", "/tus/", nil, map[string]string{"Upload-Defer-Length": "1"}, http.StatusBadRequest},
+		{"no filename", "POST", "/tus/", nil, map[string]string{"Upload-Length": "10"}, http.StatusBadRequest},
+		{"wrong content type", "PATCH", location, []byte("x"), map[string]string{"Upload-Offset": "0", "Content-Type": "image/jpeg"}, http.StatusUnsupportedMediaType},
+		{"past length", "PATCH", location, []byte("01234567890"), map[string]string{"Upload-Offset": "0", "Content-Type": offsetContentType}, http.StatusRequestEntityTooLarge},
+		{"unknown upload", "HEAD", "/tus/" + uuid.New().String(), nil, nil, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(tt.method, tt.path, tt.body, tt.headers)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if rec.Header().Get("Tus-Resumable") != Version {
+				t.Error("expected Tus-Resumable on every response")
+			}
+		})
+	}
+}
+
+func TestRejectedUploadIsDiscarded(t *testing.T) {
+	s := newTestServer(t)
+	s.completer.reject = true
+	location := s.create(t, 4)
+
+	rec := s.patch(location, 0, []byte("nope"), nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+
+	rec = s.do("HEAD", location, nil, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected the rejected upload to be gone, got %d", rec.Code)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	s := newTestServer(t)
+	location := s.create(t, 10)
+	if rec := s.patch(location, 0, []byte("abc"), nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+
+	s.handler.now = func() time.Time { return time.Now().Add(Expiration + time.Minute) }
+
+	rec := s.do("HEAD", location, nil, nil)
+	if rec.Code != http.StatusGone {
+		t.Errorf("expected 410 for an expired upload, got %d", rec.Code)
+	}
+
+	purged, err := s.handler.PurgeExpired(context.Background())
+	if err != nil || purged != 1 {
+		t.Fatalf("expected one purged upload, got %d, %v", purged, err)
+	}
+	chunks, _ := s.files.List(context.Background(), "tus/")
+	if len(chunks) != 0 || len(s.store.uploads) != 0 {
+		t.Errorf("expected the upload and its chunks to be removed, got %v", chunks)
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	s := newTestServer(t)
+	location := s.create(t, 10)
+	s.patch(location, 0, []byte("abc"), nil)
+
+	rec := s.do("DELETE", location, nil, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if rec := s.do("HEAD", location, nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after termination, got %d", rec.Code)
+	}
+}
+
+type interruptedReader struct {
+	data []byte
+}
+
+func (r *interruptedReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestInterruptedChunkKeepsReceivedBytes(t *testing.T) {
+	s := newTestServer(t)
+	location := s.create(t, 10)
+
+	req := httptest.NewRequest("PATCH", location, &interruptedReader{data: []byte("abcd")})
+	req.Header.Set("Tus-Resumable", Version)
+	req.Header.Set("Content-Type", offsetContentType)
+	req.Header.Set("Upload-Offset", "0")
+	s.mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	rec := s.do("HEAD", location, nil, nil)
+	if rec.Header().Get("Upload-Offset") != "4" {
+		t.Fatalf("expected the received bytes to be kept, got offset %s", rec.Header().Get("Upload-Offset"))
+	}
+
+	rec = s.patch(location, 4, []byte("efghij"), nil)
+	if rec.Code != http.StatusNoContent || string(s.completer.content) != "abcdefghij" {
+		t.Errorf("expected the upload to resume, got %d with %q", rec.Code, s.completer.content)
+	}
+}
+
+func TestCompletionIsClaimedOnce(t *testing.T) {
+	s := newTestServer(t)
+	content := []byte("0123456789")
+	location := s.create(t, len(content))
+
+	// A failed completion keeps the chunks and can be retried.
+	s.completer.fail = errors.New("database unavailable")
+	if rec := s.patch(location, 0, content, nil); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected the completion to fail, got %d", rec.Code)
+	}
+	s.completer.fail = nil
+
+	gate := make(chan struct{})
+	s.completer.gate = gate
+	first := make(chan *httptest.ResponseRecorder)
+	go func() {
+		first <- s.patch(location, len(content), nil, nil)
+	}()
+
+	// Wait for the first retry to claim the completion.
+	id := strings.TrimPrefix(location, "/tus/")
+	for {
+		s.store.mu.Lock()
+		_, claimed := s.store.claimed[id]
+		s.store.mu.Unlock()
+		if claimed {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if rec := s.patch(location, len(content), nil, nil); rec.Code != http.StatusConflict {
+		t.Errorf("expected a racing completion to conflict, got %d", rec.Code)
+	}
+
+	close(gate)
+	rec := <-first
+	taskID := rec.Header().Get("Upload-Task-ID")
+	if rec.Code != http.StatusNoContent || taskID == "" {
+		t.Fatalf("expected the claimed completion to create a task, got %d", rec.Code)
+	}
+
+	rec = s.patch(location, len(content), nil, nil)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Upload-Task-ID") != taskID {
+		t.Errorf("expected a retried PATCH to report task %s, got %d %q", taskID, rec.Code, rec.Header().Get("Upload-Task-ID"))
+	}
+	if s.completer.calls != 1 {
+		t.Errorf("expected one task, got %d", s.completer.calls)
+	}
+}
@@ -0,0 +1,25 @@
+package validation
+
+const (
+	// MaxCompressionRatio is how many times larger than the archive its
+	// contents may be. Images and PDFs are already compressed, so honest
+	// archives stay far below it.
+	MaxCompressionRatio = 100
+	// ratioFloor is the expanded size below which the ratio is not checked:
+	// a few kilobytes of padding can compress arbitrarily well.
+	ratioFloor = 1 << 20
+)
+
+// CheckExpansion guards against decompression bombs: it fails once the
+// bytes extracted from an archive exceed maxExpanded, or outgrow the
+// compressed bytes consumed to produce them by more than
+// MaxCompressionRatio.
+func CheckExpansion(compressed, expanded, maxExpanded int64) error {
+	if expanded > maxExpanded {
+		return ErrArchiveBomb
+	}
+	if expanded > ratioFloor && expanded > compressed*MaxCompressionRatio {
+		return ErrArchiveBomb
+	}
+	return nil
+}
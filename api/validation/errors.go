@@ -4,7 +4,8 @@ import "errors"
 
 var (
 	ErrInvalidFileType   = errors.New("invalid file type")
-	ErrFileTooLarge      = errors.New("file size exceeds 100MB limit")
+	ErrFileTooLarge      = errors.New("file size exceeds the upload limit")
 	ErrExtensionMismatch = errors.New("file extension does not match content")
 	ErrUnsupportedFormat = errors.New("unsupported file format")
+	ErrArchiveBomb       = errors.New("archive expands beyond the allowed size or compression ratio")
 )
@@ -1,10 +1,6 @@
 package validation
 
-import (
-	"bytes"
-	"io"
-	"mime/multipart"
-)
+import "bytes"
 
 type FileType string
 
@@ -14,6 +10,8 @@ const (
 	FileTypeGIF  FileType = "gif"
 	FileTypePDF  FileType = "pdf"
 	FileTypeMP4  FileType = "mp4"
+	FileTypeZIP  FileType = "zip"
+	FileTypeGzip FileType = "gzip"
 )
 
 var magicBytes = map[FileType][]byte{
@@ -21,21 +19,14 @@ var magicBytes = map[FileType][]byte{
 	FileTypeJPEG: {0xFF, 0xD8, 0xFF},
 	FileTypeGIF:  {0x47, 0x49, 0x46, 0x38},
 	FileTypePDF:  {0x25, 0x50, 0x44, 0x46},
+	FileTypeZIP:  {0x50, 0x4B, 0x03, 0x04},
+	FileTypeGzip: {0x1F, 0x8B},
 }
 
-func DetectFileType(file multipart.File) (FileType, error) {
-	buffer := make([]byte, 512)
-	n, err := file.Read(buffer)
-	if err != nil && err != io.EOF {
-		return "", err
-	}
-
-	if _, err := file.Seek(0, 0); err != nil {
-		return "", err
-	}
-
+// DetectBytes identifies a file from its first bytes; 512 are enough.
+func DetectBytes(head []byte) (FileType, error) {
 	for fileType, signature := range magicBytes {
-		if bytes.HasPrefix(buffer[:n], signature) {
+		if bytes.HasPrefix(head, signature) {
 			return fileType, nil
 		}
 	}
@@ -51,3 +42,8 @@ func IsAllowedImageType(fileType FileType) bool {
 		return false
 	}
 }
+
+// IsArchiveType reports whether fileType is a container of other files.
+func IsArchiveType(fileType FileType) bool {
+	return fileType == FileTypeZIP || fileType == FileTypeGzip
+}
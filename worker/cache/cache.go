@@ -17,3 +17,31 @@ func NewStatusCache(client *redis.Client) *StatusCache {
 func (c *StatusCache) Set(ctx context.Context, taskID string, status string) error {
 	return c.client.Set(ctx, "task:status:"+taskID, status, 0).Err()
 }
+
+// CancelChannel is the pub/sub channel on which the API announces the IDs of
+// cancelled tasks.
+const CancelChannel = "task:cancel"
+
+// SubscribeCancellations calls fn with the ID of every task cancelled while
+// it runs, until ctx is done.
+func (c *StatusCache) SubscribeCancellations(ctx context.Context, fn func(taskID string)) error {
+	pubsub := c.client.Subscribe(ctx, CancelChannel)
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			fn(msg.Payload)
+		}
+	}
+}
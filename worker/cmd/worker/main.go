@@ -13,6 +13,7 @@ import (
 	"mediaConverter/worker/pool"
 	"mediaConverter/worker/repository"
 	"mediaConverter/worker/service"
+	"mediaConverter/worker/storage"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
@@ -39,30 +40,53 @@ func main() {
 	})
 	defer redisClient.Close()
 
-	consumer, err := kafka.NewConsumer([]string{cfg.KafkaBrokers}, cfg.KafkaGroupID)
+	consumer, err := kafka.NewConsumer([]string{cfg.KafkaBrokers}, cfg.KafkaGroupID, cfg.Retry, logger)
 	if err != nil {
 		logger.Fatal("Failed to create consumer", zap.Error(err))
 	}
 	defer consumer.Close()
 
+	files, err := storage.New(cfg.Storage)
+	if err != nil {
+		logger.Fatal("Failed to create storage backend", zap.Error(err))
+	}
+
 	repo := repository.NewPostgresRepo(db)
 	statusCache := cache.NewStatusCache(redisClient)
-	processor := service.NewProcessor(repo, statusCache, logger)
-	workerPool := pool.NewWorkerPool(cfg.WorkerCount)
+	processor := service.NewProcessor(repo, statusCache, files, logger, cfg.WorkerID, cfg.LeaseTTL, cfg.DuplicateDistance)
+	workerPool := pool.NewWorkerPool(cfg.WorkerCount, cfg.PriorityWeights)
+	reaper := service.NewReaper(repo, statusCache, cfg.KafkaTopic, cfg.WorkerID, cfg.LeaseTTL, cfg.MaxRequeues, logger)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	go reaper.Run(ctx, cfg.ReaperInterval)
+	go func() {
+		err := statusCache.SubscribeCancellations(ctx, func(taskID string) {
+			if processor.Cancel(taskID) {
+				logger.Info("Cancelling task", zap.String("task_id", taskID))
+			}
+		})
+		if err != nil {
+			logger.Error("Failed to subscribe to task cancellations", zap.Error(err))
+		}
+	}()
+
 	handler := func(ctx context.Context, msg *kafka.TaskMessage) error {
 		return processor.Process(ctx, msg)
 	}
 
+	topics := kafka.PriorityTopics(cfg.KafkaTopic)
+	consumed := make(chan struct{})
 	go func() {
+		defer close(consumed)
 		logger.Info("Worker started",
-			zap.String("topic", cfg.KafkaTopic),
+			zap.Strings("topics", topics),
+			zap.Any("priority_weights", cfg.PriorityWeights),
 			zap.Int("worker_count", cfg.WorkerCount),
+			zap.String("worker_id", cfg.WorkerID),
 		)
-		if err := consumer.Consume(ctx, cfg.KafkaTopic, handler); err != nil {
+		if err := consumer.Consume(ctx, topics, workerPool, handler, processor.MarkFailed); err != nil {
 			logger.Error("Consumer error", zap.Error(err))
 		}
 	}()
@@ -73,6 +97,14 @@ func main() {
 
 	logger.Info("Shutting down worker...")
 	cancel()
-	workerPool.Wait()
-	logger.Info("Worker stopped")
+
+	// Consume returns once in-flight tasks are done and their offsets
+	// marked; tasks still running at the deadline are redelivered later.
+	select {
+	case <-consumed:
+		workerPool.Wait()
+		logger.Info("Worker stopped")
+	case <-time.After(cfg.ShutdownTimeout):
+		logger.Warn("Shutdown timed out with tasks in flight", zap.Duration("timeout", cfg.ShutdownTimeout))
+	}
 }
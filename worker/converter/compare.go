@@ -0,0 +1,225 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"go.uber.org/zap"
+)
+
+var ErrSizeMismatch = errors.New("images have different dimensions")
+
+const ssimWindow = 8
+
+// Comparison describes how far a candidate image is from a reference.
+// PSNR is nil when the images are pixel-identical (infinite PSNR).
+type Comparison struct {
+	Width      int
+	Height     int
+	Normalized bool
+	MSE        float64
+	PSNR       *float64
+	SSIM       float64
+	Diff       *image.NRGBA
+}
+
+// CompareFiles compares two images and writes the pixel-diff heatmap to
+// outputPath. With normalize the candidate is resized to the reference
+// dimensions first; otherwise differently sized images are rejected.
+func (c *Converter) CompareFiles(ctx context.Context, referencePath, candidatePath, outputPath string, normalize bool) (*Comparison, error) {
+	c.logger.Info("Starting comparison",
+		zap.String("reference", referencePath),
+		zap.String("candidate", candidatePath),
+		zap.String("output", outputPath),
+		zap.Bool("normalize", normalize),
+	)
+
+	reference, err := c.Open(referencePath)
+	if err != nil {
+		return nil, err
+	}
+	candidate, err := c.Open(candidatePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	refBounds, candBounds := reference.Bounds(), candidate.Bounds()
+	sameSize := refBounds.Dx() == candBounds.Dx() && refBounds.Dy() == candBounds.Dy()
+	if !sameSize {
+		if !normalize {
+			return nil, ErrSizeMismatch
+		}
+		width, height := refBounds.Dx(), refBounds.Dy()
+		candidate = c.Resize(candidate, &width, &height, false)
+	}
+
+	comparison, err := Compare(ctx, reference, candidate)
+	if err != nil {
+		return nil, err
+	}
+	comparison.Normalized = !sameSize
+
+	if err := c.Save(comparison.Diff, outputPath, "png"); err != nil {
+		return nil, err
+	}
+
+	c.logger.Info("Comparison completed",
+		zap.String("output", outputPath),
+		zap.Float64("mse", comparison.MSE),
+		zap.Float64("ssim", comparison.SSIM),
+	)
+
+	return comparison, nil
+}
+
+// Compare computes PSNR, SSIM and a diff heatmap for two images of the same
+// size. Cancelling ctx stops it between rows of each pass.
+func Compare(ctx context.Context, reference, candidate image.Image) (*Comparison, error) {
+	a := imaging.Clone(reference)
+	b := imaging.Clone(candidate)
+	width, height := a.Bounds().Dx(), a.Bounds().Dy()
+
+	diffs := make([]float64, width*height)
+	var sumSquared, maxDiff float64
+	for y := 0; y < height; y++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for x := 0; x < width; x++ {
+			i := y*a.Stride + x*4
+			var pixelDiff float64
+			for ch := 0; ch < 3; ch++ {
+				d := float64(a.Pix[i+ch]) - float64(b.Pix[i+ch])
+				sumSquared += d * d
+				pixelDiff = math.Max(pixelDiff, math.Abs(d))
+			}
+			diffs[y*width+x] = pixelDiff
+			maxDiff = math.Max(maxDiff, pixelDiff)
+		}
+	}
+
+	similarity, err := ssim(ctx, luma(a), luma(b), width, height)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := heatmap(ctx, diffs, width, height, maxDiff)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &Comparison{
+		Width:  width,
+		Height: height,
+		MSE:    sumSquared / float64(width*height*3),
+		SSIM:   similarity,
+		Diff:   diff,
+	}
+	if comparison.MSE > 0 {
+		psnr := 10 * math.Log10(255*255/comparison.MSE)
+		comparison.PSNR = &psnr
+	}
+
+	return comparison, nil
+}
+
+func luma(img *image.NRGBA) []float64 {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	out := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*img.Stride + x*4
+			out[y*width+x] = 0.299*float64(img.Pix[i]) + 0.587*float64(img.Pix[i+1]) + 0.114*float64(img.Pix[i+2])
+		}
+	}
+	return out
+}
+
+// ssim averages the structural similarity index over sliding windows of the
+// luma channel, using the constants from Wang et al. (2004).
+func ssim(ctx context.Context, a, b []float64, width, height int) (float64, error) {
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+
+	winW, winH := min(ssimWindow, width), min(ssimWindow, height)
+	step := max(ssimWindow/2, 1)
+
+	var total float64
+	var windows int
+	for y0 := 0; y0+winH <= height; y0 += step {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		for x0 := 0; x0+winW <= width; x0 += step {
+			var meanA, meanB float64
+			for y := y0; y < y0+winH; y++ {
+				for x := x0; x < x0+winW; x++ {
+					meanA += a[y*width+x]
+					meanB += b[y*width+x]
+				}
+			}
+			n := float64(winW * winH)
+			meanA /= n
+			meanB /= n
+
+			var varA, varB, cov float64
+			for y := y0; y < y0+winH; y++ {
+				for x := x0; x < x0+winW; x++ {
+					da := a[y*width+x] - meanA
+					db := b[y*width+x] - meanB
+					varA += da * da
+					varB += db * db
+					cov += da * db
+				}
+			}
+			varA /= n
+			varB /= n
+			cov /= n
+
+			total += ((2*meanA*meanB + c1) * (2*cov + c2)) /
+				((meanA*meanA + meanB*meanB + c1) * (varA + varB + c2))
+			windows++
+		}
+	}
+
+	return total / float64(windows), nil
+}
+
+// heatmap renders per-pixel differences scaled to the largest one, going
+// from black through red and yellow to white.
+func heatmap(ctx context.Context, diffs []float64, width, height int, maxDiff float64) (*image.NRGBA, error) {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	if maxDiff == 0 {
+		maxDiff = 1
+	}
+
+	for y := 0; y < height; y++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for x := 0; x < width; x++ {
+			t := diffs[y*width+x] / maxDiff
+			var r, g, b float64
+			switch {
+			case t < 1.0/3:
+				r = 3 * t
+			case t < 2.0/3:
+				r, g = 1, 3*t-1
+			default:
+				r, g, b = 1, 1, 3*t-2
+			}
+			img.SetNRGBA(x, y, color.NRGBA{uint8(r * 255), uint8(g * 255), uint8(b * 255), 255})
+		}
+	}
+
+	return img, nil
+}
@@ -0,0 +1,126 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestConverter_CompareFiles_Identical(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	converter := NewConverter(logger)
+
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	outputPath := filepath.Join(tmpDir, "diff.png")
+
+	createTestImage(t, 400, 300, inputPath)
+
+	comparison, err := converter.CompareFiles(context.Background(), inputPath, inputPath, outputPath, false)
+	if err != nil {
+		t.Fatalf("CompareFiles failed: %v", err)
+	}
+
+	if comparison.PSNR != nil {
+		t.Errorf("Expected infinite PSNR (nil) for identical images, got %f", *comparison.PSNR)
+	}
+	if comparison.SSIM < 0.9999 {
+		t.Errorf("Expected SSIM 1 for identical images, got %f", comparison.SSIM)
+	}
+	if comparison.Normalized {
+		t.Error("Expected identical images not to be normalized")
+	}
+
+	file, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to open heatmap: %v", err)
+	}
+	defer file.Close()
+
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatalf("Failed to decode heatmap as PNG: %v", err)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() != 400 || bounds.Dy() != 300 {
+		t.Errorf("Expected heatmap dimensions 400x300, got %dx%d", bounds.Dx(), bounds.Dy())
+	}
+}
+
+func TestConverter_CompareFiles_Recompressed(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	converter := NewConverter(logger)
+
+	tmpDir := t.TempDir()
+	referencePath := filepath.Join(tmpDir, "reference.jpg")
+	candidatePath := filepath.Join(tmpDir, "candidate.jpg")
+	outputPath := filepath.Join(tmpDir, "diff.png")
+
+	createTexturedImage(t, 400, 300, referencePath)
+
+	smallWidth, smallHeight := 100, 75
+	if err := converter.Convert(context.Background(), referencePath, candidatePath, "jpg", &smallWidth, &smallHeight, false); err != nil {
+		t.Fatalf("Convert failed: %v", err)
+	}
+
+	comparison, err := converter.CompareFiles(context.Background(), referencePath, candidatePath, outputPath, true)
+	if err != nil {
+		t.Fatalf("CompareFiles failed: %v", err)
+	}
+
+	if !comparison.Normalized {
+		t.Error("Expected candidate to be normalized to the reference size")
+	}
+	if comparison.PSNR == nil || *comparison.PSNR < 15 {
+		t.Errorf("Expected finite PSNR above 15 dB, got %v", comparison.PSNR)
+	}
+	if comparison.SSIM <= 0 || comparison.SSIM >= 1 {
+		t.Errorf("Expected SSIM between 0 and 1, got %f", comparison.SSIM)
+	}
+}
+
+func TestConverter_CompareFiles_SizeMismatch(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	converter := NewConverter(logger)
+
+	tmpDir := t.TempDir()
+	referencePath := filepath.Join(tmpDir, "reference.jpg")
+	candidatePath := filepath.Join(tmpDir, "candidate.jpg")
+	outputPath := filepath.Join(tmpDir, "diff.png")
+
+	createTestImage(t, 400, 300, referencePath)
+	createTestImage(t, 200, 150, candidatePath)
+
+	_, err := converter.CompareFiles(context.Background(), referencePath, candidatePath, outputPath, false)
+	if !errors.Is(err, ErrSizeMismatch) {
+		t.Fatalf("Expected ErrSizeMismatch, got %v", err)
+	}
+}
+
+func TestConverter_CompareFiles_Cancelled(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	converter := NewConverter(logger)
+
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	outputPath := filepath.Join(tmpDir, "diff.png")
+
+	createTestImage(t, 400, 300, inputPath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := converter.CompareFiles(ctx, inputPath, inputPath, outputPath, false)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no heatmap to be written, got %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"go.uber.org/zap"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	FitContain = "contain"
+	FitCover   = "cover"
+	FitStretch = "stretch"
+
+	captionHeight = 18
+)
+
+var ErrNoCells = errors.New("contact sheet has no images")
+
+type SheetCell struct {
+	Path    string
+	Caption string
+}
+
+type SheetOptions struct {
+	Columns    int
+	CellWidth  int
+	CellHeight int
+	Gutter     int
+	Background color.NRGBA
+	Captions   bool
+	Fit        string
+}
+
+// ContactSheet lays the cells out left to right, top to bottom in a grid and
+// saves the composed image to outputPath. A cancelled ctx stops it between
+// cells.
+func (c *Converter) ContactSheet(ctx context.Context, cells []SheetCell, opts SheetOptions, outputPath, outputFormat string) error {
+	if len(cells) == 0 {
+		return ErrNoCells
+	}
+
+	c.logger.Info("Composing contact sheet",
+		zap.Int("cells", len(cells)),
+		zap.Int("columns", opts.Columns),
+		zap.String("output", outputPath),
+	)
+
+	columns := min(opts.Columns, len(cells))
+	rows := (len(cells) + columns - 1) / columns
+
+	rowHeight := opts.CellHeight
+	if opts.Captions {
+		rowHeight += captionHeight
+	}
+
+	width := columns*opts.CellWidth + (columns+1)*opts.Gutter
+	height := rows*rowHeight + (rows+1)*opts.Gutter
+	sheet := imaging.New(width, height, opts.Background)
+
+	for i, cell := range cells {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		src, err := c.Open(cell.Path)
+		if err != nil {
+			return err
+		}
+
+		x := opts.Gutter + (i%columns)*(opts.CellWidth+opts.Gutter)
+		y := opts.Gutter + (i/columns)*(rowHeight+opts.Gutter)
+
+		fitted := fitCell(src, opts.CellWidth, opts.CellHeight, opts.Fit)
+		offset := image.Pt(
+			x+(opts.CellWidth-fitted.Bounds().Dx())/2,
+			y+(opts.CellHeight-fitted.Bounds().Dy())/2,
+		)
+		draw.Draw(sheet, fitted.Bounds().Add(offset), fitted, image.Point{}, draw.Over)
+
+		if opts.Captions {
+			drawCaption(sheet, cell.Caption, x, y+opts.CellHeight, opts.CellWidth, opts.Background)
+		}
+	}
+
+	if err := c.Save(sheet, outputPath, outputFormat); err != nil {
+		return err
+	}
+
+	c.logger.Info("Contact sheet completed",
+		zap.String("output", outputPath),
+		zap.Int("width", width),
+		zap.Int("height", height),
+	)
+
+	return nil
+}
+
+func fitCell(src image.Image, width, height int, fit string) *image.NRGBA {
+	switch fit {
+	case FitCover:
+		return imaging.Fill(src, width, height, imaging.Center, imaging.Lanczos)
+	case FitStretch:
+		return imaging.Resize(src, width, height, imaging.Lanczos)
+	default:
+		b := src.Bounds()
+		scale := min(float64(width)/float64(b.Dx()), float64(height)/float64(b.Dy()))
+		w := max(int(float64(b.Dx())*scale+0.5), 1)
+		h := max(int(float64(b.Dy())*scale+0.5), 1)
+		return imaging.Resize(src, w, h, imaging.Lanczos)
+	}
+}
+
+// drawCaption writes text centered under a cell, cutting it short with "..."
+// when it does not fit the cell width. The built-in font only covers ASCII,
+// so other characters are shown as "?".
+func drawCaption(dst draw.Image, text string, x, y, width int, background color.NRGBA) {
+	face := basicfont.Face7x13
+	maxChars := width / face.Advance
+	if maxChars <= 0 {
+		return
+	}
+
+	text = strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7E {
+			return '?'
+		}
+		return r
+	}, text)
+	if len(text) > maxChars {
+		if maxChars > 3 {
+			text = text[:maxChars-3] + "..."
+		} else {
+			text = text[:maxChars]
+		}
+	}
+
+	textColor := color.Black
+	if luminance(background) < 128 {
+		textColor = color.White
+	}
+
+	drawer := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(textColor),
+		Face: face,
+		Dot: fixed.P(
+			x+(width-len(text)*face.Advance)/2,
+			y+(captionHeight+face.Ascent-face.Descent)/2,
+		),
+	}
+	drawer.DrawString(text)
+}
+
+func luminance(c color.NRGBA) float64 {
+	return 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+}
+
+// ParseHexColor parses "#RRGGBB" or "RRGGBB".
+func ParseHexColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
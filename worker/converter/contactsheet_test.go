@@ -0,0 +1,91 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestConverter_ContactSheet_GridLayout(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	converter := NewConverter(logger)
+
+	tmpDir := t.TempDir()
+	var cells []SheetCell
+	for i, size := range [][2]int{{400, 300}, {300, 400}, {200, 200}} {
+		path := filepath.Join(tmpDir, "input"+string(rune('a'+i))+".jpg")
+		createTestImage(t, size[0], size[1], path)
+		cells = append(cells, SheetCell{Path: path, Caption: filepath.Base(path)})
+	}
+	outputPath := filepath.Join(tmpDir, "sheet.png")
+
+	opts := SheetOptions{
+		Columns:    2,
+		CellWidth:  100,
+		CellHeight: 80,
+		Gutter:     10,
+		Background: color.NRGBA{255, 255, 255, 255},
+		Captions:   true,
+		Fit:        FitContain,
+	}
+
+	if err := converter.ContactSheet(context.Background(), cells, opts, outputPath, "png"); err != nil {
+		t.Fatalf("ContactSheet failed: %v", err)
+	}
+
+	file, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to open output file: %v", err)
+	}
+	defer file.Close()
+
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatalf("Failed to decode output as PNG: %v", err)
+	}
+
+	// 2 columns and 2 rows of 100x(80+caption) cells with 10px gutters.
+	wantWidth := 2*100 + 3*10
+	wantHeight := 2*(80+captionHeight) + 3*10
+	bounds := img.Bounds()
+	if bounds.Dx() != wantWidth || bounds.Dy() != wantHeight {
+		t.Errorf("Expected dimensions %dx%d, got %dx%d", wantWidth, wantHeight, bounds.Dx(), bounds.Dy())
+	}
+
+	r, g, b, _ := img.At(wantWidth-1, wantHeight-1).RGBA()
+	if r>>8 != 255 || g>>8 != 255 || b>>8 != 255 {
+		t.Errorf("Expected background in the empty last cell, got %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestConverter_ContactSheet_NoCells(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	converter := NewConverter(logger)
+
+	err := converter.ContactSheet(context.Background(), nil, SheetOptions{Columns: 1, CellWidth: 10, CellHeight: 10}, filepath.Join(t.TempDir(), "sheet.png"), "png")
+	if !errors.Is(err, ErrNoCells) {
+		t.Fatalf("Expected ErrNoCells, got %v", err)
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	c, err := ParseHexColor("#1a2B3c")
+	if err != nil {
+		t.Fatalf("ParseHexColor failed: %v", err)
+	}
+	if c != (color.NRGBA{0x1a, 0x2b, 0x3c, 255}) {
+		t.Errorf("Unexpected color %v", c)
+	}
+
+	for _, invalid := range []string{"", "#fff", "zzzzzz", "#1234567"} {
+		if _, err := ParseHexColor(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package converter
 
 import (
+	"context"
 	"fmt"
 	"image"
 
@@ -16,56 +17,89 @@ func NewConverter(logger *zap.Logger) *Converter {
 	return &Converter{logger: logger}
 }
 
-func (c *Converter) Convert(inputPath, outputPath, outputFormat string, targetWidth, targetHeight *int, crop bool) error {
+// Convert resizes the image at inputPath and saves it to outputPath. A
+// cancelled ctx stops the conversion between decoding, resizing and encoding.
+func (c *Converter) Convert(ctx context.Context, inputPath, outputPath, outputFormat string, targetWidth, targetHeight *int, crop bool) error {
 	c.logger.Info("Starting conversion",
 		zap.String("input", inputPath),
 		zap.String("output", outputPath),
 		zap.String("format", outputFormat),
 	)
 
+	src, err := c.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	processedImage := c.Resize(src, targetWidth, targetHeight, crop)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := c.Save(processedImage, outputPath, outputFormat); err != nil {
+		return err
+	}
+
+	c.logger.Info("Conversion completed",
+		zap.String("output", outputPath),
+	)
+
+	return nil
+}
+
+func (c *Converter) Open(inputPath string) (image.Image, error) {
 	src, err := imaging.Open(inputPath)
 	if err != nil {
 		c.logger.Error("Failed to open image",
 			zap.String("path", inputPath),
 			zap.Error(err),
 		)
-		return fmt.Errorf("failed to open image: %w", err)
+		return nil, fmt.Errorf("failed to open image: %w", err)
 	}
 
-	var processedImage *image.NRGBA
+	return src, nil
+}
 
-	if targetWidth != nil || targetHeight != nil {
-		width := targetWidth
-		height := targetHeight
+// Resize scales src to the target dimensions; a missing dimension keeps the
+// source size. With crop the image is filled and cut around the center
+// instead of being stretched.
+func (c *Converter) Resize(src image.Image, targetWidth, targetHeight *int, crop bool) *image.NRGBA {
+	if targetWidth == nil && targetHeight == nil {
+		return imaging.Clone(src)
+	}
 
-		if width == nil {
-			w := src.Bounds().Dx()
-			width = &w
-		}
-		if height == nil {
-			h := src.Bounds().Dy()
-			height = &h
-		}
+	width := targetWidth
+	height := targetHeight
 
-		c.logger.Info("Resizing image",
-			zap.Int("width", *width),
-			zap.Int("height", *height),
-			zap.Bool("crop", crop),
-		)
+	if width == nil {
+		w := src.Bounds().Dx()
+		width = &w
+	}
+	if height == nil {
+		h := src.Bounds().Dy()
+		height = &h
+	}
 
-		if crop {
-			processedImage = imaging.Fill(src, *width, *height, imaging.Center, imaging.Lanczos)
-		} else {
-			processedImage = imaging.Resize(src, *width, *height, imaging.Lanczos)
-		}
-	} else {
-		processedImage = imaging.Clone(src)
+	c.logger.Info("Resizing image",
+		zap.Int("width", *width),
+		zap.Int("height", *height),
+		zap.Bool("crop", crop),
+	)
+
+	if crop {
+		return imaging.Fill(src, *width, *height, imaging.Center, imaging.Lanczos)
 	}
+	return imaging.Resize(src, *width, *height, imaging.Lanczos)
+}
 
+func (c *Converter) Save(img image.Image, outputPath, outputFormat string) error {
 	if outputFormat != "" {
 		switch outputFormat {
 		case "jpg", "jpeg":
-			if err := imaging.Save(processedImage, outputPath, imaging.JPEGQuality(85)); err != nil {
+			if err := imaging.Save(img, outputPath, imaging.JPEGQuality(85)); err != nil {
 				c.logger.Error("Failed to save JPEG",
 					zap.String("path", outputPath),
 					zap.Error(err),
@@ -73,7 +107,7 @@ func (c *Converter) Convert(inputPath, outputPath, outputFormat string, targetWi
 				return fmt.Errorf("failed to save JPEG: %w", err)
 			}
 		case "png":
-			if err := imaging.Save(processedImage, outputPath); err != nil {
+			if err := imaging.Save(img, outputPath); err != nil {
 				c.logger.Error("Failed to save PNG",
 					zap.String("path", outputPath),
 					zap.Error(err),
@@ -86,7 +120,7 @@ func (c *Converter) Convert(inputPath, outputPath, outputFormat string, targetWi
 			return err
 		}
 	} else {
-		if err := imaging.Save(processedImage, outputPath); err != nil {
+		if err := imaging.Save(img, outputPath); err != nil {
 			c.logger.Error("Failed to save image",
 				zap.String("path", outputPath),
 				zap.Error(err),
@@ -95,9 +129,5 @@ func (c *Converter) Convert(inputPath, outputPath, outputFormat string, targetWi
 		}
 	}
 
-	c.logger.Info("Conversion completed",
-		zap.String("output", outputPath),
-	)
-
 	return nil
 }
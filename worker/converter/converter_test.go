@@ -1,6 +1,8 @@
 package converter
 
 import (
+	"context"
+	"errors"
 	"image"
 	"image/color"
 	"image/jpeg"
@@ -48,7 +50,7 @@ func TestConverter_Convert_SimpleResize(t *testing.T) {
 	targetWidth := 400
 	targetHeight := 300
 
-	err := converter.Convert(inputPath, outputPath, "jpg", &targetWidth, &targetHeight, false)
+	err := converter.Convert(context.Background(), inputPath, outputPath, "jpg", &targetWidth, &targetHeight, false)
 	if err != nil {
 		t.Fatalf("Convert failed: %v", err)
 	}
@@ -87,7 +89,7 @@ func TestConverter_Convert_WithCrop(t *testing.T) {
 	targetWidth := 300
 	targetHeight := 300
 
-	err := converter.Convert(inputPath, outputPath, "jpg", &targetWidth, &targetHeight, true)
+	err := converter.Convert(context.Background(), inputPath, outputPath, "jpg", &targetWidth, &targetHeight, true)
 	if err != nil {
 		t.Fatalf("Convert failed: %v", err)
 	}
@@ -119,7 +121,7 @@ func TestConverter_Convert_FormatConversion(t *testing.T) {
 
 	createTestImage(t, 400, 300, inputPath)
 
-	err := converter.Convert(inputPath, outputPath, "png", nil, nil, false)
+	err := converter.Convert(context.Background(), inputPath, outputPath, "png", nil, nil, false)
 	if err != nil {
 		t.Fatalf("Convert failed: %v", err)
 	}
@@ -148,7 +150,7 @@ func TestConverter_Convert_OnlyWidthSpecified(t *testing.T) {
 
 	targetWidth := 400
 
-	err := converter.Convert(inputPath, outputPath, "jpg", &targetWidth, nil, false)
+	err := converter.Convert(context.Background(), inputPath, outputPath, "jpg", &targetWidth, nil, false)
 	if err != nil {
 		t.Fatalf("Convert failed: %v", err)
 	}
@@ -180,7 +182,7 @@ func TestConverter_Convert_UnsupportedFormat(t *testing.T) {
 
 	createTestImage(t, 400, 300, inputPath)
 
-	err := converter.Convert(inputPath, outputPath, "webp", nil, nil, false)
+	err := converter.Convert(context.Background(), inputPath, outputPath, "webp", nil, nil, false)
 	if err == nil {
 		t.Fatal("Expected error for unsupported format, got nil")
 	}
@@ -198,12 +200,34 @@ func TestConverter_Convert_InvalidInputPath(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "output.jpg")
 
-	err := converter.Convert("/nonexistent/path.jpg", outputPath, "jpg", nil, nil, false)
+	err := converter.Convert(context.Background(), "/nonexistent/path.jpg", outputPath, "jpg", nil, nil, false)
 	if err == nil {
 		t.Fatal("Expected error for non-existent input file, got nil")
 	}
 }
 
+func TestConverter_Convert_Cancelled(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	converter := NewConverter(logger)
+
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	outputPath := filepath.Join(tmpDir, "output.jpg")
+
+	createTestImage(t, 400, 300, inputPath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := converter.Convert(ctx, inputPath, outputPath, "jpg", nil, nil, false)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no output to be written, got %v", err)
+	}
+}
+
 func TestConverter_Convert_NoDimensionsPreservesOriginal(t *testing.T) {
 	logger := zaptest.NewLogger(t)
 	converter := NewConverter(logger)
@@ -214,7 +238,7 @@ func TestConverter_Convert_NoDimensionsPreservesOriginal(t *testing.T) {
 
 	createTestImage(t, 400, 300, inputPath)
 
-	err := converter.Convert(inputPath, outputPath, "jpg", nil, nil, false)
+	err := converter.Convert(context.Background(), inputPath, outputPath, "jpg", nil, nil, false)
 	if err != nil {
 		t.Fatalf("Convert failed: %v", err)
 	}
@@ -0,0 +1,146 @@
+package converter
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// Hashes holds the 64-bit perceptual fingerprints of an image. Near-duplicate
+// images (rescaled, recompressed) end up within a small Hamming distance.
+type Hashes struct {
+	Average    uint64
+	Difference uint64
+	Perceptual uint64
+}
+
+func (c *Converter) Hash(inputPath string) (*Hashes, error) {
+	src, err := c.Open(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := ComputeHashes(src)
+	return &hashes, nil
+}
+
+func ComputeHashes(img image.Image) Hashes {
+	return Hashes{
+		Average:    AverageHash(img),
+		Difference: DifferenceHash(img),
+		Perceptual: PerceptualHash(img),
+	}
+}
+
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+func AverageHash(img image.Image) uint64 {
+	pixels := grayPixels(img, 8, 8)
+
+	var sum float64
+	for _, p := range pixels {
+		sum += p
+	}
+	mean := sum / float64(len(pixels))
+
+	var hash uint64
+	for i, p := range pixels {
+		if p > mean {
+			hash |= 1 << uint(63-i)
+		}
+	}
+	return hash
+}
+
+func DifferenceHash(img image.Image) uint64 {
+	pixels := grayPixels(img, 9, 8)
+
+	var hash uint64
+	bit := 63
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if pixels[y*9+x] > pixels[y*9+x+1] {
+				hash |= 1 << uint(bit)
+			}
+			bit--
+		}
+	}
+	return hash
+}
+
+func PerceptualHash(img image.Image) uint64 {
+	const size = 32
+
+	pixels := grayPixels(img, size, size)
+	coeffs := dct2D(pixels, size)
+
+	lowFreq := make([]float64, 0, 64)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			lowFreq = append(lowFreq, coeffs[y*size+x])
+		}
+	}
+
+	// The DC coefficient only reflects overall brightness, so it is left out
+	// of the median to keep the threshold meaningful.
+	sorted := append([]float64(nil), lowFreq[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for i, v := range lowFreq {
+		if v > median {
+			hash |= 1 << uint(63-i)
+		}
+	}
+	return hash
+}
+
+func grayPixels(img image.Image, width, height int) []float64 {
+	small := imaging.Grayscale(imaging.Resize(img, width, height, imaging.Box))
+
+	pixels := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pixels[y*width+x] = float64(small.Pix[y*small.Stride+x*4])
+		}
+	}
+	return pixels
+}
+
+func dct2D(pixels []float64, size int) []float64 {
+	cosines := make([]float64, size*size)
+	for k := 0; k < size; k++ {
+		for n := 0; n < size; n++ {
+			cosines[k*size+n] = math.Cos(math.Pi / float64(size) * (float64(n) + 0.5) * float64(k))
+		}
+	}
+
+	rows := make([]float64, size*size)
+	for y := 0; y < size; y++ {
+		for k := 0; k < size; k++ {
+			var sum float64
+			for n := 0; n < size; n++ {
+				sum += pixels[y*size+n] * cosines[k*size+n]
+			}
+			rows[y*size+k] = sum
+		}
+	}
+
+	out := make([]float64, size*size)
+	for x := 0; x < size; x++ {
+		for k := 0; k < size; k++ {
+			var sum float64
+			for n := 0; n < size; n++ {
+				sum += rows[n*size+x] * cosines[k*size+n]
+			}
+			out[k*size+x] = sum
+		}
+	}
+	return out
+}
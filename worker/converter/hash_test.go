@@ -0,0 +1,123 @@
+package converter
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"go.uber.org/zap/zaptest"
+)
+
+// createTexturedImage draws concentric rings: unlike the linear gradient from
+// createTestImage it has enough mid-frequency detail for a stable pHash.
+func createTexturedImage(t *testing.T, width, height int, path string) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			d := math.Hypot(float64(x-width*3/8), float64(y-height*2/5))
+			v := uint8(128 + 127*math.Sin(d/25))
+			img.Set(x, y, color.RGBA{v, uint8((x * 255) / width), 128, 255})
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+	defer file.Close()
+
+	if err := jpeg.Encode(file, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+}
+
+func TestConverter_Hash_ResizedCopyIsNearDuplicate(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	converter := NewConverter(logger)
+
+	tmpDir := t.TempDir()
+	originalPath := filepath.Join(tmpDir, "original.jpg")
+	resizedPath := filepath.Join(tmpDir, "resized.jpg")
+
+	createTexturedImage(t, 800, 600, originalPath)
+
+	targetWidth := 200
+	targetHeight := 150
+	if err := converter.Convert(context.Background(), originalPath, resizedPath, "jpg", &targetWidth, &targetHeight, false); err != nil {
+		t.Fatalf("Convert failed: %v", err)
+	}
+
+	original, err := converter.Hash(originalPath)
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	resized, err := converter.Hash(resizedPath)
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+
+	if d := HammingDistance(original.Average, resized.Average); d > 4 {
+		t.Errorf("Expected aHash distance <= 4, got %d", d)
+	}
+	if d := HammingDistance(original.Difference, resized.Difference); d > 4 {
+		t.Errorf("Expected dHash distance <= 4, got %d", d)
+	}
+	if d := HammingDistance(original.Perceptual, resized.Perceptual); d > 4 {
+		t.Errorf("Expected pHash distance <= 4, got %d", d)
+	}
+}
+
+func TestComputeHashes_DifferentImagesAreFarApart(t *testing.T) {
+	gradient := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	checker := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			gradient.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+			if (x/32+y/32)%2 == 0 {
+				checker.Set(x, y, color.White)
+			} else {
+				checker.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	a := ComputeHashes(gradient)
+	b := ComputeHashes(checker)
+
+	if d := HammingDistance(a.Perceptual, b.Perceptual); d < 16 {
+		t.Errorf("Expected pHash distance >= 16 for unrelated images, got %d", d)
+	}
+}
+
+func TestComputeHashes_Deterministic(t *testing.T) {
+	img := imaging.New(64, 48, color.NRGBA{200, 40, 40, 255})
+
+	if ComputeHashes(img) != ComputeHashes(imaging.Clone(img)) {
+		t.Error("Expected identical images to produce identical hashes")
+	}
+}
+
+func TestHammingDistance(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{0, 0, 0},
+		{0, 1, 1},
+		{0xFF, 0x0F, 4},
+		{^uint64(0), 0, 64},
+	}
+
+	for _, tt := range tests {
+		if got := HammingDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("HammingDistance(%x, %x) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
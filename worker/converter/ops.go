@@ -0,0 +1,75 @@
+package converter
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+const defaultJPEGQuality = 85
+
+// Encode writes img to w in the given format. A quality of 0 uses the same
+// JPEG quality as Convert.
+func (c *Converter) Encode(w io.Writer, img image.Image, format string, quality int) error {
+	if quality <= 0 {
+		quality = defaultJPEGQuality
+	}
+
+	var err error
+	switch format {
+	case "jpg", "jpeg":
+		err = imaging.Encode(w, img, imaging.JPEG, imaging.JPEGQuality(quality))
+	case "png":
+		err = imaging.Encode(w, img, imaging.PNG)
+	case "gif":
+		err = imaging.Encode(w, img, imaging.GIF)
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", format, err)
+	}
+
+	return nil
+}
+
+// Rotate turns img clockwise by degrees. Right angles are exact; other angles
+// grow the canvas to the rotated bounding box and leave the corners
+// transparent.
+func Rotate(img image.Image, degrees float64) *image.NRGBA {
+	degrees = math.Mod(degrees, 360)
+	if degrees < 0 {
+		degrees += 360
+	}
+
+	// imaging rotates counter-clockwise.
+	switch degrees {
+	case 0:
+		return imaging.Clone(img)
+	case 90:
+		return imaging.Rotate270(img)
+	case 180:
+		return imaging.Rotate180(img)
+	case 270:
+		return imaging.Rotate90(img)
+	default:
+		return imaging.Rotate(img, 360-degrees, color.Transparent)
+	}
+}
+
+// Bitonal reduces img to pure black and white around mid-gray.
+func Bitonal(img image.Image) *image.NRGBA {
+	gray := imaging.Grayscale(img)
+	for i := 0; i < len(gray.Pix); i += 4 {
+		v := uint8(0)
+		if gray.Pix[i] >= 128 {
+			v = 255
+		}
+		gray.Pix[i], gray.Pix[i+1], gray.Pix[i+2] = v, v, v
+	}
+	return gray
+}
@@ -0,0 +1,241 @@
+package converter
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/disintegration/imaging"
+	"go.uber.org/zap"
+)
+
+const dziNamespace = "http://schemas.microsoft.com/deepzoom/2008"
+
+type TileOptions struct {
+	TileSize int
+	Overlap  int
+	Format   string
+}
+
+// Pyramid describes a generated Deep Zoom image: name.dzi plus the
+// name_files/<level>/<col>_<row>.<format> tiles next to it.
+type Pyramid struct {
+	Width    int
+	Height   int
+	Levels   int
+	Tiles    int
+	DZIPath  string
+	FilesDir string
+}
+
+type dziImage struct {
+	XMLName  xml.Name `xml:"Image"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	TileSize int      `xml:"TileSize,attr"`
+	Overlap  int      `xml:"Overlap,attr"`
+	Format   string   `xml:"Format,attr"`
+	Size     dziSize  `xml:"Size"`
+}
+
+type dziSize struct {
+	Width  int `xml:"Width,attr"`
+	Height int `xml:"Height,attr"`
+}
+
+// Tiles slices the image into a Deep Zoom tile pyramid under outputDir. Level
+// 0 is a single pixel; each next level doubles the size up to the full image
+// at the top level. A cancelled ctx stops it between levels.
+func (c *Converter) Tiles(ctx context.Context, inputPath, outputDir, name string, opts TileOptions) (*Pyramid, error) {
+	c.logger.Info("Generating tile pyramid",
+		zap.String("input", inputPath),
+		zap.String("output_dir", outputDir),
+		zap.Int("tile_size", opts.TileSize),
+		zap.Int("overlap", opts.Overlap),
+		zap.String("format", opts.Format),
+	)
+
+	src, err := c.Open(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	maxLevel := MaxZoomLevel(width, height)
+
+	pyramid := &Pyramid{
+		Width:    width,
+		Height:   height,
+		Levels:   maxLevel + 1,
+		DZIPath:  filepath.Join(outputDir, name+".dzi"),
+		FilesDir: filepath.Join(outputDir, name+"_files"),
+	}
+
+	level := imaging.Clone(src)
+	for l := maxLevel; l >= 0; l-- {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if l < maxLevel {
+			w, h := LevelSize(width, height, maxLevel-l)
+			level = imaging.Resize(level, w, h, imaging.Lanczos)
+		}
+
+		n, err := c.writeLevel(level, filepath.Join(pyramid.FilesDir, fmt.Sprint(l)), opts)
+		if err != nil {
+			return nil, err
+		}
+		pyramid.Tiles += n
+	}
+
+	if err := writeDZI(pyramid.DZIPath, width, height, opts); err != nil {
+		return nil, err
+	}
+
+	c.logger.Info("Tile pyramid completed",
+		zap.String("dzi", pyramid.DZIPath),
+		zap.Int("levels", pyramid.Levels),
+		zap.Int("tiles", pyramid.Tiles),
+	)
+
+	return pyramid, nil
+}
+
+func (c *Converter) writeLevel(level *image.NRGBA, dir string, opts TileOptions) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create level directory: %w", err)
+	}
+
+	width, height := level.Bounds().Dx(), level.Bounds().Dy()
+	columns := (width + opts.TileSize - 1) / opts.TileSize
+	rows := (height + opts.TileSize - 1) / opts.TileSize
+
+	for col := 0; col < columns; col++ {
+		for row := 0; row < rows; row++ {
+			rect := TileBounds(col, row, width, height, opts.TileSize, opts.Overlap)
+			tile := imaging.Crop(level, rect)
+			path := filepath.Join(dir, fmt.Sprintf("%d_%d.%s", col, row, opts.Format))
+			if err := c.Save(tile, path, opts.Format); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return columns * rows, nil
+}
+
+// MaxZoomLevel returns the index of the full-resolution level.
+func MaxZoomLevel(width, height int) int {
+	level := 0
+	for size := max(width, height); size > 1; size = (size + 1) / 2 {
+		level++
+	}
+	return level
+}
+
+// LevelSize returns the image size after halving it the given number of times,
+// rounding up.
+func LevelSize(width, height, halvings int) (int, int) {
+	for i := 0; i < halvings; i++ {
+		width = max((width+1)/2, 1)
+		height = max((height+1)/2, 1)
+	}
+	return width, height
+}
+
+// TileBounds returns the pixel rectangle of a tile within its level, including
+// overlap on the sides that have a neighbouring tile.
+func TileBounds(col, row, levelWidth, levelHeight, tileSize, overlap int) image.Rectangle {
+	x := col * tileSize
+	y := row * tileSize
+
+	x0, y0 := x, y
+	if col > 0 {
+		x0 -= overlap
+	}
+	if row > 0 {
+		y0 -= overlap
+	}
+	x1 := min(x+tileSize+overlap, levelWidth)
+	y1 := min(y+tileSize+overlap, levelHeight)
+
+	return image.Rect(x0, y0, x1, y1)
+}
+
+func writeDZI(path string, width, height int, opts TileOptions) error {
+	data, err := xml.MarshalIndent(dziImage{
+		Xmlns:    dziNamespace,
+		TileSize: opts.TileSize,
+		Overlap:  opts.Overlap,
+		Format:   opts.Format,
+		Size:     dziSize{Width: width, Height: height},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	data = append([]byte(xml.Header), data...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write DZI descriptor: %w", err)
+	}
+	return nil
+}
+
+// ZipPyramid packs the descriptor and all tiles into a ZIP archive, keeping
+// their paths relative to the descriptor's directory.
+func ZipPyramid(pyramid *Pyramid, zipPath string) error {
+	out, err := os.Create(zipPath)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	baseDir := filepath.Dir(pyramid.DZIPath)
+
+	addFile := func(path string) error {
+		rel, err := filepath.Rel(baseDir, path)
+		if err != nil {
+			return err
+		}
+
+		// Tiles are already compressed images, storing them avoids wasted CPU.
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: filepath.ToSlash(rel), Method: zip.Store})
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(w, f)
+		return err
+	}
+
+	if err := addFile(pyramid.DZIPath); err != nil {
+		return fmt.Errorf("failed to archive descriptor: %w", err)
+	}
+
+	err = filepath.WalkDir(pyramid.FilesDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		return addFile(path)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive tiles: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,104 @@
+package converter
+
+import (
+	"archive/zip"
+	"context"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestConverter_Tiles_Pyramid(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	converter := NewConverter(logger)
+
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	createTestImage(t, 600, 400, inputPath)
+
+	pyramid, err := converter.Tiles(context.Background(), inputPath, tmpDir, "scan", TileOptions{TileSize: 256, Overlap: 1, Format: "jpg"})
+	if err != nil {
+		t.Fatalf("Tiles failed: %v", err)
+	}
+
+	// ceil(log2(600)) = 10, plus the single-pixel level 0.
+	if pyramid.Levels != 11 {
+		t.Errorf("Expected 11 levels, got %d", pyramid.Levels)
+	}
+
+	descriptor, err := os.ReadFile(pyramid.DZIPath)
+	if err != nil {
+		t.Fatalf("Failed to read descriptor: %v", err)
+	}
+	for _, want := range []string{`TileSize="256"`, `Overlap="1"`, `Format="jpg"`, `Width="600"`, `Height="400"`} {
+		if !strings.Contains(string(descriptor), want) {
+			t.Errorf("Expected descriptor to contain %s, got:\n%s", want, descriptor)
+		}
+	}
+
+	tests := []struct {
+		path          string
+		width, height int
+	}{
+		{"10/0_0.jpg", 257, 257},
+		{"10/2_1.jpg", 600 - 511, 400 - 255},
+		{"9/1_0.jpg", 300 - 255, 200},
+		{"0/0_0.jpg", 1, 1},
+	}
+	for _, tt := range tests {
+		file, err := os.Open(filepath.Join(pyramid.FilesDir, tt.path))
+		if err != nil {
+			t.Errorf("Missing tile %s: %v", tt.path, err)
+			continue
+		}
+		cfg, err := jpeg.DecodeConfig(file)
+		file.Close()
+		if err != nil {
+			t.Errorf("Failed to decode tile %s: %v", tt.path, err)
+			continue
+		}
+		if cfg.Width != tt.width || cfg.Height != tt.height {
+			t.Errorf("Tile %s: expected %dx%d, got %dx%d", tt.path, tt.width, tt.height, cfg.Width, cfg.Height)
+		}
+	}
+
+	zipPath := filepath.Join(tmpDir, "scan.zip")
+	if err := ZipPyramid(pyramid, zipPath); err != nil {
+		t.Fatalf("ZipPyramid failed: %v", err)
+	}
+
+	archive, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	defer archive.Close()
+
+	if len(archive.File) != pyramid.Tiles+1 {
+		t.Errorf("Expected %d archive entries, got %d", pyramid.Tiles+1, len(archive.File))
+	}
+	if archive.File[0].Name != "scan.dzi" {
+		t.Errorf("Expected descriptor first in archive, got %s", archive.File[0].Name)
+	}
+}
+
+func TestTileBounds(t *testing.T) {
+	tests := []struct {
+		col, row int
+		want     image.Rectangle
+	}{
+		{0, 0, image.Rect(0, 0, 101, 101)},
+		{1, 0, image.Rect(99, 0, 201, 101)},
+		{2, 2, image.Rect(199, 199, 250, 230)},
+	}
+
+	for _, tt := range tests {
+		if got := TileBounds(tt.col, tt.row, 250, 230, 100, 1); got != tt.want {
+			t.Errorf("TileBounds(%d, %d) = %v, want %v", tt.col, tt.row, got, tt.want)
+		}
+	}
+}
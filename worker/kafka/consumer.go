@@ -3,12 +3,30 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"sync"
+	"time"
 
 	"github.com/IBM/sarama"
+	"go.uber.org/zap"
 )
 
 type MessageHandler func(ctx context.Context, msg *TaskMessage) error
 
+// Dispatcher runs message handlers concurrently.
+type Dispatcher interface {
+	// Submit blocks until handler can be started for msg, then runs it and
+	// reports its result to done. It returns ctx.Err() if ctx ends first.
+	Submit(ctx context.Context, msg *TaskMessage, handler MessageHandler, done func(error)) error
+}
+
+const (
+	TaskTypeConvert      = "convert"
+	TaskTypeCompare      = "compare"
+	TaskTypeContactSheet = "contact_sheet"
+	TaskTypeTiles        = "tiles"
+)
+
 type TaskMessage struct {
 	TaskID       string `json:"task_id"`
 	TraceID      string `json:"trace_id"`
@@ -17,54 +35,334 @@ type TaskMessage struct {
 	TargetWidth  *int   `json:"target_width"`
 	TargetHeight *int   `json:"target_height"`
 	Crop         bool   `json:"crop"`
+
+	DuplicatePolicy string `json:"duplicate_policy,omitempty"`
+	Priority        string `json:"priority,omitempty"`
+
+	Type    string          `json:"type,omitempty"`
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+type CompareOptions struct {
+	CandidatePath string `json:"candidate_path"`
+	Normalize     bool   `json:"normalize"`
+}
+
+type ContactSheetOptions struct {
+	Sources    []SourceFile `json:"sources"`
+	Columns    int          `json:"columns"`
+	CellWidth  int          `json:"cell_width"`
+	CellHeight int          `json:"cell_height"`
+	Gutter     int          `json:"gutter"`
+	Background string       `json:"background"`
+	Captions   bool         `json:"captions"`
+	Fit        string       `json:"fit"`
+}
+
+type TileOptions struct {
+	TileSize int    `json:"tile_size"`
+	Overlap  int    `json:"overlap"`
+	Format   string `json:"format"`
+}
+
+type SourceFile struct {
+	Path     string `json:"path"`
+	Filename string `json:"filename"`
 }
 
 type Consumer struct {
 	consumer sarama.ConsumerGroup
+	producer sarama.SyncProducer
+	retry    RetryPolicy
+	logger   *zap.Logger
 }
 
-func NewConsumer(brokers []string, groupID string) (*Consumer, error) {
+func NewConsumer(brokers []string, groupID string, retry RetryPolicy, logger *zap.Logger) (*Consumer, error) {
 	config := sarama.NewConfig()
 	config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin
 	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 5
+	config.Producer.Return.Successes = true
 
 	c, err := sarama.NewConsumerGroup(brokers, groupID, config)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Consumer{consumer: c}, nil
+	p, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return &Consumer{consumer: c, producer: p, retry: retry, logger: logger}, nil
 }
 
+// DeadLetterHandler is called with the last error of a message whose
+// retries have run out, before it is sent to the dead-letter topic.
+type DeadLetterHandler func(ctx context.Context, msg *TaskMessage, err error) error
+
+// messageSender is the part of sarama.SyncProducer the consumer uses.
+type messageSender interface {
+	SendMessage(msg *sarama.ProducerMessage) (partition int32, offset int64, err error)
+}
+
+// A failed message is handed on to a retry or dead-letter topic up to
+// handOffAttempts times, the delay between attempts doubling from
+// handOffBaseDelay. If that does not succeed the claim ends with an error, so
+// the session restarts at the message instead of committing past it.
+const (
+	handOffAttempts  = 5
+	handOffBaseDelay = 200 * time.Millisecond
+)
+
 type consumerHandler struct {
-	fn  MessageHandler
-	ctx context.Context
+	fn         MessageHandler
+	deadLetter DeadLetterHandler
+	dispatch   Dispatcher
+	producer   messageSender
+	retry      RetryPolicy
+	// handOffDelay is the first delay between attempts to hand a failed
+	// message on.
+	handOffDelay time.Duration
+	logger       *zap.Logger
 }
 
 func (h *consumerHandler) Setup(sarama.ConsumerGroupSession) error   { return nil }
 func (h *consumerHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
 
+// ConsumeClaim hands the messages of one partition to the dispatcher as
+// workers free up. Offsets are marked in order as messages finish; a failed
+// message is marked once it has been handed on to a retry or dead-letter
+// topic. A message that cannot be handed on ends the claim with an error, and
+// with it the session, which then restarts at the last marked offset.
 func (h *consumerHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	for msg := range claim.Messages() {
-		var taskMsg TaskMessage
-		if err := json.Unmarshal(msg.Value, &taskMsg); err != nil {
-			continue
+	tracker := newOffsetTracker(func(msg *sarama.ConsumerMessage) {
+		session.MarkMessage(msg, "")
+	})
+
+	ctx, stop := context.WithCancelCause(session.Context())
+	defer stop(nil)
+	// stopped returns the error that ended the claim early, or nil when the
+	// session ended it.
+	stopped := func() error {
+		if session.Context().Err() != nil {
+			return nil
 		}
+		return context.Cause(ctx)
+	}
+
+	// The claim ends only once in-flight messages are done, so their offsets
+	// are marked before the session commits and the partition is reassigned.
+	var inflight sync.WaitGroup
+	defer inflight.Wait()
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			tracked := tracker.add(msg)
 
-		if err := h.fn(h.ctx, &taskMsg); err != nil {
-			continue
+			var taskMsg TaskMessage
+			if err := decode(msg.Value, &taskMsg); err != nil {
+				if err := h.parkPoison(ctx, msg, err); err != nil {
+					return err
+				}
+				tracker.done(tracked)
+				continue
+			}
+
+			if err := waitUntilDue(ctx, msg); err != nil {
+				return stopped()
+			}
+
+			inflight.Add(1)
+			err := h.dispatch.Submit(ctx, &taskMsg, h.fn, func(err error) {
+				defer inflight.Done()
+				if err != nil {
+					if err := h.handleFailure(ctx, msg, &taskMsg, err); err != nil {
+						stop(err)
+						return
+					}
+				}
+				tracker.done(tracked)
+			})
+			if err != nil {
+				inflight.Done()
+				return stopped()
+			}
+
+		case <-ctx.Done():
+			return stopped()
 		}
+	}
+}
 
-		session.MarkMessage(msg, "")
+// handleFailure sends a failed message to its next retry topic, or to the
+// dead-letter topic once its attempts are used up. If that fails even after
+// retrying until ctx ends, it returns the error and the message must be left
+// unmarked, to be delivered again.
+func (h *consumerHandler) handleFailure(ctx context.Context, msg *sarama.ConsumerMessage, task *TaskMessage, cause error) error {
+	if IsPermanent(cause) {
+		return nil
+	}
+
+	now := time.Now()
+	attempt := attempts(msg) + 1
+	logger := h.logger.With(
+		zap.String("task_id", task.TaskID),
+		zap.Int("attempt", attempt),
+		zap.Error(cause),
+	)
+
+	var out *sarama.ProducerMessage
+	if attempt < h.retry.MaxAttempts {
+		out = h.retry.retryMessage(msg, attempt, cause, now)
+		logger.Warn("Scheduling task retry", zap.String("topic", out.Topic))
+	} else {
+		if h.deadLetter != nil {
+			err := h.handOff(ctx, func() error {
+				return h.deadLetter(context.WithoutCancel(ctx), task, cause)
+			})
+			if err != nil {
+				logger.Error("Failed to record final task failure", zap.NamedError("record_error", err))
+				return err
+			}
+		}
+		out = deadLetterMessage(msg, ReasonRetriesExhausted, attempt, cause, now)
+		logger.Error("Task retries exhausted, sending to dead-letter topic", zap.String("topic", out.Topic))
+	}
+
+	if err := h.publish(ctx, out); err != nil {
+		logger.Error("Failed to publish failed task", zap.String("topic", out.Topic), zap.NamedError("publish_error", err))
+		return err
+	}
+	return nil
+}
+
+// parkPoison sends a message that cannot be decoded to the dead-letter topic
+// as is, so it can be inspected and replayed instead of being lost. It
+// returns an error if the message could not be sent and must not be marked.
+func (h *consumerHandler) parkPoison(ctx context.Context, msg *sarama.ConsumerMessage, cause error) error {
+	out := deadLetterMessage(msg, ReasonUndecodable, attempts(msg)+1, cause, time.Now())
+	logger := h.logger.With(
+		zap.String("topic", msg.Topic),
+		zap.Int32("partition", msg.Partition),
+		zap.Int64("offset", msg.Offset),
+		zap.Error(cause),
+	)
+
+	if err := h.publish(ctx, out); err != nil {
+		logger.Error("Failed to publish undecodable message", zap.NamedError("publish_error", err))
+		return err
+	}
+	logger.Warn("Sent undecodable message to dead-letter topic", zap.String("dlq", out.Topic))
+	return nil
+}
+
+func (h *consumerHandler) publish(ctx context.Context, out *sarama.ProducerMessage) error {
+	return h.handOff(ctx, func() error {
+		_, _, err := h.producer.SendMessage(out)
+		return err
+	})
+}
+
+// handOff runs send until it succeeds, doubling the delay between attempts.
+// It gives up with the last error after handOffAttempts or once ctx ends.
+func (h *consumerHandler) handOff(ctx context.Context, send func() error) error {
+	delay := h.handOffDelay
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if err == nil || attempt == handOffAttempts {
+			return err
+		}
+
+		h.logger.Warn("Failed to hand on message, retrying",
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// decode parses a task message; one without a task ID cannot be processed
+// or failed either.
+func decode(value []byte, msg *TaskMessage) error {
+	if err := json.Unmarshal(value, msg); err != nil {
+		return err
+	}
+	if msg.TaskID == "" {
+		return errors.New("message has no task_id")
 	}
 	return nil
 }
 
-func (c *Consumer) Consume(ctx context.Context, topic string, handler MessageHandler) error {
-	h := &consumerHandler{fn: handler, ctx: ctx}
-	return c.consumer.Consume(ctx, []string{topic}, h)
+// waitUntilDue holds a retried message back until its retry time. It fails
+// if ctx ends first, leaving the message to the next session.
+func waitUntilDue(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	at, ok := retryAt(msg)
+	if !ok {
+		return nil
+	}
+
+	wait := time.Until(at)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Consume processes topics and their retry topics through dispatch until ctx
+// is cancelled, rejoining the group after every rebalance. It returns once
+// in-flight messages are done.
+func (c *Consumer) Consume(ctx context.Context, topics []string, dispatch Dispatcher, handler MessageHandler, deadLetter DeadLetterHandler) error {
+	h := &consumerHandler{
+		fn:         handler,
+		deadLetter: deadLetter,
+		dispatch:   dispatch,
+		producer:   c.producer,
+		retry:      c.retry,
+
+		handOffDelay: handOffBaseDelay,
+		logger:       c.logger,
+	}
+
+	var all []string
+	for _, topic := range topics {
+		all = append(all, topic)
+		all = append(all, c.retry.RetryTopics(topic)...)
+	}
+	for ctx.Err() == nil {
+		if err := c.consumer.Consume(ctx, all, h); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (c *Consumer) Close() error {
-	return c.consumer.Close()
+	err := c.consumer.Close()
+	if perr := c.producer.Close(); err == nil {
+		err = perr
+	}
+	return err
 }
@@ -0,0 +1,221 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap/zaptest"
+)
+
+type fakeSession struct {
+	ctx    context.Context
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (s *fakeSession) Claims() map[string][]int32               { return nil }
+func (s *fakeSession) MemberID() string                         { return "member" }
+func (s *fakeSession) GenerationID() int32                      { return 1 }
+func (s *fakeSession) MarkOffset(string, int32, int64, string)  {}
+func (s *fakeSession) Commit()                                  {}
+func (s *fakeSession) ResetOffset(string, int32, int64, string) {}
+func (s *fakeSession) Context() context.Context                 { return s.ctx }
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+
+func (s *fakeSession) marks() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.marked...)
+}
+
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Topic() string                            { return "media_tasks" }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// goDispatcher runs every handler at once.
+type goDispatcher struct{}
+
+func (goDispatcher) Submit(ctx context.Context, msg *TaskMessage, handler MessageHandler, done func(error)) error {
+	go func() { done(handler(ctx, msg)) }()
+	return nil
+}
+
+func message(t *testing.T, offset int64, taskID string) *sarama.ConsumerMessage {
+	t.Helper()
+
+	value, err := json.Marshal(TaskMessage{TaskID: taskID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &sarama.ConsumerMessage{Topic: "media_tasks", Offset: offset, Value: value}
+}
+
+func TestOffsetTrackerMarksInOrder(t *testing.T) {
+	var marked []int64
+	tracker := newOffsetTracker(func(msg *sarama.ConsumerMessage) {
+		marked = append(marked, msg.Offset)
+	})
+
+	m := make([]*trackedMessage, 4)
+	for i := range m {
+		m[i] = tracker.add(&sarama.ConsumerMessage{Offset: int64(10 + i)})
+	}
+
+	tracker.done(m[2])
+	tracker.done(m[1])
+	if len(marked) != 0 {
+		t.Fatalf("marked %v while offset 10 is in flight", marked)
+	}
+
+	tracker.done(m[0])
+	tracker.done(m[3])
+	if len(marked) != 2 || marked[0] != 12 || marked[1] != 13 {
+		t.Errorf("expected marks [12 13], got %v", marked)
+	}
+}
+
+func TestConsumeClaimDrainsInFlight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &fakeSession{ctx: ctx}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 4)}
+
+	release := map[string]chan struct{}{"slow": make(chan struct{}), "fast": make(chan struct{})}
+	close(release["fast"])
+	started := make(chan string, 4)
+
+	sender := &fakeSender{}
+	h := &consumerHandler{
+		dispatch: goDispatcher{},
+		producer: sender,
+		logger:   zaptest.NewLogger(t),
+		fn: func(ctx context.Context, msg *TaskMessage) error {
+			started <- msg.TaskID
+			<-release[msg.TaskID]
+			return nil
+		},
+	}
+
+	claim.messages <- message(t, 0, "slow")
+	claim.messages <- &sarama.ConsumerMessage{Topic: "media_tasks", Offset: 1, Value: []byte("not json")}
+	claim.messages <- message(t, 2, "fast")
+
+	returned := make(chan struct{})
+	go func() {
+		h.ConsumeClaim(session, claim)
+		close(returned)
+	}()
+
+	for range 2 {
+		<-started
+	}
+	time.Sleep(10 * time.Millisecond)
+	if marks := session.marks(); len(marks) != 0 {
+		t.Fatalf("marked %v before offset 0 finished", marks)
+	}
+
+	// A rebalance ends the claim only after the slow message is done.
+	cancel()
+	select {
+	case <-returned:
+		t.Fatal("claim returned with a message in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release["slow"])
+	<-returned
+
+	marks := session.marks()
+	if len(marks) == 0 || marks[len(marks)-1] != 2 {
+		t.Errorf("expected offset 2 to be marked last, got %v", marks)
+	}
+
+	// The undecodable message is parked, not dropped.
+	if len(sender.sent) != 1 || sender.sent[0].Topic != "media_tasks.dlq" || producedHeader(sender.sent[0], HeaderReason) != ReasonUndecodable {
+		t.Fatalf("expected the poison message in the dead-letter topic, got %+v", sender.sent)
+	}
+	if value, _ := sender.sent[0].Value.Encode(); string(value) != "not json" {
+		t.Errorf("expected the raw payload to be kept, got %q", value)
+	}
+}
+
+func TestPoisonPublishFailureKeepsOffset(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := &fakeSession{ctx: ctx}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 2)}
+	h := &consumerHandler{
+		dispatch:     goDispatcher{},
+		producer:     &fakeSender{err: errors.New("broker down")},
+		handOffDelay: time.Millisecond,
+		logger:       zaptest.NewLogger(t),
+		fn:           func(context.Context, *TaskMessage) error { return nil },
+	}
+
+	claim.messages <- &sarama.ConsumerMessage{Topic: "media_tasks", Offset: 0, Value: []byte(`{"type": "convert"}`)}
+	claim.messages <- message(t, 1, "task")
+	close(claim.messages)
+
+	if err := h.ConsumeClaim(session, claim); err == nil {
+		t.Error("expected the claim to end with the publish error")
+	}
+
+	if marks := session.marks(); len(marks) != 0 {
+		t.Errorf("expected nothing marked past the unpublished poison message, got %v", marks)
+	}
+}
+
+func TestRetryPublishFailureEndsClaim(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := &fakeSession{ctx: ctx}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 2)}
+	h := &consumerHandler{
+		dispatch:     goDispatcher{},
+		producer:     &fakeSender{err: errors.New("broker down")},
+		retry:        testPolicy,
+		handOffDelay: time.Millisecond,
+		logger:       zaptest.NewLogger(t),
+		fn: func(ctx context.Context, msg *TaskMessage) error {
+			if msg.TaskID == "failing" {
+				return errors.New("storage unavailable")
+			}
+			return nil
+		},
+	}
+
+	claim.messages <- message(t, 0, "failing")
+	claim.messages <- message(t, 1, "task")
+
+	returned := make(chan error)
+	go func() {
+		returned <- h.ConsumeClaim(session, claim)
+	}()
+
+	select {
+	case err := <-returned:
+		if err == nil {
+			t.Error("expected the claim to end with the publish error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("claim kept consuming past a message it could not hand on")
+	}
+	if marks := session.marks(); len(marks) != 0 {
+		t.Errorf("expected nothing marked past the failed message, got %v", marks)
+	}
+}
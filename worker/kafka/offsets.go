@@ -0,0 +1,55 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// offsetTracker marks the offsets of one partition in order while its
+// messages complete out of order: an offset is marked only once every
+// message before it is done, so a crash never commits past unfinished work.
+type offsetTracker struct {
+	mu      sync.Mutex
+	mark    func(*sarama.ConsumerMessage)
+	pending []*trackedMessage
+}
+
+type trackedMessage struct {
+	msg  *sarama.ConsumerMessage
+	done bool
+}
+
+func newOffsetTracker(mark func(*sarama.ConsumerMessage)) *offsetTracker {
+	return &offsetTracker{mark: mark}
+}
+
+// add registers msg as in flight. Messages must be added in offset order,
+// as a partition delivers them.
+func (t *offsetTracker) add(msg *sarama.ConsumerMessage) *trackedMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	m := &trackedMessage{msg: msg}
+	t.pending = append(t.pending, m)
+	return m
+}
+
+// done records that m has been handled and marks the highest offset below
+// which nothing is in flight any more.
+func (t *offsetTracker) done(m *trackedMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	m.done = true
+
+	var last *sarama.ConsumerMessage
+	for len(t.pending) > 0 && t.pending[0].done {
+		last = t.pending[0].msg
+		t.pending[0] = nil
+		t.pending = t.pending[1:]
+	}
+	if last != nil {
+		t.mark(last)
+	}
+}
@@ -0,0 +1,53 @@
+package kafka
+
+import "strings"
+
+// Task priorities. Each has its own lane: a topic the worker consumes with
+// its own share of the workers.
+const (
+	PriorityInteractive = "interactive"
+	PriorityNormal      = "normal"
+	PriorityBulk        = "bulk"
+)
+
+// Priorities lists the priorities from the most to the least urgent.
+var Priorities = []string{PriorityInteractive, PriorityNormal, PriorityBulk}
+
+// ValidPriority reports whether priority names a lane; empty means normal.
+func ValidPriority(priority string) bool {
+	switch priority {
+	case "", PriorityInteractive, PriorityNormal, PriorityBulk:
+		return true
+	default:
+		return false
+	}
+}
+
+// PriorityTopic is the topic of the given priority's lane. Normal tasks stay
+// on topic itself, such as media_tasks; the other lanes add their priority,
+// as in media_tasks.bulk.
+func PriorityTopic(topic, priority string) string {
+	if priority == "" || priority == PriorityNormal || !ValidPriority(priority) {
+		return topic
+	}
+	return topic + "." + priority
+}
+
+// PriorityTopics lists the lane topics of topic, most urgent first.
+func PriorityTopics(topic string) []string {
+	topics := make([]string, len(Priorities))
+	for i, priority := range Priorities {
+		topics[i] = PriorityTopic(topic, priority)
+	}
+	return topics
+}
+
+// laneBase returns the topic a lane topic was derived from.
+func laneBase(topic string) string {
+	for _, priority := range Priorities {
+		if base, ok := strings.CutSuffix(topic, "."+priority); ok {
+			return base
+		}
+	}
+	return topic
+}
@@ -0,0 +1,50 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestPriorityTopic(t *testing.T) {
+	tests := []struct {
+		priority string
+		want     string
+	}{
+		{"", "media_tasks"},
+		{PriorityNormal, "media_tasks"},
+		{PriorityInteractive, "media_tasks.interactive"},
+		{PriorityBulk, "media_tasks.bulk"},
+		{"urgent", "media_tasks"},
+	}
+
+	for _, tt := range tests {
+		if got := PriorityTopic("media_tasks", tt.priority); got != tt.want {
+			t.Errorf("PriorityTopic(%q) = %s, want %s", tt.priority, got, tt.want)
+		}
+	}
+}
+
+func TestLanesShareDeadLetterTopic(t *testing.T) {
+	for _, topic := range PriorityTopics("media_tasks") {
+		if got := DeadLetterTopic(topic); got != "media_tasks.dlq" {
+			t.Errorf("DeadLetterTopic(%s) = %s, want media_tasks.dlq", topic, got)
+		}
+	}
+}
+
+func TestHandleFailureKeepsLane(t *testing.T) {
+	sender := &fakeSender{}
+	h := &consumerHandler{producer: sender, retry: testPolicy, logger: zaptest.NewLogger(t)}
+	msg := &sarama.ConsumerMessage{Topic: "media_tasks.bulk", Value: []byte(`{}`)}
+
+	if err := h.handleFailure(context.Background(), msg, &TaskMessage{TaskID: "task-1"}, errors.New("storage unavailable")); err != nil {
+		t.Fatalf("expected the message to be handed on: %v", err)
+	}
+	if out := sender.sent[0]; out.Topic != "media_tasks.bulk.retry.1m" {
+		t.Errorf("expected a retry on the bulk lane, got %s", out.Topic)
+	}
+}
@@ -0,0 +1,197 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Headers carried by retried and dead-lettered messages.
+const (
+	HeaderReason          = "x-reason"
+	HeaderAttempt         = "x-attempt"
+	HeaderRetryAt         = "x-retry-at"
+	HeaderError           = "x-error"
+	HeaderOriginalTopic   = "x-original-topic"
+	HeaderFailedAt        = "x-failed-at"
+	HeaderFailedTopic     = "x-failed-topic"
+	HeaderFailedPartition = "x-failed-partition"
+	HeaderFailedOffset    = "x-failed-offset"
+)
+
+// Values of HeaderReason on dead-lettered messages.
+const (
+	ReasonRetriesExhausted = "retries_exhausted"
+	ReasonUndecodable      = "undecodable"
+)
+
+// RetryPolicy decides when and where failed messages are delivered again.
+// Each retry goes to a topic named after its base delay, such as
+// media_tasks.retry.1m, so that every retry topic holds messages due in
+// roughly the order they arrive.
+type RetryPolicy struct {
+	// MaxAttempts counts every delivery, the first one included.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	Multiplier  float64
+	MaxDelay    time.Duration
+	// Jitter is the fraction by which a delay is randomly shortened or
+	// lengthened, so that failures of a burst do not retry in lockstep.
+	Jitter float64
+}
+
+// delay returns the base delay before the given retry, counted from 1.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := float64(p.BaseDelay) * math.Pow(p.Multiplier, float64(retry-1))
+	if d > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	return time.Duration(d)
+}
+
+// backoff is delay with jitter applied.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	jitter := p.Jitter * (2*rand.Float64() - 1)
+	return time.Duration(float64(p.delay(retry)) * (1 + jitter))
+}
+
+// RetryTopics lists the retry topics of topic, one per distinct delay.
+func (p RetryPolicy) RetryTopics(topic string) []string {
+	var topics []string
+	seen := make(map[string]bool)
+	for retry := 1; retry < p.MaxAttempts; retry++ {
+		name := retryTopic(topic, p.delay(retry))
+		if !seen[name] {
+			seen[name] = true
+			topics = append(topics, name)
+		}
+	}
+	return topics
+}
+
+func retryTopic(topic string, delay time.Duration) string {
+	return topic + ".retry." + formatDelay(delay)
+}
+
+// DeadLetterTopic is where messages of topic go once retries run out. The
+// lanes of a topic share its dead-letter topic.
+func DeadLetterTopic(topic string) string {
+	return laneBase(topic) + ".dlq"
+}
+
+func formatDelay(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d >= time.Minute && d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying: the handler has already dealt
+// with the failure, and the message is not delivered again.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+func header(msg *sarama.ConsumerMessage, key string) (string, bool) {
+	for _, h := range msg.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value), true
+		}
+	}
+	return "", false
+}
+
+// attempts returns how many times msg has been delivered before.
+func attempts(msg *sarama.ConsumerMessage) int {
+	value, _ := header(msg, HeaderAttempt)
+	n, _ := strconv.Atoi(value)
+	return n
+}
+
+// originalTopic returns the topic msg was first published to.
+func originalTopic(msg *sarama.ConsumerMessage) string {
+	if topic, ok := header(msg, HeaderOriginalTopic); ok {
+		return topic
+	}
+	return msg.Topic
+}
+
+// retryAt returns when a retried message becomes due.
+func retryAt(msg *sarama.ConsumerMessage) (time.Time, bool) {
+	value, ok := header(msg, HeaderRetryAt)
+	if !ok {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
+
+// republish copies msg to topic with headers replacing its own; the key is
+// kept so a task stays on one partition.
+func republish(msg *sarama.ConsumerMessage, topic string, headers map[string]string) *sarama.ProducerMessage {
+	out := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(msg.Value),
+	}
+	if msg.Key != nil {
+		out.Key = sarama.ByteEncoder(msg.Key)
+	}
+	for key, value := range headers {
+		out.Headers = append(out.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+	return out
+}
+
+// retryMessage schedules the next delivery of a failed msg.
+func (p RetryPolicy) retryMessage(msg *sarama.ConsumerMessage, retry int, cause error, now time.Time) *sarama.ProducerMessage {
+	origin := originalTopic(msg)
+	return republish(msg, retryTopic(origin, p.delay(retry)), map[string]string{
+		HeaderAttempt:       strconv.Itoa(retry),
+		HeaderRetryAt:       strconv.FormatInt(now.Add(p.backoff(retry)).UnixMilli(), 10),
+		HeaderOriginalTopic: origin,
+		HeaderError:         cause.Error(),
+	})
+}
+
+// deadLetterMessage records a message that will not be processed, why, and
+// where its last delivery came from. The payload is kept byte for byte.
+func deadLetterMessage(msg *sarama.ConsumerMessage, reason string, attempt int, cause error, now time.Time) *sarama.ProducerMessage {
+	origin := originalTopic(msg)
+	return republish(msg, DeadLetterTopic(origin), map[string]string{
+		HeaderReason:          reason,
+		HeaderAttempt:         strconv.Itoa(attempt),
+		HeaderOriginalTopic:   origin,
+		HeaderError:           cause.Error(),
+		HeaderFailedAt:        now.UTC().Format(time.RFC3339),
+		HeaderFailedTopic:     msg.Topic,
+		HeaderFailedPartition: strconv.Itoa(int(msg.Partition)),
+		HeaderFailedOffset:    strconv.FormatInt(msg.Offset, 10),
+	})
+}
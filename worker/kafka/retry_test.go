@@ -0,0 +1,196 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap/zaptest"
+)
+
+var testPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   time.Minute,
+	Multiplier:  10,
+	MaxDelay:    time.Hour,
+	Jitter:      0.2,
+}
+
+type fakeSender struct {
+	mu   sync.Mutex
+	sent []*sarama.ProducerMessage
+	err  error
+	// failures is how many sends fail with err before they succeed; zero
+	// fails every send.
+	failures int
+	attempts int
+}
+
+func (s *fakeSender) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.err != nil && (s.failures == 0 || s.attempts <= s.failures) {
+		return 0, 0, s.err
+	}
+	s.sent = append(s.sent, msg)
+	return 0, int64(len(s.sent)), nil
+}
+
+func producedHeader(msg *sarama.ProducerMessage, key string) string {
+	for _, h := range msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestRetryPolicyTopics(t *testing.T) {
+	got := testPolicy.RetryTopics("media_tasks")
+	want := []string{"media_tasks.retry.1m", "media_tasks.retry.10m", "media_tasks.retry.1h"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	}
+
+	for retry := 1; retry <= 3; retry++ {
+		base := testPolicy.delay(retry)
+		for range 20 {
+			if d := testPolicy.backoff(retry); d < base*8/10 || d > base*12/10 {
+				t.Fatalf("retry %d: backoff %v outside 20%% of %v", retry, d, base)
+			}
+		}
+	}
+}
+
+func TestHandleFailure(t *testing.T) {
+	ctx := context.Background()
+	task := &TaskMessage{TaskID: "task-1"}
+	cause := errors.New("storage unavailable")
+
+	t.Run("retry", func(t *testing.T) {
+		sender := &fakeSender{}
+		h := &consumerHandler{producer: sender, retry: testPolicy, logger: zaptest.NewLogger(t)}
+		msg := &sarama.ConsumerMessage{Topic: "media_tasks", Key: []byte("task-1"), Value: []byte(`{}`)}
+
+		if err := h.handleFailure(ctx, msg, task, cause); err != nil {
+			t.Fatalf("expected the message to be handed on: %v", err)
+		}
+		if len(sender.sent) != 1 {
+			t.Fatalf("expected one retry, sent %d", len(sender.sent))
+		}
+
+		out := sender.sent[0]
+		if out.Topic != "media_tasks.retry.1m" || producedHeader(out, HeaderAttempt) != "1" || producedHeader(out, HeaderError) != cause.Error() {
+			t.Errorf("unexpected retry %s %v", out.Topic, out.Headers)
+		}
+		ms, _ := strconv.ParseInt(producedHeader(out, HeaderRetryAt), 10, 64)
+		if wait := time.Until(time.UnixMilli(ms)); wait < 40*time.Second || wait > 80*time.Second {
+			t.Errorf("expected a retry in about a minute, got %v", wait)
+		}
+	})
+
+	t.Run("dead letter", func(t *testing.T) {
+		sender := &fakeSender{}
+		var recorded error
+		h := &consumerHandler{
+			producer: sender,
+			retry:    testPolicy,
+			logger:   zaptest.NewLogger(t),
+			deadLetter: func(ctx context.Context, msg *TaskMessage, err error) error {
+				recorded = err
+				return nil
+			},
+		}
+		msg := &sarama.ConsumerMessage{
+			Topic:     "media_tasks.retry.1h",
+			Partition: 2,
+			Offset:    7,
+			Value:     []byte(`{}`),
+			Headers: []*sarama.RecordHeader{
+				{Key: []byte(HeaderAttempt), Value: []byte("3")},
+				{Key: []byte(HeaderOriginalTopic), Value: []byte("media_tasks")},
+			},
+		}
+
+		if err := h.handleFailure(ctx, msg, task, cause); err != nil {
+			t.Fatalf("expected the message to be handed on: %v", err)
+		}
+		if recorded != cause {
+			t.Errorf("expected the task to be failed with the final error, got %v", recorded)
+		}
+
+		out := sender.sent[0]
+		if out.Topic != "media_tasks.dlq" || producedHeader(out, HeaderAttempt) != "4" || producedHeader(out, HeaderReason) != ReasonRetriesExhausted ||
+			producedHeader(out, HeaderFailedTopic) != "media_tasks.retry.1h" || producedHeader(out, HeaderFailedOffset) != "7" {
+			t.Errorf("unexpected dead letter %s %v", out.Topic, out.Headers)
+		}
+	})
+
+	t.Run("permanent", func(t *testing.T) {
+		sender := &fakeSender{}
+		h := &consumerHandler{producer: sender, retry: testPolicy, logger: zaptest.NewLogger(t)}
+
+		if err := h.handleFailure(ctx, &sarama.ConsumerMessage{Topic: "media_tasks"}, task, Permanent(cause)); err != nil {
+			t.Fatalf("expected a permanent failure to be marked: %v", err)
+		}
+		if len(sender.sent) != 0 {
+			t.Errorf("expected no retry, sent %d", len(sender.sent))
+		}
+	})
+
+	t.Run("publish recovers", func(t *testing.T) {
+		sender := &fakeSender{err: errors.New("broker down"), failures: 2}
+		h := &consumerHandler{producer: sender, retry: testPolicy, handOffDelay: time.Millisecond, logger: zaptest.NewLogger(t)}
+
+		if err := h.handleFailure(ctx, &sarama.ConsumerMessage{Topic: "media_tasks"}, task, cause); err != nil {
+			t.Fatalf("expected the publish to be retried: %v", err)
+		}
+		if sender.attempts != 3 || len(sender.sent) != 1 {
+			t.Errorf("expected 3 attempts and one retry, got %d and %d", sender.attempts, len(sender.sent))
+		}
+	})
+
+	t.Run("publish fails", func(t *testing.T) {
+		sender := &fakeSender{err: errors.New("broker down")}
+		h := &consumerHandler{producer: sender, retry: testPolicy, handOffDelay: time.Millisecond, logger: zaptest.NewLogger(t)}
+
+		if err := h.handleFailure(ctx, &sarama.ConsumerMessage{Topic: "media_tasks"}, task, cause); err == nil {
+			t.Error("expected the message to stay unmarked")
+		}
+		if sender.attempts != handOffAttempts {
+			t.Errorf("expected %d attempts, got %d", handOffAttempts, sender.attempts)
+		}
+	})
+}
+
+func TestWaitUntilDue(t *testing.T) {
+	due := func(at time.Time) *sarama.ConsumerMessage {
+		return &sarama.ConsumerMessage{Headers: []*sarama.RecordHeader{
+			{Key: []byte(HeaderRetryAt), Value: []byte(strconv.FormatInt(at.UnixMilli(), 10))},
+		}}
+	}
+
+	start := time.Now()
+	if err := waitUntilDue(context.Background(), due(start.Add(30*time.Millisecond))); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 25*time.Millisecond {
+		t.Error("expected the message to be held until due")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := waitUntilDue(ctx, due(time.Now().Add(time.Hour))); err == nil {
+		t.Error("expected waiting to stop with the session")
+	}
+}
@@ -2,36 +2,152 @@ package pool
 
 import (
 	"context"
+	"slices"
 	"sync"
 
 	"mediaConverter/worker/kafka"
 )
 
+// WorkerPool runs message handlers on at most maxWorkers goroutines. While
+// every worker is busy, messages wait in one queue per priority lane, and
+// each worker that frees up goes to a lane chosen by weighted round-robin:
+// a busy interactive lane keeps its latency low, and bulk still gets its
+// share.
 type WorkerPool struct {
-	sem chan struct{}
-	wg  sync.WaitGroup
+	mu    sync.Mutex
+	free  int
+	lanes map[string]*lane
+	wg    sync.WaitGroup
 }
 
-func NewWorkerPool(maxWorkers int) *WorkerPool {
-	return &WorkerPool{
-		sem: make(chan struct{}, maxWorkers),
+type lane struct {
+	weight int
+	// credit is the lane's standing in the smooth weighted round-robin.
+	credit  int
+	waiting []chan struct{}
+}
+
+// NewWorkerPool creates a pool whose lanes get workers in proportion to
+// weights, keyed by priority. Lanes missing from weights, or given less than
+// 1, get a weight of 1 so that none starves.
+func NewWorkerPool(maxWorkers int, weights map[string]int) *WorkerPool {
+	p := &WorkerPool{
+		free:  max(maxWorkers, 1),
+		lanes: make(map[string]*lane, len(kafka.Priorities)),
 	}
+	for _, priority := range kafka.Priorities {
+		p.lanes[priority] = &lane{weight: max(weights[priority], 1)}
+	}
+	return p
 }
 
-func (p *WorkerPool) Submit(ctx context.Context, msg *kafka.TaskMessage, handler func(context.Context, *kafka.TaskMessage) error) {
+// Submit blocks until a worker is free for the lane of msg, so a busy pool
+// holds back consumption instead of queueing goroutines, then runs handler
+// for msg and reports its result to done. It returns ctx.Err() without
+// running handler if ctx ends first. A handler that has started is not
+// cancelled with ctx: shutdowns and rebalances drain in-flight work rather
+// than abandon it.
+func (p *WorkerPool) Submit(ctx context.Context, msg *kafka.TaskMessage, handler kafka.MessageHandler, done func(error)) error {
+	if err := p.acquire(ctx, p.lane(msg.Priority)); err != nil {
+		return err
+	}
+
 	p.wg.Add(1)
 	go func() {
 		defer p.wg.Done()
+		defer p.release()
 
-		select {
-		case p.sem <- struct{}{}:
-			defer func() { <-p.sem }()
-			handler(ctx, msg)
-		case <-ctx.Done():
-		}
+		done(handler(context.WithoutCancel(ctx), msg))
 	}()
+	return nil
 }
 
+// Wait blocks until every submitted handler has returned.
 func (p *WorkerPool) Wait() {
 	p.wg.Wait()
 }
+
+func (p *WorkerPool) lane(priority string) *lane {
+	if l, ok := p.lanes[priority]; ok {
+		return l
+	}
+	return p.lanes[kafka.PriorityNormal]
+}
+
+// acquire takes a worker for l, waiting in its queue while none is free.
+func (p *WorkerPool) acquire(ctx context.Context, l *lane) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	// Freed workers go to waiting messages first, so a free worker means
+	// nothing is queued.
+	if p.free > 0 {
+		p.free--
+		p.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	l.waiting = append(l.waiting, ready)
+	p.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if i := slices.Index(l.waiting, ready); i >= 0 {
+		l.waiting = slices.Delete(l.waiting, i, i+1)
+		return ctx.Err()
+	}
+	// A worker was handed over as ctx ended; pass it on.
+	p.handOff()
+	return ctx.Err()
+}
+
+func (p *WorkerPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handOff()
+}
+
+// handOff gives a freed worker to the next waiting message, or keeps it
+// free if none waits. p.mu must be held.
+func (p *WorkerPool) handOff() {
+	next := p.next()
+	if next == nil {
+		p.free++
+		return
+	}
+
+	ready := next.waiting[0]
+	next.waiting = next.waiting[1:]
+	close(ready)
+}
+
+// next picks the lane to run next by smooth weighted round-robin over the
+// lanes with waiting messages. Idle lanes take no part, so a lone lane gets
+// every worker. Ties go to the more urgent lane.
+func (p *WorkerPool) next() *lane {
+	var best *lane
+	total := 0
+	for _, priority := range kafka.Priorities {
+		l := p.lanes[priority]
+		if len(l.waiting) == 0 {
+			continue
+		}
+		l.credit += l.weight
+		total += l.weight
+		if best == nil || l.credit > best.credit {
+			best = l
+		}
+	}
+	if best != nil {
+		best.credit -= total
+	}
+	return best
+}
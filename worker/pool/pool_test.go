@@ -0,0 +1,147 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mediaConverter/worker/kafka"
+)
+
+func TestWorkerPoolBoundsConcurrency(t *testing.T) {
+	p := NewWorkerPool(2, nil)
+	release := make(chan struct{})
+	var running, peak atomic.Int32
+
+	handler := func(ctx context.Context, msg *kafka.TaskMessage) error {
+		n := running.Add(1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		<-release
+		running.Add(-1)
+		return nil
+	}
+
+	var done atomic.Int32
+	submitted := make(chan struct{})
+	go func() {
+		for range 5 {
+			p.Submit(context.Background(), &kafka.TaskMessage{}, handler, func(error) { done.Add(1) })
+		}
+		close(submitted)
+	}()
+
+	select {
+	case <-submitted:
+		t.Fatal("Submit did not block with every worker busy")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	<-submitted
+	p.Wait()
+
+	if peak.Load() != 2 || done.Load() != 5 {
+		t.Errorf("expected peak 2 and 5 results, got peak %d and %d results", peak.Load(), done.Load())
+	}
+}
+
+func TestWorkerPoolSubmitCancelled(t *testing.T) {
+	p := NewWorkerPool(1, nil)
+	release := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var handlerErr error
+	finished := make(chan struct{})
+	err := p.Submit(ctx, &kafka.TaskMessage{}, func(ctx context.Context, msg *kafka.TaskMessage) error {
+		<-release
+		return ctx.Err()
+	}, func(err error) {
+		handlerErr = err
+		close(finished)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if err := p.Submit(ctx, &kafka.TaskMessage{}, nil, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled Submit to fail, got %v", err)
+	}
+
+	// The running handler is drained, not cancelled.
+	close(release)
+	<-finished
+	p.Wait()
+	if handlerErr != nil {
+		t.Errorf("expected the in-flight handler to keep its context, got %v", handlerErr)
+	}
+}
+
+func TestWorkerPoolWeightsLanes(t *testing.T) {
+	p := NewWorkerPool(1, map[string]int{kafka.PriorityInteractive: 3, kafka.PriorityBulk: 1})
+	release := make(chan struct{})
+
+	var mu sync.Mutex
+	var order []string
+	record := func(ctx context.Context, msg *kafka.TaskMessage) error {
+		mu.Lock()
+		order = append(order, msg.Priority)
+		mu.Unlock()
+		return nil
+	}
+
+	err := p.Submit(context.Background(), &kafka.TaskMessage{}, func(ctx context.Context, msg *kafka.TaskMessage) error {
+		<-release
+		return nil
+	}, func(error) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 4 {
+		for _, priority := range []string{kafka.PriorityBulk, kafka.PriorityInteractive} {
+			go p.Submit(context.Background(), &kafka.TaskMessage{Priority: priority}, record, func(error) {})
+		}
+	}
+	waitQueued(t, p, 8)
+
+	close(release)
+	waitQueued(t, p, 0)
+	p.Wait()
+
+	want := []string{"interactive", "interactive", "bulk", "interactive", "interactive", "bulk", "bulk", "bulk"}
+	if !slices.Equal(order, want) {
+		t.Errorf("expected order %v, got %v", want, order)
+	}
+}
+
+// waitQueued waits until n messages are waiting for a worker.
+func waitQueued(t *testing.T, p *WorkerPool, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		p.mu.Lock()
+		queued := 0
+		for _, l := range p.lanes {
+			queued += len(l.waiting)
+		}
+		p.mu.Unlock()
+
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d queued messages, got %d", n, queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -3,12 +3,23 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Repository interface {
-	UpdateTaskStatus(ctx context.Context, taskID string, status string, errMsg string) error
+	ClaimTask(ctx context.Context, taskID, owner string, ttl time.Duration) error
+	ExtendLease(ctx context.Context, taskID, owner string, ttl time.Duration) error
+	ReleaseTask(ctx context.Context, taskID, owner string) error
+	FinishTask(ctx context.Context, taskID, owner string, status string, errMsg string) error
+	SaveHashes(ctx context.Context, taskID string, ahash, dhash, phash uint64) error
+	FindNearDuplicate(ctx context.Context, taskID string, maxDistance int, sameParams bool) (string, error)
+	MarkDuplicate(ctx context.Context, taskID, owner, duplicateOf string, status string, errMsg string) error
+	SaveResult(ctx context.Context, taskID string, result []byte) error
+	ReapStuckTasks(ctx context.Context, actor string, grace time.Duration, limit int, decide func(*StuckTask) ReapDecision) ([]*StuckTask, error)
 }
 
 type PostgresRepo struct {
@@ -19,15 +30,175 @@ func NewPostgresRepo(db *pgxpool.Pool) *PostgresRepo {
 	return &PostgresRepo{db: db}
 }
 
-func (r *PostgresRepo) UpdateTaskStatus(ctx context.Context, taskID string, status string, errMsg string) error {
-	query := `UPDATE tasks SET status = $1, error_message = $2, updated_at = NOW()`
-	if status == "completed" || status == "failed" {
-		query += `, completed_at = NOW()`
+// ClaimTask sets a pending task to processing, leased to owner for ttl. A
+// processing task can be claimed again by its owner or once its lease has
+// expired. It fails with ErrTaskFinished if the task has been settled and
+// with ErrTaskLeased if another worker holds a live lease on it.
+func (r *PostgresRepo) ClaimTask(ctx context.Context, taskID, owner string, ttl time.Duration) error {
+	query := `
+		UPDATE tasks
+		SET status = 'processing', error_message = '', lease_owner = $2,
+		    lease_expires_at = NOW() + $3 * INTERVAL '1 millisecond', updated_at = NOW()
+		WHERE id = $1
+		  AND (status = 'pending'
+		       OR (status = 'processing'
+		           AND (lease_owner = $2 OR lease_expires_at IS NULL OR lease_expires_at < NOW())))
+	`
+
+	result, err := r.db.Exec(ctx, query, taskID, owner, ttl.Milliseconds())
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() > 0 {
+		return nil
+	}
+
+	var status string
+	err = r.db.QueryRow(ctx, `SELECT status FROM tasks WHERE id = $1`, taskID).Scan(&status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTaskNotFound
+		}
+		return err
+	}
+	if status == "processing" {
+		return ErrTaskLeased
+	}
+	return fmt.Errorf("%w: %s", ErrTaskFinished, status)
+}
+
+// ExtendLease keeps a claimed task leased to owner for another ttl.
+func (r *PostgresRepo) ExtendLease(ctx context.Context, taskID, owner string, ttl time.Duration) error {
+	query := `
+		UPDATE tasks
+		SET lease_expires_at = NOW() + $3 * INTERVAL '1 millisecond', updated_at = NOW()
+		WHERE id = $1 AND status = 'processing' AND lease_owner = $2
+	`
+
+	result, err := r.db.Exec(ctx, query, taskID, owner, ttl.Milliseconds())
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// ReleaseTask puts a task claimed by owner back to pending, so that the next
+// delivery of its message can claim it right away.
+func (r *PostgresRepo) ReleaseTask(ctx context.Context, taskID, owner string) error {
+	query := `
+		UPDATE tasks
+		SET status = 'pending', lease_owner = NULL, lease_expires_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'processing' AND lease_owner = $2
+	`
+
+	_, err := r.db.Exec(ctx, query, taskID, owner)
+	return err
+}
+
+// FinishTask settles a task as completed or failed and drops its lease. It
+// fails with ErrLeaseLost if another worker has claimed the task since, or
+// the task is already settled.
+func (r *PostgresRepo) FinishTask(ctx context.Context, taskID, owner string, status string, errMsg string) error {
+	query := `
+		UPDATE tasks
+		SET status = $3, error_message = $4, lease_owner = NULL, lease_expires_at = NULL,
+		    updated_at = NOW(), completed_at = NOW()
+		WHERE id = $1 AND ` + leaseHeldBy + `
+	`
+
+	result, err := r.db.Exec(ctx, query, taskID, owner, status, errMsg)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// leaseHeldBy matches tasks that the worker given as $2 may settle: its own,
+// and unsettled ones nobody else holds a live lease on.
+const leaseHeldBy = `status IN ('pending', 'processing')
+		  AND (lease_owner = $2 OR lease_owner IS NULL OR lease_expires_at < NOW())`
+
+func (r *PostgresRepo) SaveHashes(ctx context.Context, taskID string, ahash, dhash, phash uint64) error {
+	query := `UPDATE tasks SET ahash = $1, dhash = $2, phash = $3, updated_at = NOW() WHERE id = $4`
+
+	_, err := r.db.Exec(ctx, query, int64(ahash), int64(dhash), int64(phash), taskID)
+	return err
+}
+
+// FindNearDuplicate returns the closest earlier task whose pHash is within
+// maxDistance of the given task's, or "" if there is none. With sameParams
+// only completed tasks converted with identical parameters qualify, so their
+// output can be reused as is.
+func (r *PostgresRepo) FindNearDuplicate(ctx context.Context, taskID string, maxDistance int, sameParams bool) (string, error) {
+	query := `
+		SELECT COALESCE(c.duplicate_of, c.id)
+		FROM tasks t
+		JOIN tasks c ON c.id <> t.id AND c.created_at < t.created_at
+		WHERE t.id = $1
+		  AND t.phash IS NOT NULL AND c.phash IS NOT NULL
+		  AND bit_count((c.phash # t.phash)::bit(64)) <= $2
+	`
+
+	if sameParams {
+		query += `
+		  AND c.status = 'completed'
+		  AND c.output_format IS NOT DISTINCT FROM t.output_format
+		  AND c.target_width IS NOT DISTINCT FROM t.target_width
+		  AND c.target_height IS NOT DISTINCT FROM t.target_height
+		  AND c.crop IS NOT DISTINCT FROM t.crop
+		`
+	} else {
+		query += ` AND c.status <> 'failed'`
+	}
+
+	query += ` ORDER BY bit_count((c.phash # t.phash)::bit(64)), c.created_at LIMIT 1`
+
+	var id string
+	err := r.db.QueryRow(ctx, query, taskID, maxDistance).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("find near duplicate: %w", err)
+	}
+
+	return id, nil
+}
+
+func (r *PostgresRepo) MarkDuplicate(ctx context.Context, taskID, owner, duplicateOf string, status string, errMsg string) error {
+	query := `
+		UPDATE tasks
+		SET status = $3, error_message = $4, duplicate_of = $5, lease_owner = NULL, lease_expires_at = NULL,
+		    updated_at = NOW(), completed_at = NOW()
+		WHERE id = $1 AND ` + leaseHeldBy + `
+	`
+
+	result, err := r.db.Exec(ctx, query, taskID, owner, status, errMsg, duplicateOf)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrLeaseLost
 	}
-	query += ` WHERE id = $3`
+	return nil
+}
 
-	_, err := r.db.Exec(ctx, query, status, errMsg, taskID)
+func (r *PostgresRepo) SaveResult(ctx context.Context, taskID string, result []byte) error {
+	query := `UPDATE tasks SET result = $1, updated_at = NOW() WHERE id = $2`
+
+	_, err := r.db.Exec(ctx, query, result, taskID)
 	return err
 }
 
-var ErrTaskNotFound = errors.New("task not found")
+var (
+	ErrTaskNotFound = errors.New("task not found")
+	ErrTaskFinished = errors.New("task already finished")
+	ErrTaskLeased   = errors.New("task is leased by another worker")
+	ErrLeaseLost    = errors.New("task is no longer leased by this worker")
+)
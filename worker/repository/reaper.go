@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Events recorded in task_events by the reaper.
+const (
+	EventRequeued = "requeued"
+	EventReaped   = "reaped"
+)
+
+// StuckTask is a processing task whose lease has run out.
+type StuckTask struct {
+	ID              string
+	TraceID         string
+	Type            string
+	FilePath        string
+	OutputFormat    string
+	TargetWidth     *int
+	TargetHeight    *int
+	Crop            bool
+	DuplicatePolicy string
+	Priority        string
+	Options         json.RawMessage
+	LeaseOwner      string
+	// RequeueCount is how many times the task has been requeued before.
+	RequeueCount int
+}
+
+// ReapDecision is what becomes of a stuck task: with a Message it is set
+// back to pending and the message is queued through the outbox; without
+// one it is failed with Error.
+type ReapDecision struct {
+	Message *OutboxMessage
+	Error   string
+}
+
+type OutboxMessage struct {
+	Topic   string
+	Payload []byte
+}
+
+// ReapStuckTasks locks up to limit processing tasks whose lease expired, or
+// which have no lease and were last touched more than grace ago, and settles
+// each as decide says. Status, outbox message and event of a task are
+// written in one transaction; tasks locked by another reaper are skipped.
+func (r *PostgresRepo) ReapStuckTasks(ctx context.Context, actor string, grace time.Duration, limit int, decide func(*StuckTask) ReapDecision) ([]*StuckTask, error) {
+	var reaped []*StuckTask
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		query := `
+			SELECT id, trace_id, task_type, COALESCE(file_path, ''), COALESCE(output_format, ''), target_width, target_height,
+			       COALESCE(crop, false), COALESCE(duplicate_policy, ''), priority, options, COALESCE(lease_owner, ''), requeue_count
+			FROM tasks
+			WHERE status = 'processing'
+			  AND COALESCE(lease_expires_at, updated_at + $1 * INTERVAL '1 millisecond') < NOW()
+			ORDER BY updated_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		`
+
+		rows, err := tx.Query(ctx, query, grace.Milliseconds(), limit)
+		if err != nil {
+			return err
+		}
+		tasks, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*StuckTask, error) {
+			var t StuckTask
+			err := row.Scan(&t.ID, &t.TraceID, &t.Type, &t.FilePath, &t.OutputFormat, &t.TargetWidth, &t.TargetHeight,
+				&t.Crop, &t.DuplicatePolicy, &t.Priority, &t.Options, &t.LeaseOwner, &t.RequeueCount)
+			return &t, err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, task := range tasks {
+			decision := decide(task)
+			if err := reap(ctx, tx, actor, task, decision); err != nil {
+				return fmt.Errorf("reap task %s: %w", task.ID, err)
+			}
+		}
+		reaped = tasks
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reaped, nil
+}
+
+func reap(ctx context.Context, tx pgx.Tx, actor string, task *StuckTask, decision ReapDecision) error {
+	owner := task.LeaseOwner
+	if owner == "" {
+		owner = "unknown"
+	}
+
+	if decision.Message == nil {
+		_, err := tx.Exec(ctx, `
+			UPDATE tasks
+			SET status = 'failed', error_message = $2, lease_owner = NULL, lease_expires_at = NULL,
+			    updated_at = NOW(), completed_at = NOW()
+			WHERE id = $1
+		`, task.ID, decision.Error)
+		if err != nil {
+			return err
+		}
+		return addEvent(ctx, tx, task.ID, EventReaped, actor,
+			fmt.Sprintf("lease of %s expired; failed after %d requeues", owner, task.RequeueCount))
+	}
+
+	_, err := tx.Exec(ctx, `
+		UPDATE tasks
+		SET status = 'pending', lease_owner = NULL, lease_expires_at = NULL,
+		    requeue_count = requeue_count + 1, updated_at = NOW()
+		WHERE id = $1
+	`, task.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO task_outbox (task_id, topic, payload) VALUES ($1, $2, $3)`,
+		task.ID, decision.Message.Topic, decision.Message.Payload)
+	if err != nil {
+		return err
+	}
+
+	return addEvent(ctx, tx, task.ID, EventRequeued, actor,
+		fmt.Sprintf("lease of %s expired; requeue %d", owner, task.RequeueCount+1))
+}
+
+func addEvent(ctx context.Context, tx pgx.Tx, taskID, event, actor, message string) error {
+	_, err := tx.Exec(ctx, `INSERT INTO task_events (task_id, event, actor, message) VALUES ($1, $2, $3, $4)`,
+		taskID, event, actor, message)
+	return err
+}
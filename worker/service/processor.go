@@ -2,7 +2,12 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -11,34 +16,105 @@ import (
 	"mediaConverter/worker/converter"
 	"mediaConverter/worker/kafka"
 	"mediaConverter/worker/repository"
+	"mediaConverter/worker/storage"
 )
 
+const (
+	duplicatePolicyReject = "reject"
+	duplicatePolicyReuse  = "reuse"
+)
+
+type compareResult struct {
+	Width      int      `json:"width"`
+	Height     int      `json:"height"`
+	Normalized bool     `json:"normalized"`
+	MSE        float64  `json:"mse"`
+	PSNR       *float64 `json:"psnr"`
+	SSIM       float64  `json:"ssim"`
+}
+
+type tilesResult struct {
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Levels   int    `json:"levels"`
+	Tiles    int    `json:"tiles"`
+	TileSize int    `json:"tile_size"`
+	Overlap  int    `json:"overlap"`
+	Format   string `json:"format"`
+}
+
 type Processor struct {
 	repo      repository.Repository
 	cache     *cache.StatusCache
+	storage   storage.Backend
 	logger    *zap.Logger
 	converter *converter.Converter
+
+	// workerID owns the leases this processor takes on tasks; a lease lasts
+	// leaseTTL unless renewed.
+	workerID string
+	leaseTTL time.Duration
+
+	duplicateDistance int
+
+	mu      sync.Mutex
+	running map[string]context.CancelCauseFunc
 }
 
-func NewProcessor(repo repository.Repository, cache *cache.StatusCache, logger *zap.Logger) *Processor {
+// errCancelled is the cause of the context of a task cancelled through the
+// API.
+var errCancelled = errors.New("task cancelled")
+
+func NewProcessor(repo repository.Repository, cache *cache.StatusCache, files storage.Backend, logger *zap.Logger, workerID string, leaseTTL time.Duration, duplicateDistance int) *Processor {
 	return &Processor{
-		repo:      repo,
-		cache:     cache,
-		logger:    logger,
-		converter: converter.NewConverter(logger),
+		repo:              repo,
+		cache:             cache,
+		storage:           files,
+		logger:            logger,
+		converter:         converter.NewConverter(logger),
+		workerID:          workerID,
+		leaseTTL:          leaseTTL,
+		duplicateDistance: duplicateDistance,
+		running:           make(map[string]context.CancelCauseFunc),
 	}
 }
 
+// Process runs the task of msg. Messages are delivered at least once, so the
+// task is first claimed: a task that is already settled or that another
+// worker is running is skipped. Should that worker die, the reaper requeues
+// the task once its lease expires.
 func (p *Processor) Process(ctx context.Context, msg *kafka.TaskMessage) error {
 	startTime := time.Now()
 
-	if err := p.repo.UpdateTaskStatus(ctx, msg.TaskID, "processing", ""); err != nil {
-		return err
+	if err := p.repo.ClaimTask(ctx, msg.TaskID, p.workerID, p.leaseTTL); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrTaskFinished):
+			p.logger.Info("Skipping finished task",
+				zap.String("task_id", msg.TaskID),
+				zap.Error(err),
+			)
+			return nil
+		case errors.Is(err, repository.ErrTaskLeased):
+			p.logger.Info("Skipping task leased by another worker",
+				zap.String("task_id", msg.TaskID),
+				zap.Error(err),
+			)
+			return nil
+		case errors.Is(err, repository.ErrTaskNotFound):
+			return kafka.Permanent(err)
+		default:
+			return err
+		}
 	}
 	if err := p.cache.Set(ctx, msg.TaskID, "processing"); err != nil {
 		return err
 	}
 
+	ctx, release := p.keepLease(ctx, msg.TaskID)
+	defer release()
+	ctx, untrack := p.track(ctx, msg.TaskID)
+	defer untrack()
+
 	p.logger.Info("Processing task",
 		zap.String("task_id", msg.TaskID),
 		zap.String("trace_id", msg.TraceID),
@@ -46,29 +122,53 @@ func (p *Processor) Process(ctx context.Context, msg *kafka.TaskMessage) error {
 		zap.String("output_format", msg.OutputFormat),
 	)
 
-	inputPath := msg.FilePath
+	// Inputs are fetched into and outputs rendered in a scratch directory;
+	// only finished outputs are uploaded to storage.
+	work, err := os.MkdirTemp("", "task-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(work)
+
+	source, err := storage.Fetch(ctx, p.storage, msg.FilePath, work)
+	if err != nil {
+		return p.fail(ctx, msg, unavailable(fmt.Errorf("failed to fetch source: %w", err)))
+	}
+
+	if msg.Type == "" || msg.Type == kafka.TaskTypeConvert {
+		if done, err := p.checkDuplicates(ctx, msg, source); err != nil || done {
+			return err
+		}
+	}
 
-	ext := filepath.Ext(inputPath)
+	ext := filepath.Ext(msg.FilePath)
 	if msg.OutputFormat != "" {
 		ext = "." + msg.OutputFormat
 	}
-	outputPath := "/uploads/" + msg.TaskID + ext
+	outputKey := msg.TaskID + ext
+	outputPath := filepath.Join(work, outputKey)
 
-	if err := p.converter.Convert(inputPath, outputPath, msg.OutputFormat, msg.TargetWidth, msg.TargetHeight, msg.Crop); err != nil {
-		p.logger.Error("Failed to convert image",
-			zap.String("task_id", msg.TaskID),
-			zap.Error(err),
-		)
-		if err := p.repo.UpdateTaskStatus(ctx, msg.TaskID, "failed", err.Error()); err != nil {
-			return err
-		}
-		if err := p.cache.Set(ctx, msg.TaskID, "failed"); err != nil {
+	result, err := p.run(ctx, msg, source, outputPath)
+	if err != nil {
+		return p.fail(ctx, msg, err)
+	}
+	if err := storage.PutFile(ctx, p.storage, outputKey, outputPath); err != nil {
+		return p.fail(ctx, msg, unavailable(fmt.Errorf("failed to store output: %w", err)))
+	}
+
+	if result != nil {
+		if err := p.repo.SaveResult(ctx, msg.TaskID, result); err != nil {
 			return err
 		}
-		return err
 	}
 
-	if err := p.repo.UpdateTaskStatus(ctx, msg.TaskID, "completed", ""); err != nil {
+	if err := p.repo.FinishTask(ctx, msg.TaskID, p.workerID, "completed", ""); err != nil {
+		if errors.Is(err, repository.ErrLeaseLost) {
+			p.logger.Warn("Task was cancelled or taken over before it completed",
+				zap.String("task_id", msg.TaskID),
+			)
+			return nil
+		}
 		return err
 	}
 	if err := p.cache.Set(ctx, msg.TaskID, "completed"); err != nil {
@@ -83,3 +183,302 @@ func (p *Processor) Process(ctx context.Context, msg *kafka.TaskMessage) error {
 
 	return nil
 }
+
+// Cancel stops the task if this processor is running it. The task's status
+// is left to whoever cancelled it.
+func (p *Processor) Cancel(taskID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cancel, ok := p.running[taskID]
+	if ok {
+		cancel(errCancelled)
+	}
+	return ok
+}
+
+// track makes the task cancellable through Cancel until untrack is called.
+func (p *Processor) track(ctx context.Context, taskID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	p.mu.Lock()
+	p.running[taskID] = cancel
+	p.mu.Unlock()
+
+	return ctx, func() {
+		p.mu.Lock()
+		delete(p.running, taskID)
+		p.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// keepLease renews the lease on a claimed task until release is called. If
+// the lease is lost to another worker, the returned context is cancelled with
+// repository.ErrLeaseLost as its cause.
+func (p *Processor) keepLease(ctx context.Context, taskID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(p.leaseTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			err := p.repo.ExtendLease(ctx, taskID, p.workerID, p.leaseTTL)
+			if errors.Is(err, repository.ErrLeaseLost) {
+				p.logger.Warn("Task lease lost", zap.String("task_id", taskID))
+				cancel(err)
+				return
+			}
+			if err != nil {
+				p.logger.Warn("Failed to renew task lease", zap.String("task_id", taskID), zap.Error(err))
+			}
+		}
+	}()
+
+	return ctx, func() {
+		close(done)
+		<-stopped
+		cancel(nil)
+	}
+}
+
+// fail handles a processing error. Errors marked unavailable are returned
+// as is to be retried, with the task released for the next attempt;
+// anything else, such as an undecodable source, cannot be fixed by
+// retrying, so the task is failed right away.
+func (p *Processor) fail(ctx context.Context, msg *kafka.TaskMessage, err error) error {
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, errCancelled):
+		p.logger.Info("Task cancelled", zap.String("task_id", msg.TaskID))
+		return nil
+	case errors.Is(cause, repository.ErrLeaseLost):
+		// The worker now holding the task settles it.
+		return nil
+	}
+
+	var retry *retryableError
+	if errors.As(err, &retry) {
+		if releaseErr := p.repo.ReleaseTask(ctx, msg.TaskID, p.workerID); releaseErr != nil {
+			p.logger.Warn("Failed to release task", zap.String("task_id", msg.TaskID), zap.Error(releaseErr))
+		} else {
+			p.cache.Set(ctx, msg.TaskID, "pending")
+		}
+		return err
+	}
+
+	if markErr := p.MarkFailed(ctx, msg, err); markErr != nil {
+		return markErr
+	}
+	return kafka.Permanent(err)
+}
+
+// retryableError is a failure of a dependency that a later attempt may not
+// run into.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// unavailable marks a storage error as retryable, unless the object is
+// missing: that will not change on a later attempt.
+func unavailable(err error) error {
+	if errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return &retryableError{err: err}
+}
+
+// MarkFailed sets the task of msg to failed with err as the reason. It is
+// also used once a message has run out of retries.
+func (p *Processor) MarkFailed(ctx context.Context, msg *kafka.TaskMessage, err error) error {
+	p.logger.Error("Failed to process task",
+		zap.String("task_id", msg.TaskID),
+		zap.String("type", msg.Type),
+		zap.Error(err),
+	)
+	if err := p.repo.FinishTask(ctx, msg.TaskID, p.workerID, "failed", err.Error()); err != nil {
+		if errors.Is(err, repository.ErrLeaseLost) {
+			// Settled, or held by another worker, in the meantime.
+			return nil
+		}
+		return err
+	}
+	return p.cache.Set(ctx, msg.TaskID, "failed")
+}
+
+// run performs the work for the task's type on the fetched source and returns
+// its JSON result, if the type has one.
+func (p *Processor) run(ctx context.Context, msg *kafka.TaskMessage, source, outputPath string) ([]byte, error) {
+	switch msg.Type {
+	case "", kafka.TaskTypeConvert:
+		return nil, p.converter.Convert(ctx, source, outputPath, msg.OutputFormat, msg.TargetWidth, msg.TargetHeight, msg.Crop)
+	case kafka.TaskTypeCompare:
+		return p.compare(ctx, msg, source, outputPath)
+	case kafka.TaskTypeContactSheet:
+		return nil, p.contactSheet(ctx, msg, outputPath)
+	case kafka.TaskTypeTiles:
+		return p.tiles(ctx, msg, source, outputPath)
+	default:
+		return nil, fmt.Errorf("unsupported task type: %s", msg.Type)
+	}
+}
+
+func (p *Processor) compare(ctx context.Context, msg *kafka.TaskMessage, source, outputPath string) ([]byte, error) {
+	var opts kafka.CompareOptions
+	if err := json.Unmarshal(msg.Options, &opts); err != nil {
+		return nil, fmt.Errorf("invalid compare options: %w", err)
+	}
+
+	candidate, err := storage.Fetch(ctx, p.storage, opts.CandidatePath, filepath.Dir(outputPath))
+	if err != nil {
+		return nil, unavailable(fmt.Errorf("failed to fetch candidate: %w", err))
+	}
+
+	comparison, err := p.converter.CompareFiles(ctx, source, candidate, outputPath, opts.Normalize)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(compareResult{
+		Width:      comparison.Width,
+		Height:     comparison.Height,
+		Normalized: comparison.Normalized,
+		MSE:        comparison.MSE,
+		PSNR:       comparison.PSNR,
+		SSIM:       comparison.SSIM,
+	})
+}
+
+func (p *Processor) contactSheet(ctx context.Context, msg *kafka.TaskMessage, outputPath string) error {
+	var opts kafka.ContactSheetOptions
+	if err := json.Unmarshal(msg.Options, &opts); err != nil {
+		return fmt.Errorf("invalid contact sheet options: %w", err)
+	}
+
+	background, err := converter.ParseHexColor(opts.Background)
+	if err != nil {
+		return err
+	}
+
+	cells := make([]converter.SheetCell, len(opts.Sources))
+	for i, source := range opts.Sources {
+		path, err := storage.Fetch(ctx, p.storage, source.Path, filepath.Dir(outputPath))
+		if err != nil {
+			return unavailable(fmt.Errorf("failed to fetch %s: %w", source.Filename, err))
+		}
+		cells[i] = converter.SheetCell{Path: path, Caption: source.Filename}
+	}
+
+	return p.converter.ContactSheet(ctx, cells, converter.SheetOptions{
+		Columns:    opts.Columns,
+		CellWidth:  opts.CellWidth,
+		CellHeight: opts.CellHeight,
+		Gutter:     opts.Gutter,
+		Background: background,
+		Captions:   opts.Captions,
+		Fit:        opts.Fit,
+	}, outputPath, msg.OutputFormat)
+}
+
+// tiles stores the Deep Zoom pyramid next to the output and packs it into the
+// output ZIP, so it can be served tile by tile as well as downloaded.
+func (p *Processor) tiles(ctx context.Context, msg *kafka.TaskMessage, source, outputPath string) ([]byte, error) {
+	var opts kafka.TileOptions
+	if err := json.Unmarshal(msg.Options, &opts); err != nil {
+		return nil, fmt.Errorf("invalid tile options: %w", err)
+	}
+
+	pyramid, err := p.converter.Tiles(ctx, source, filepath.Dir(outputPath), msg.TaskID, converter.TileOptions{
+		TileSize: opts.TileSize,
+		Overlap:  opts.Overlap,
+		Format:   opts.Format,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := converter.ZipPyramid(pyramid, outputPath); err != nil {
+		return nil, err
+	}
+
+	if _, err := storage.PutDir(ctx, p.storage, msg.TaskID+"_files", pyramid.FilesDir); err != nil {
+		return nil, unavailable(fmt.Errorf("failed to store tiles: %w", err))
+	}
+	if err := storage.PutFile(ctx, p.storage, msg.TaskID+".dzi", pyramid.DZIPath); err != nil {
+		return nil, unavailable(fmt.Errorf("failed to store DZI descriptor: %w", err))
+	}
+
+	return json.Marshal(tilesResult{
+		Width:    pyramid.Width,
+		Height:   pyramid.Height,
+		Levels:   pyramid.Levels,
+		Tiles:    pyramid.Tiles,
+		TileSize: opts.TileSize,
+		Overlap:  opts.Overlap,
+		Format:   opts.Format,
+	})
+}
+
+// checkDuplicates stores the perceptual hashes of the source and applies the
+// task's duplicate policy. It reports done when the task was settled without
+// a conversion.
+func (p *Processor) checkDuplicates(ctx context.Context, msg *kafka.TaskMessage, source string) (bool, error) {
+	hashes, err := p.converter.Hash(source)
+	if err != nil {
+		p.logger.Warn("Failed to compute perceptual hashes",
+			zap.String("task_id", msg.TaskID),
+			zap.Error(err),
+		)
+		return false, nil
+	}
+
+	if err := p.repo.SaveHashes(ctx, msg.TaskID, hashes.Average, hashes.Difference, hashes.Perceptual); err != nil {
+		return false, err
+	}
+
+	if msg.DuplicatePolicy != duplicatePolicyReject && msg.DuplicatePolicy != duplicatePolicyReuse {
+		return false, nil
+	}
+
+	duplicateOf, err := p.repo.FindNearDuplicate(ctx, msg.TaskID, p.duplicateDistance, msg.DuplicatePolicy == duplicatePolicyReuse)
+	if err != nil {
+		return false, err
+	}
+	if duplicateOf == "" {
+		return false, nil
+	}
+
+	status, errMsg := "completed", ""
+	if msg.DuplicatePolicy == duplicatePolicyReject {
+		status, errMsg = "failed", "near-duplicate of task "+duplicateOf
+	}
+
+	if err := p.repo.MarkDuplicate(ctx, msg.TaskID, p.workerID, duplicateOf, status, errMsg); err != nil {
+		if errors.Is(err, repository.ErrLeaseLost) {
+			return true, nil
+		}
+		return false, err
+	}
+	if err := p.cache.Set(ctx, msg.TaskID, status); err != nil {
+		return false, err
+	}
+
+	p.logger.Info("Near-duplicate detected",
+		zap.String("task_id", msg.TaskID),
+		zap.String("duplicate_of", duplicateOf),
+		zap.String("policy", msg.DuplicatePolicy),
+	)
+
+	return true, nil
+}
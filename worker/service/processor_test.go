@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+
+	"mediaConverter/worker/kafka"
+	"mediaConverter/worker/repository"
+)
+
+func TestProcessorCancel(t *testing.T) {
+	processor := NewProcessor(nil, nil, nil, zaptest.NewLogger(t), "worker-1", time.Minute, 5)
+
+	ctx, untrack := processor.track(context.Background(), "task-1")
+
+	if processor.Cancel("task-2") {
+		t.Error("Expected an unknown task not to be cancelled")
+	}
+	if !processor.Cancel("task-1") {
+		t.Fatal("Expected the running task to be cancelled")
+	}
+	if !errors.Is(context.Cause(ctx), errCancelled) {
+		t.Errorf("Expected errCancelled as the cause, got %v", context.Cause(ctx))
+	}
+
+	untrack()
+	if processor.Cancel("task-1") {
+		t.Error("Expected a finished task not to be cancelled")
+	}
+}
+
+// claimRepo answers ClaimTask with err; the rest of the repository is not
+// expected to be used.
+type claimRepo struct {
+	repository.Repository
+	err    error
+	claims int
+}
+
+func (r *claimRepo) ClaimTask(ctx context.Context, taskID, owner string, ttl time.Duration) error {
+	r.claims++
+	return r.err
+}
+
+func TestProcessorSkipsUnclaimedTasks(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"leased by another worker", repository.ErrTaskLeased},
+		{"finished", repository.ErrTaskFinished},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &claimRepo{err: tt.err}
+			// Without a cache or storage, anything past the claim panics.
+			processor := NewProcessor(repo, nil, nil, zaptest.NewLogger(t), "worker-2", time.Minute, 5)
+
+			err := processor.Process(context.Background(), &kafka.TaskMessage{TaskID: "task-1"})
+
+			if err != nil {
+				t.Errorf("Expected the duplicate delivery to be skipped, got %v", err)
+			}
+			if repo.claims != 1 {
+				t.Errorf("Expected one claim, got %d", repo.claims)
+			}
+		})
+	}
+}
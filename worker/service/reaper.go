@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mediaConverter/worker/cache"
+	"mediaConverter/worker/kafka"
+	"mediaConverter/worker/repository"
+)
+
+const reapBatchSize = 100
+
+// Reaper requeues tasks left processing by a worker that stopped renewing
+// their lease, typically because it died mid-conversion. Requeued messages
+// go through the outbox, which the API relays to Kafka. Every worker runs a
+// reaper; stuck tasks are locked while reaped, so each is handled once.
+type Reaper struct {
+	repo  repository.Repository
+	cache *cache.StatusCache
+	topic string
+	// workerID is recorded as the actor of reaper events.
+	workerID    string
+	leaseTTL    time.Duration
+	maxRequeues int
+	logger      *zap.Logger
+}
+
+func NewReaper(repo repository.Repository, cache *cache.StatusCache, topic, workerID string, leaseTTL time.Duration, maxRequeues int, logger *zap.Logger) *Reaper {
+	return &Reaper{
+		repo:        repo,
+		cache:       cache,
+		topic:       topic,
+		workerID:    workerID,
+		leaseTTL:    leaseTTL,
+		maxRequeues: maxRequeues,
+		logger:      logger,
+	}
+}
+
+// Run reaps stuck tasks every interval until ctx is done.
+func (r *Reaper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := r.Reap(ctx); err != nil {
+			r.logger.Error("Failed to reap stuck tasks", zap.Error(err))
+		}
+	}
+}
+
+// Reap settles the tasks stuck right now: each is requeued until it has been
+// requeued maxRequeues times, and failed after that.
+func (r *Reaper) Reap(ctx context.Context) error {
+	for {
+		decisions := make(map[string]repository.ReapDecision)
+		tasks, err := r.repo.ReapStuckTasks(ctx, r.workerID, r.leaseTTL, reapBatchSize, func(task *repository.StuckTask) repository.ReapDecision {
+			decision := r.decide(task)
+			decisions[task.ID] = decision
+			return decision
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, task := range tasks {
+			status := "pending"
+			if decisions[task.ID].Message == nil {
+				status = "failed"
+			}
+			if err := r.cache.Set(ctx, task.ID, status); err != nil {
+				r.logger.Warn("Failed to update task status cache", zap.String("task_id", task.ID), zap.Error(err))
+			}
+
+			r.logger.Warn("Reaped stuck task",
+				zap.String("task_id", task.ID),
+				zap.String("lease_owner", task.LeaseOwner),
+				zap.Int("requeues", task.RequeueCount),
+				zap.String("status", status),
+			)
+		}
+
+		if len(tasks) < reapBatchSize {
+			return nil
+		}
+	}
+}
+
+func (r *Reaper) decide(task *repository.StuckTask) repository.ReapDecision {
+	if task.RequeueCount >= r.maxRequeues {
+		return repository.ReapDecision{
+			Error: fmt.Sprintf("worker stopped responding while processing the task (%d times)", task.RequeueCount+1),
+		}
+	}
+
+	payload, err := json.Marshal(&kafka.TaskMessage{
+		TaskID:          task.ID,
+		TraceID:         task.TraceID,
+		FilePath:        task.FilePath,
+		OutputFormat:    task.OutputFormat,
+		TargetWidth:     task.TargetWidth,
+		TargetHeight:    task.TargetHeight,
+		Crop:            task.Crop,
+		DuplicatePolicy: task.DuplicatePolicy,
+		Priority:        task.Priority,
+		Type:            task.Type,
+		Options:         task.Options,
+	})
+	if err != nil {
+		return repository.ReapDecision{Error: fmt.Sprintf("failed to requeue stuck task: %v", err)}
+	}
+
+	return repository.ReapDecision{
+		Message: &repository.OutboxMessage{Topic: kafka.PriorityTopic(r.topic, task.Priority), Payload: payload},
+	}
+}
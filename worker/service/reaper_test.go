@@ -0,0 +1,71 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+
+	"mediaConverter/worker/kafka"
+	"mediaConverter/worker/repository"
+)
+
+func TestReaperDecide(t *testing.T) {
+	reaper := NewReaper(nil, nil, "media_tasks", "worker-1", time.Minute, 2, zaptest.NewLogger(t))
+	width := 320
+	task := &repository.StuckTask{
+		ID:           "task-1",
+		TraceID:      "trace-1",
+		Type:         "convert",
+		FilePath:     "blobs/ab/abc.jpg",
+		OutputFormat: "png",
+		TargetWidth:  &width,
+		Options:      json.RawMessage(`{"k":1}`),
+		LeaseOwner:   "worker-0",
+	}
+
+	for requeues := 0; requeues < 2; requeues++ {
+		task.RequeueCount = requeues
+		decision := reaper.decide(task)
+		if decision.Message == nil {
+			t.Fatalf("Expected a requeue after %d requeues, got failure %q", requeues, decision.Error)
+		}
+		if decision.Message.Topic != "media_tasks" {
+			t.Errorf("Expected topic media_tasks, got %s", decision.Message.Topic)
+		}
+
+		var msg kafka.TaskMessage
+		if err := json.Unmarshal(decision.Message.Payload, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.TaskID != task.ID || msg.FilePath != task.FilePath || msg.OutputFormat != "png" ||
+			msg.TargetWidth == nil || *msg.TargetWidth != 320 || msg.Type != "convert" || string(msg.Options) != `{"k":1}` {
+			t.Errorf("Unexpected message %+v", msg)
+		}
+	}
+
+	task.RequeueCount = 2
+	decision := reaper.decide(task)
+	if decision.Message != nil || decision.Error == "" {
+		t.Errorf("Expected the task to fail after 2 requeues, got %+v", decision)
+	}
+}
+
+func TestReaperDecideKeepsLane(t *testing.T) {
+	reaper := NewReaper(nil, nil, "media_tasks", "worker-1", time.Minute, 2, zaptest.NewLogger(t))
+	task := &repository.StuckTask{ID: "task-1", Type: "convert", Priority: kafka.PriorityBulk}
+
+	decision := reaper.decide(task)
+	if decision.Message == nil || decision.Message.Topic != "media_tasks.bulk" {
+		t.Fatalf("Expected a requeue to media_tasks.bulk, got %+v", decision)
+	}
+
+	var msg kafka.TaskMessage
+	if err := json.Unmarshal(decision.Message.Payload, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Priority != kafka.PriorityBulk {
+		t.Errorf("Expected priority bulk, got %q", msg.Priority)
+	}
+}
@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSignature = errors.New("invalid or expired signature")
+
+// Local stores objects as files under a root directory. Presigned URLs point
+// at <publicURL>/files/<key> and are checked with VerifyPresigned by the
+// serving handler.
+type Local struct {
+	root      string
+	publicURL string
+	key       []byte
+	now       func() time.Time
+}
+
+func NewLocal(root, publicURL string, signingKey []byte) (*Local, error) {
+	root = filepath.Clean(root)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("create storage root: %w", err)
+	}
+	return &Local{
+		root:      root,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		key:       signingKey,
+		now:       time.Now,
+	}, nil
+}
+
+// LocalPath returns the file holding key. Absolute paths under the root, as
+// stored before keys were relative, are accepted as well.
+func (l *Local) LocalPath(key string) (string, error) {
+	if rel, ok := strings.CutPrefix(key, l.root+"/"); ok {
+		key = rel
+	}
+
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the object to a temporary file first so readers never see a
+// partial object.
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	p, err := l.LocalPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("create object dir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create object: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write object: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write object: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("commit object: %w", err)
+	}
+	return nil
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	p, err := l.LocalPath(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, l.mapError(key, err)
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if stat.IsDir() {
+		f.Close()
+		return nil, nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	return f, &ObjectInfo{Key: key, Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	p, err := l.LocalPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(p)
+	if err != nil {
+		return nil, l.mapError(key, err)
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	return &ObjectInfo{Key: key, Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	p, err := l.LocalPath(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) Move(ctx context.Context, src, dst string) error {
+	from, err := l.LocalPath(src)
+	if err != nil {
+		return err
+	}
+	to, err := l.LocalPath(dst)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return fmt.Errorf("create object dir: %w", err)
+	}
+
+	if err := os.Rename(from, to); err != nil {
+		return l.mapError(src, err)
+	}
+	return nil
+}
+
+func (l *Local) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	err := filepath.WalkDir(l.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (l *Local) Presign(ctx context.Context, method, key string, expires time.Duration) (string, error) {
+	if !isPresignMethod(method) {
+		return "", fmt.Errorf("cannot presign %s", method)
+	}
+	if len(l.key) == 0 {
+		return "", errors.New("presigning requires a signing key")
+	}
+
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	exp := strconv.FormatInt(l.now().Add(expires).Unix(), 10)
+	query := url.Values{
+		"expires":   {exp},
+		"signature": {l.sign(method, key, exp)},
+	}
+
+	u := &url.URL{Path: "/files/" + key, RawQuery: query.Encode()}
+	return l.publicURL + u.String(), nil
+}
+
+// VerifyPresigned checks the expires and signature query parameters of a
+// presigned request for method on key.
+func (l *Local) VerifyPresigned(method, key string, query url.Values) error {
+	if len(l.key) == 0 {
+		return ErrInvalidSignature
+	}
+
+	exp := query.Get("expires")
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || l.now().Unix() > unix {
+		return ErrInvalidSignature
+	}
+
+	want := l.sign(method, key, exp)
+	if !hmac.Equal([]byte(query.Get("signature")), []byte(want)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (l *Local) sign(method, key, expires string) string {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(method + "\n" + key + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (l *Local) mapError(key string, err error) error {
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return err
+}
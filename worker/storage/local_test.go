@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanKey(t *testing.T) {
+	valid := []string{"a.jpg", "blobs/ab/abc.png", "task_files/0/0_0.jpg"}
+	for _, key := range valid {
+		if _, err := CleanKey(key); err != nil {
+			t.Errorf("CleanKey(%q): unexpected error %v", key, err)
+		}
+	}
+
+	invalid := []string{"", ".", "..", "../etc/passwd", "a/../../b", "/abs", "a//b", "a/./b", "a\\b"}
+	for _, key := range invalid {
+		if _, err := CleanKey(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("CleanKey(%q): expected ErrInvalidKey, got %v", key, err)
+		}
+	}
+}
+
+func TestLocalBackend(t *testing.T) {
+	root := t.TempDir()
+	l, err := NewLocal(root, "http://localhost", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := l.Put(ctx, "blobs/ab/x.jpg", strings.NewReader("hello"), 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Put(ctx, "out.png", strings.NewReader("world"), 5); err != nil {
+		t.Fatal(err)
+	}
+
+	r, info, err := l.Get(ctx, "blobs/ab/x.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "hello" || info.Size != 5 {
+		t.Errorf("unexpected object %q (size %d)", data, info.Size)
+	}
+
+	legacy, err := l.LocalPath(filepath.Join(root, "out.png"))
+	if err != nil || legacy != filepath.Join(root, "out.png") {
+		t.Errorf("expected absolute path under root to resolve, got %s, %v", legacy, err)
+	}
+
+	listed, err := l.List(ctx, "blobs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].Key != "blobs/ab/x.jpg" {
+		t.Errorf("unexpected listing %+v", listed)
+	}
+
+	if err := l.Put(ctx, "tmp/stream", strings.NewReader("streamed"), -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Move(ctx, "tmp/stream", "blobs/cd/y.png"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := l.Stat(ctx, "blobs/cd/y.png"); err != nil || info.Size != 8 {
+		t.Errorf("expected moved object, got %+v, %v", info, err)
+	}
+	if err := l.Move(ctx, "tmp/stream", "z.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound moving a missing object, got %v", err)
+	}
+
+	if err := l.Delete(ctx, "blobs/ab/x.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Stat(ctx, "blobs/ab/x.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := l.Stat(ctx, "blobs"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected directories not to be objects, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "..", "escape")); err == nil {
+		t.Error("unexpected file outside the root")
+	}
+}
+
+func TestLocalPresign(t *testing.T) {
+	l, err := NewLocal(t.TempDir(), "http://localhost/", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	l.now = func() time.Time { return now }
+
+	presigned, err := l.Presign(context.Background(), http.MethodGet, "out.png", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(presigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "localhost" || u.Path != "/files/out.png" {
+		t.Errorf("unexpected URL %s", presigned)
+	}
+
+	if err := l.VerifyPresigned(http.MethodGet, "out.png", u.Query()); err != nil {
+		t.Errorf("expected signature to verify: %v", err)
+	}
+	if err := l.VerifyPresigned(http.MethodPut, "out.png", u.Query()); err == nil {
+		t.Error("expected a GET signature not to allow PUT")
+	}
+	if err := l.VerifyPresigned(http.MethodGet, "other.png", u.Query()); err == nil {
+		t.Error("expected signature not to cover another key")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if err := l.VerifyPresigned(http.MethodGet, "out.png", u.Query()); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected expired signature to fail, got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("object not found")
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Backend stores objects under slash-separated keys such as
+// "blobs/ab/abcd.jpg" or "<task-id>.png".
+type Backend interface {
+	// Put stores r under key. A negative size means the length is unknown and
+	// the body is streamed until EOF.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	// Move renames src to dst, replacing dst if it exists.
+	Move(ctx context.Context, src, dst string) error
+	// List returns the objects whose keys start with prefix, ordered by key.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Presign returns a URL that allows method (GET or PUT) on key without
+	// further credentials until it expires.
+	Presign(ctx context.Context, method, key string, expires time.Duration) (string, error)
+}
+
+// LocalFiler is implemented by backends whose objects already are files on
+// this host, so callers can use them in place instead of downloading.
+type LocalFiler interface {
+	LocalPath(key string) (string, error)
+}
+
+type Config struct {
+	Backend    string
+	LocalRoot  string
+	PublicURL  string
+	SigningKey string
+	S3         S3Config
+}
+
+func New(cfg Config) (Backend, error) {
+	switch cfg.Backend {
+	case "", BackendLocal:
+		return NewLocal(cfg.LocalRoot, cfg.PublicURL, []byte(cfg.SigningKey))
+	case BackendS3:
+		return NewS3(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// CleanKey validates an object key and returns it in canonical form. Keys are
+// relative; "..", empty segments and backslashes are rejected.
+func CleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+
+	cleaned := path.Clean(key)
+	if cleaned != key || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return cleaned, nil
+}
+
+// PutFile uploads the file at path under key.
+func PutFile(ctx context.Context, b Backend, key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	return b.Put(ctx, key, f, info.Size())
+}
+
+// Fetch makes the object available as a local file inside dir and returns its
+// path. Objects of a LocalFiler backend are used in place.
+func Fetch(ctx context.Context, b Backend, key, dir string) (string, error) {
+	if lf, ok := b.(LocalFiler); ok {
+		return lf.LocalPath(key)
+	}
+
+	r, _, err := b.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	f, err := os.CreateTemp(dir, "fetch-*"+path.Ext(key))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("download %s: %w", key, err)
+	}
+	return f.Name(), f.Close()
+}
+
+// FetchTemp is Fetch into a fresh temporary directory; cleanup removes it.
+func FetchTemp(ctx context.Context, b Backend, key string) (string, func(), error) {
+	if lf, ok := b.(LocalFiler); ok {
+		p, err := lf.LocalPath(key)
+		return p, func() {}, err
+	}
+
+	dir, err := os.MkdirTemp("", "fetch-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	p, err := Fetch(ctx, b, key, dir)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return p, cleanup, nil
+}
+
+// PutDir uploads every file under dir, keyed by prefix plus its path relative
+// to dir.
+func PutDir(ctx context.Context, b Backend, prefix, dir string) (int, error) {
+	n := 0
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if err := PutFile(ctx, b, path.Join(prefix, filepath.ToSlash(rel)), p); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// ContentType guesses the MIME type of a key from its extension.
+func ContentType(key string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".pdf":
+		return "application/pdf"
+	case ".mp4":
+		return "video/mp4"
+	case ".zip":
+		return "application/zip"
+	case ".dzi", ".xml":
+		return "application/xml"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+func isPresignMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodPut
+}